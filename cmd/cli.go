@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-pkg/db/postgres"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/sales-service/internal/config"
+	"github.com/jacky-htg/sales-service/internal/rpc"
 	"github.com/jacky-htg/sales-service/internal/schema"
+	"github.com/jacky-htg/sales-service/internal/service"
+	"github.com/jacky-htg/sales-service/internal/tracing"
 	_ "github.com/lib/pq"
 )
 
@@ -39,6 +47,12 @@ func run(log *log.Logger) error {
 	}
 	defer db.Close()
 
+	companyID := flag.String("company", "", "company id of imported or exported data")
+	userID := flag.String("user", "", "user id recorded as creator of imported data")
+	dryRun := flag.Bool("dry-run", false, "import in a transaction rolled back at the end")
+	dateFrom := flag.String("from", "", "first date of export, YYYY-MM-DD")
+	dateTo := flag.String("to", "", "last date of export, YYYY-MM-DD")
+	branchID := flag.String("branch", "", "branch id filter of export")
 	flag.Parse()
 
 	switch flag.Arg(0) {
@@ -50,11 +64,92 @@ func run(log *log.Logger) error {
 		return nil
 
 	case "seed":
-		if err := schema.Seed(db); err != nil {
+		// seeds are written for every company, as the worker role when it is set
+		seedDb := db
+		if len(os.Getenv("POSTGRES_WORKER_USER")) > 0 {
+			seedDb, err = tracing.OpenWorkerDB()
+			if err != nil {
+				return fmt.Errorf("connecting to db as worker: %v", err)
+			}
+			defer seedDb.Close()
+		}
+
+		if err := schema.Seed(seedDb); err != nil {
 			return fmt.Errorf("seeding database: %v", err)
 		}
 		log.Println("Seed data complete")
 		return nil
+
+	case "import":
+		// cli -company=<id> -user=<id> [-dry-run] import customer|salesman <file.csv|file.xlsx>
+		if flag.NArg() < 3 || len(*companyID) == 0 || len(*userID) == 0 {
+			return fmt.Errorf("usage: cli -company=<id> -user=<id> [-dry-run] import customer|salesman <file.csv|file.xlsx>")
+		}
+
+		data, err := os.ReadFile(flag.Arg(2))
+		if err != nil {
+			return fmt.Errorf("reading import file: %v", err)
+		}
+
+		ctx := context.WithValue(context.Background(), app.Ctx("companyID"), *companyID)
+		ctx = context.WithValue(ctx, app.Ctx("userID"), *userID)
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(flag.Arg(2))), ".")
+
+		importService := service.Import{Db: db}
+		res, err := importService.Run(ctx, flag.Arg(1), format, data, *dryRun)
+		if err != nil {
+			return fmt.Errorf("importing %s: %v", flag.Arg(1), err)
+		}
+
+		for _, row := range res.Rows {
+			if len(row.Error) > 0 {
+				log.Printf("row %d (%s): %s", row.Row, row.Code, row.Error)
+			}
+		}
+		log.Printf("Import %s complete (dry run: %v): total %d, created %d, updated %d, failed %d",
+			res.Entity, res.DryRun, res.Total, res.Created, res.Updated, res.Failed)
+		return nil
+
+	case "export":
+		// cli -company=<id> -from=<date> -to=<date> [-branch=<id>] export sales|sales_return <file.csv|file.xlsx>
+		if flag.NArg() < 3 || len(*companyID) == 0 {
+			return fmt.Errorf("usage: cli -company=<id> -from=YYYY-MM-DD -to=YYYY-MM-DD [-branch=<id>] export sales|sales_return <file.csv|file.xlsx>")
+		}
+
+		f, err := os.Create(flag.Arg(2))
+		if err != nil {
+			return fmt.Errorf("creating export file: %v", err)
+		}
+		defer f.Close()
+
+		ctx := context.WithValue(context.Background(), app.Ctx("companyID"), *companyID)
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(flag.Arg(2))), ".")
+
+		exportService := service.Export{Db: db}
+		switch flag.Arg(1) {
+		case "sales":
+			err = exportService.WriteSales(ctx, &rpc.ExportSalesRequest{
+				Filter:   &sales.ListSalesRequest{BranchId: *branchID},
+				Format:   format,
+				DateFrom: *dateFrom,
+				DateTo:   *dateTo,
+			}, f)
+		case "sales_return":
+			err = exportService.WriteSalesReturns(ctx, &rpc.ExportSalesReturnRequest{
+				Filter:   &sales.ListSalesReturnRequest{BranchId: *branchID},
+				Format:   format,
+				DateFrom: *dateFrom,
+				DateTo:   *dateTo,
+			}, f)
+		default:
+			return fmt.Errorf("unknown export %s", flag.Arg(1))
+		}
+		if err != nil {
+			return fmt.Errorf("exporting %s: %v", flag.Arg(1), err)
+		}
+
+		log.Printf("Export %s complete: %s", flag.Arg(1), flag.Arg(2))
+		return nil
 	}
 
 	return nil
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/logging"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxCachedUsers bound the cache, it is cleared when full
+const maxCachedUsers = 10000
+
+type ctxKey struct{}
+
+type grant struct {
+	permissions map[string]bool
+	expiresAt   time.Time
+}
+
+// Authorizer resolve the role (group) of the caller from the user service and check it against Policy.
+// Permissions are cached per user for TTL.
+type Authorizer struct {
+	Db         *sql.DB
+	UserClient users.UserServiceClient
+	// AdminGroups have every permission, to grant the first permissions of a company
+	AdminGroups []string
+	TTL         time.Duration
+
+	mu    sync.Mutex
+	cache map[string]grant
+}
+
+// UnaryInterceptor deny the call when the caller has not the permission of the method
+func (u *Authorizer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := u.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor deny the stream when the caller has not the permission of the method
+func (u *Authorizer) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := u.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// Invalidate drop the cached permissions, the next call of every user resolve them again
+func (u *Authorizer) Invalidate() {
+	u.mu.Lock()
+	u.cache = nil
+	u.mu.Unlock()
+}
+
+func (u *Authorizer) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if Public[fullMethod] {
+		return ctx, nil
+	}
+
+	permission, ok := Policy[fullMethod]
+	if !ok {
+		return ctx, status.Errorf(codes.PermissionDenied, "%s is not allowed", fullMethod)
+	}
+
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = logging.SetCaller(ctx, ctx.Value(app.Ctx("companyID")).(string), ctx.Value(app.Ctx("userID")).(string))
+
+	permissions, err := u.permissions(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	if !permissions[permission] {
+		return ctx, status.Errorf(codes.PermissionDenied, "permission %s is required", permission)
+	}
+
+	return context.WithValue(ctx, ctxKey{}, permissions), nil
+}
+
+func (u *Authorizer) permissions(ctx context.Context) (map[string]bool, error) {
+	key := ctx.Value(app.Ctx("companyID")).(string) + "/" + ctx.Value(app.Ctx("userID")).(string)
+
+	u.mu.Lock()
+	cached, ok := u.cache[key]
+	u.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.permissions, nil
+	}
+
+	user, err := u.UserClient.View(app.SetMetadata(ctx), &users.Id{Id: ctx.Value(app.Ctx("userID")).(string)})
+	if err != nil {
+		if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "Error when calling user.Get service: %s", err)
+	}
+
+	permissions := make(map[string]bool)
+	if u.isAdmin(user.GetGroupId()) {
+		for _, permission := range Permissions() {
+			permissions[permission] = true
+		}
+	} else if len(user.GetGroupId()) > 0 {
+		role := model.RolePermission{GroupID: user.GetGroupId()}
+		if err := role.Get(ctx, u.Db); err != nil {
+			return nil, err
+		}
+
+		for _, permission := range role.Permissions {
+			permissions[permission] = true
+		}
+	}
+
+	u.mu.Lock()
+	if u.cache == nil || len(u.cache) >= maxCachedUsers {
+		u.cache = make(map[string]grant)
+	}
+	u.cache[key] = grant{permissions: permissions, expiresAt: time.Now().Add(u.TTL)}
+	u.mu.Unlock()
+
+	return permissions, nil
+}
+
+func (u *Authorizer) isAdmin(groupID string) bool {
+	for _, admin := range u.AdminGroups {
+		if len(groupID) > 0 && admin == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// Can tell whether the caller of ctx has the permission, for checks finer than the method
+func Can(ctx context.Context, permission string) bool {
+	permissions, _ := ctx.Value(ctxKey{}).(map[string]bool)
+	return permissions[permission]
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"sort"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+const (
+	SalesCreate          = "sales:create"
+	SalesUpdate          = "sales:update"
+	SalesView            = "sales:view"
+	SalesExport          = "sales:export"
+	SalesApproveDiscount = "sales:approve-discount"
+
+	SalesReturnCreate = "sales-return:create"
+	SalesReturnUpdate = "sales-return:update"
+	SalesReturnView   = "sales-return:view"
+	SalesReturnExport = "sales-return:export"
+
+	CustomerCreate = "customer:create"
+	CustomerUpdate = "customer:update"
+	CustomerView   = "customer:view"
+	CustomerDelete = "customer:delete"
+	CustomerMerge  = "customer:merge"
+
+	SalesmanCreate = "salesman:create"
+	SalesmanUpdate = "salesman:update"
+	SalesmanView   = "salesman:view"
+	SalesmanDelete = "salesman:delete"
+
+	MasterImport = "master:import"
+
+	DocumentRender = "document:render"
+	DocumentManage = "document:manage"
+
+	PostingView   = "posting:view"
+	PostingManage = "posting:manage"
+
+	WebhookView   = "webhook:view"
+	WebhookManage = "webhook:manage"
+
+	AuditView = "audit:view"
+
+	SearchView = "search:view"
+
+	CacheView   = "cache:view"
+	CacheManage = "cache:manage"
+
+	PermissionView   = "permission:view"
+	PermissionManage = "permission:manage"
+)
+
+// Public methods are called without permission check
+var Public = map[string]bool{
+	healthpb.Health_Check_FullMethodName:                                   true,
+	healthpb.Health_Watch_FullMethodName:                                   true,
+	reflectionv1.ServerReflection_ServerReflectionInfo_FullMethodName:      true,
+	reflectionv1alpha.ServerReflection_ServerReflectionInfo_FullMethodName: true,
+}
+
+// Policy is the permission required by each rpc, a method not listed is denied
+var Policy = map[string]string{
+	method(sales.SalesService_ServiceDesc.ServiceName, "Create"): SalesCreate,
+	method(sales.SalesService_ServiceDesc.ServiceName, "Update"): SalesUpdate,
+	method(sales.SalesService_ServiceDesc.ServiceName, "View"):   SalesView,
+	method(sales.SalesService_ServiceDesc.ServiceName, "List"):   SalesView,
+
+	method(sales.SalesReturnService_ServiceDesc.ServiceName, "Create"): SalesReturnCreate,
+	method(sales.SalesReturnService_ServiceDesc.ServiceName, "Update"): SalesReturnUpdate,
+	method(sales.SalesReturnService_ServiceDesc.ServiceName, "View"):   SalesReturnView,
+	method(sales.SalesReturnService_ServiceDesc.ServiceName, "List"):   SalesReturnView,
+
+	method(sales.CustomerService_ServiceDesc.ServiceName, "CustomerCreate"): CustomerCreate,
+	method(sales.CustomerService_ServiceDesc.ServiceName, "CustomerUpdate"): CustomerUpdate,
+	method(sales.CustomerService_ServiceDesc.ServiceName, "CustomerView"):   CustomerView,
+	method(sales.CustomerService_ServiceDesc.ServiceName, "CustomerDelete"): CustomerDelete,
+	method(sales.CustomerService_ServiceDesc.ServiceName, "CustomerList"):   CustomerView,
+	method(rpc.CustomerStatusServiceName, "CustomerDeactivate"):             CustomerUpdate,
+	method(rpc.CustomerStatusServiceName, "CustomerReactivate"):             CustomerUpdate,
+	method(rpc.CustomerStatusServiceName, "CustomerListByStatus"):           CustomerView,
+	method(rpc.CustomerMergeServiceName, "CustomerFindDuplicates"):          CustomerView,
+	method(rpc.CustomerMergeServiceName, "CustomerMerge"):                   CustomerMerge,
+
+	method(sales.SalesmanService_ServiceDesc.ServiceName, "SalesmanCreate"): SalesmanCreate,
+	method(sales.SalesmanService_ServiceDesc.ServiceName, "SalesmanUpdate"): SalesmanUpdate,
+	method(sales.SalesmanService_ServiceDesc.ServiceName, "SalesmanView"):   SalesmanView,
+	method(sales.SalesmanService_ServiceDesc.ServiceName, "SalesmanDelete"): SalesmanDelete,
+	method(sales.SalesmanService_ServiceDesc.ServiceName, "SalesmanList"):   SalesmanView,
+	method(rpc.SalesmanStatusServiceName, "SalesmanDeactivate"):             SalesmanUpdate,
+	method(rpc.SalesmanStatusServiceName, "SalesmanReactivate"):             SalesmanUpdate,
+	method(rpc.SalesmanStatusServiceName, "SalesmanListByStatus"):           SalesmanView,
+
+	method(rpc.ImportServiceName, "Import"):             MasterImport,
+	method(rpc.ExportServiceName, "ExportSales"):        SalesExport,
+	method(rpc.ExportServiceName, "ExportSalesReturns"): SalesReturnExport,
+
+	method(rpc.DocumentServiceName, "DocumentTemplateView"):   DocumentRender,
+	method(rpc.DocumentServiceName, "DocumentTemplateUpdate"): DocumentManage,
+	method(rpc.DocumentServiceName, "Render"):                 DocumentRender,
+
+	method(rpc.PostingServiceName, "LedgerAccountView"):   PostingView,
+	method(rpc.PostingServiceName, "LedgerAccountUpdate"): PostingManage,
+	method(rpc.PostingServiceName, "PostingStatus"):       PostingView,
+	method(rpc.PostingServiceName, "PostingRetry"):        PostingManage,
+
+	method(rpc.WebhookServiceName, "WebhookCreate"):         WebhookManage,
+	method(rpc.WebhookServiceName, "WebhookUpdate"):         WebhookManage,
+	method(rpc.WebhookServiceName, "WebhookView"):           WebhookView,
+	method(rpc.WebhookServiceName, "WebhookDelete"):         WebhookManage,
+	method(rpc.WebhookServiceName, "WebhookList"):           WebhookView,
+	method(rpc.WebhookServiceName, "WebhookDeadLetterList"): WebhookView,
+	method(rpc.WebhookServiceName, "WebhookReplay"):         WebhookManage,
+
+	method(rpc.AuditServiceName, "AuditList"): AuditView,
+
+	method(rpc.SearchServiceName, "Search"): SearchView,
+
+	method(rpc.CacheServiceName, "CacheInvalidate"): CacheManage,
+	method(rpc.CacheServiceName, "CacheStats"):      CacheView,
+
+	method(rpc.PermissionServiceName, "PermissionList"):       PermissionView,
+	method(rpc.PermissionServiceName, "RolePermissionView"):   PermissionView,
+	method(rpc.PermissionServiceName, "RolePermissionUpdate"): PermissionManage,
+}
+
+// Permissions return every known permission, sorted
+func Permissions() []string {
+	set := map[string]bool{SalesApproveDiscount: true}
+	for _, permission := range Policy {
+		set[permission] = true
+	}
+
+	var list []string
+	for permission := range set {
+		list = append(list, permission)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// IsPermission tell whether the permission is known
+func IsPermission(permission string) bool {
+	for _, known := range Permissions() {
+		if known == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func method(serviceName, name string) string {
+	return "/" + serviceName + "/" + name
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizeDenyByDefault(t *testing.T) {
+	tests := []struct {
+		name       string
+		fullMethod string
+		wantCode   codes.Code
+	}{
+		{name: "health check is public", fullMethod: healthpb.Health_Check_FullMethodName, wantCode: codes.OK},
+		{name: "reflection is public", fullMethod: "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", wantCode: codes.OK},
+		{name: "method not in policy", fullMethod: "/sales.SalesService/Delete", wantCode: codes.PermissionDenied},
+		{name: "service not in policy", fullMethod: "/sales.UnknownService/List", wantCode: codes.PermissionDenied},
+		{name: "method of another case", fullMethod: "/sales.SalesService/create", wantCode: codes.PermissionDenied},
+		{name: "without service", fullMethod: "/Create", wantCode: codes.PermissionDenied},
+		{name: "empty", fullMethod: "", wantCode: codes.PermissionDenied},
+	}
+
+	u := &Authorizer{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := u.authorize(context.Background(), tt.fullMethod)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("authorize(%q) error %v, want %v", tt.fullMethod, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		fullMethod string
+		want       string
+	}{
+		{"/sales.SalesService/Create", SalesCreate},
+		{"/sales.SalesService/List", SalesView},
+		{"/sales.SalesReturnService/Update", SalesReturnUpdate},
+		{"/sales.CustomerService/CustomerDelete", CustomerDelete},
+		{"/sales.CustomerMergeService/CustomerMerge", CustomerMerge},
+		{"/sales.CustomerStatusService/CustomerDeactivate", CustomerUpdate},
+		{"/sales.SalesmanService/SalesmanList", SalesmanView},
+		{"/sales.ImportService/Import", MasterImport},
+		{"/sales.ExportService/ExportSalesReturns", SalesReturnExport},
+		{"/sales.DocumentService/DocumentTemplateUpdate", DocumentManage},
+		{"/sales.PostingService/PostingRetry", PostingManage},
+		{"/sales.WebhookService/WebhookReplay", WebhookManage},
+		{"/sales.AuditService/AuditList", AuditView},
+		{"/sales.CacheService/CacheInvalidate", CacheManage},
+		{"/sales.PermissionService/RolePermissionUpdate", PermissionManage},
+	}
+
+	for _, tt := range tests {
+		if got := Policy[tt.fullMethod]; got != tt.want {
+			t.Errorf("Policy[%q] = %q, want %q", tt.fullMethod, got, tt.want)
+		}
+	}
+}
+
+// TestPolicyCoverService check every rpc served by this service is in the policy, else it is denied to everyone
+func TestPolicyCoverService(t *testing.T) {
+	descs := []grpc.ServiceDesc{
+		rpc.AuditService_ServiceDesc,
+		rpc.CacheService_ServiceDesc,
+		rpc.CustomerMergeService_ServiceDesc,
+		rpc.CustomerStatusService_ServiceDesc,
+		rpc.DocumentService_ServiceDesc,
+		rpc.ExportService_ServiceDesc,
+		rpc.ImportService_ServiceDesc,
+		rpc.PermissionService_ServiceDesc,
+		rpc.PostingService_ServiceDesc,
+		rpc.SalesmanStatusService_ServiceDesc,
+		rpc.SearchService_ServiceDesc,
+		rpc.WebhookService_ServiceDesc,
+	}
+
+	for _, desc := range descs {
+		for _, m := range desc.Methods {
+			if _, ok := Policy[method(desc.ServiceName, m.MethodName)]; !ok {
+				t.Errorf("%s is not in the policy", method(desc.ServiceName, m.MethodName))
+			}
+		}
+		for _, s := range desc.Streams {
+			if _, ok := Policy[method(desc.ServiceName, s.StreamName)]; !ok {
+				t.Errorf("%s is not in the policy", method(desc.ServiceName, s.StreamName))
+			}
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	list := Permissions()
+	if !sort.StringsAreSorted(list) {
+		t.Errorf("Permissions() is not sorted: %v", list)
+	}
+
+	tests := []struct {
+		permission string
+		want       bool
+	}{
+		{SalesCreate, true},
+		{SalesApproveDiscount, true},
+		{PermissionManage, true},
+		{"sales:delete", false},
+		{"SALES:CREATE", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPermission(tt.permission); got != tt.want {
+			t.Errorf("IsPermission(%q) = %v, want %v", tt.permission, got, tt.want)
+		}
+	}
+}
+
+type fakeUserClient struct {
+	groupID string
+	err     error
+	calls   int
+}
+
+func (f *fakeUserClient) View(ctx context.Context, in *users.Id, opts ...grpc.CallOption) (*users.User, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &users.User{Id: in.GetId(), GroupId: f.groupID}, nil
+}
+
+func TestAuthorizerPermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   *fakeUserClient
+		want     []string
+		deny     []string
+		wantCode codes.Code
+	}{
+		{
+			name:   "admin group has every permission",
+			client: &fakeUserClient{groupID: "admin"},
+			want:   []string{SalesCreate, SalesApproveDiscount, PermissionManage},
+		},
+		{
+			name:   "user without group has no permission",
+			client: &fakeUserClient{},
+			deny:   []string{SalesView, PermissionView},
+		},
+		{
+			name:     "status of the user service is kept",
+			client:   &fakeUserClient{err: status.Error(codes.NotFound, "user not found")},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "other error of the user service is internal",
+			client:   &fakeUserClient{err: errors.New("connection refused")},
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &Authorizer{UserClient: tt.client, AdminGroups: []string{"admin"}, TTL: time.Minute}
+			ctx := context.WithValue(context.Background(), app.Ctx("companyID"), "company")
+			ctx = context.WithValue(ctx, app.Ctx("userID"), "user")
+
+			permissions, err := u.permissions(ctx)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("permissions error %v, want %v", err, tt.wantCode)
+			}
+			for _, permission := range tt.want {
+				if !permissions[permission] {
+					t.Errorf("permission %s is not granted", permission)
+				}
+			}
+			for _, permission := range tt.deny {
+				if permissions[permission] {
+					t.Errorf("permission %s is granted", permission)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizerCache(t *testing.T) {
+	client := &fakeUserClient{groupID: "admin"}
+	u := &Authorizer{UserClient: client, AdminGroups: []string{"admin"}, TTL: time.Minute}
+	ctx := context.WithValue(context.Background(), app.Ctx("companyID"), "company")
+	ctx = context.WithValue(ctx, app.Ctx("userID"), "user")
+
+	for i := 0; i < 3; i++ {
+		if _, err := u.permissions(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if client.calls != 1 {
+		t.Errorf("user service called %d times, want 1", client.calls)
+	}
+
+	u.Invalidate()
+	if _, err := u.permissions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.calls != 2 {
+		t.Errorf("user service called %d times after invalidate, want 2", client.calls)
+	}
+}
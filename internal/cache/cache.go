@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/sales-service/internal/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of cached lookups
+const (
+	KindUser     = "user"
+	KindRegion   = "region"
+	KindBranch   = "branch"
+	KindBranches = "branches"
+	KindProduct  = "product"
+)
+
+// Kinds list every kind, for validation of invalidation requests
+var Kinds = []string{KindUser, KindRegion, KindBranch, KindBranches, KindProduct}
+
+// Backend store cached values, values are shared between callers and must not be modified
+type Backend interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+	DeletePrefix(prefix string)
+	Len() int
+}
+
+// Cache keep lookups of other services per company and count hits and misses.
+// A nil Cache never hit, callers use it the same way as an enabled one.
+type Cache struct {
+	Backend Backend
+	TTL     time.Duration
+	// Stale keep values after TTL, they are only returned by Fallback
+	Stale time.Duration
+	// Degraded are the kinds which fall back to stale values when their service is down
+	Degraded map[string]bool
+
+	hits      uint64
+	misses    uint64
+	fallbacks uint64
+}
+
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	HitRate   float64
+	Entries   int
+	Fallbacks uint64
+}
+
+type item struct {
+	value      interface{}
+	freshUntil time.Time
+}
+
+// Get return the value of kind and id for the company of ctx
+func (c *Cache) Get(ctx context.Context, kind, id string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	value, ok := c.Backend.Get(key(ctx, kind, id))
+	if ok && time.Now().Before(value.(*item).freshUntil) {
+		atomic.AddUint64(&c.hits, 1)
+		return value.(*item).value, true
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	return nil, false
+}
+
+// Fallback return the value of kind and id even when it is stale, for a read failed because its service is down.
+// It return false for other errors and for kinds not in Degraded.
+func (c *Cache) Fallback(ctx context.Context, kind, id string, err error) (interface{}, bool) {
+	if c == nil || !c.Degraded[kind] || !client.IsDownstreamFailure(err) {
+		return nil, false
+	}
+
+	value, ok := c.Backend.Get(key(ctx, kind, id))
+	if !ok {
+		return nil, false
+	}
+
+	atomic.AddUint64(&c.fallbacks, 1)
+	return value.(*item).value, true
+}
+
+// Set store the value of kind and id for the company of ctx
+func (c *Cache) Set(ctx context.Context, kind, id string, value interface{}) {
+	if c == nil {
+		return
+	}
+
+	c.Backend.Set(key(ctx, kind, id), &item{value: value, freshUntil: time.Now().Add(c.TTL)}, c.TTL+c.Stale)
+}
+
+// Invalidate drop the value of kind and id for the company of ctx, every value of kind when id is empty
+func (c *Cache) Invalidate(ctx context.Context, kind, id string) {
+	if c == nil {
+		return
+	}
+
+	if len(id) == 0 {
+		c.Backend.DeletePrefix(key(ctx, kind, ""))
+		return
+	}
+
+	c.Backend.Delete(key(ctx, kind, id))
+}
+
+// InvalidateCompany drop every value of the company
+func (c *Cache) InvalidateCompany(companyID string) {
+	if c == nil {
+		return
+	}
+
+	c.Backend.DeletePrefix(companyID + "/")
+}
+
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	s := Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Entries:   c.Backend.Len(),
+		Fallbacks: atomic.LoadUint64(&c.fallbacks),
+	}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+
+	return s
+}
+
+// Collectors export hits, misses, fallbacks and entries to prometheus
+func (c *Cache) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "sales_cache_hits_total",
+			Help: "Lookups of other services answered by the cache.",
+		}, func() float64 { return float64(c.Stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "sales_cache_misses_total",
+			Help: "Lookups of other services not in the cache.",
+		}, func() float64 { return float64(c.Stats().Misses) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "sales_cache_fallbacks_total",
+			Help: "Stale cached values returned while a service was down.",
+		}, func() float64 { return float64(c.Stats().Fallbacks) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "sales_cache_entries",
+			Help: "Values in the cache.",
+		}, func() float64 { return float64(c.Stats().Entries) }),
+	}
+}
+
+// IsKind tell whether the kind is known
+func IsKind(kind string) bool {
+	for _, known := range Kinds {
+		if known == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func key(ctx context.Context, kind, id string) string {
+	companyID, _ := ctx.Value(app.Ctx("companyID")).(string)
+	return strings.Join([]string{companyID, kind, id}, "/")
+}
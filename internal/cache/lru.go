@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// LRU is the in-process backend, the least recently used entry is evicted when it is full
+type LRU struct {
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (u *LRU) Get(key string) (interface{}, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	elem, ok := u.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		u.remove(elem)
+		return nil, false
+	}
+
+	u.order.MoveToFront(elem)
+	return e.value, true
+}
+
+func (u *LRU) Set(key string, value interface{}, ttl time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if elem, ok := u.items[key]; ok {
+		e := elem.Value.(*entry)
+		e.value = value
+		e.expiresAt = time.Now().Add(ttl)
+		u.order.MoveToFront(elem)
+		return
+	}
+
+	u.items[key] = u.order.PushFront(&entry{key: key, value: value, expiresAt: time.Now().Add(ttl)})
+	for u.capacity > 0 && u.order.Len() > u.capacity {
+		u.remove(u.order.Back())
+	}
+}
+
+func (u *LRU) Delete(key string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if elem, ok := u.items[key]; ok {
+		u.remove(elem)
+	}
+}
+
+func (u *LRU) DeletePrefix(prefix string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for key, elem := range u.items {
+		if strings.HasPrefix(key, prefix) {
+			u.remove(elem)
+		}
+	}
+}
+
+func (u *LRU) Len() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.order.Len()
+}
+
+func (u *LRU) remove(elem *list.Element) {
+	u.order.Remove(elem)
+	delete(u.items, elem.Value.(*entry).key)
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Breaker stop calling a downstream after Failures failures in a row.
+// It stays open for OpenFor, then let one call through: success close it, failure open it again.
+type Breaker struct {
+	Name     string
+	Failures int
+	OpenFor  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// Allow return Unavailable while the breaker is open
+func (b *Breaker) Allow() error {
+	if b == nil || b.Failures <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.Failures {
+		return nil
+	}
+
+	if time.Now().Before(b.openUntil) || b.probing {
+		return status.Errorf(codes.Unavailable, "%s service is unavailable, circuit breaker is open", b.Name)
+	}
+
+	b.probing = true
+	return nil
+}
+
+// Done record the result of an allowed call
+func (b *Breaker) Done(err error) {
+	if b == nil || b.Failures <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !IsDownstreamFailure(err) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.Failures {
+		b.openUntil = time.Now().Add(b.OpenFor)
+	}
+}
+
+// IsDownstreamFailure tell whether err means the downstream is down or too slow, not that the request is wrong
+func IsDownstreamFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	notFound := status.Error(codes.NotFound, "not found")
+
+	// each step is a call: allowed tell whether Allow let it through, result is given to Done when it is
+	type step struct {
+		wait    time.Duration
+		allowed bool
+		result  error
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "open after failures in a row",
+			steps: []step{
+				{allowed: true, result: unavailable},
+				{allowed: true, result: unavailable},
+				{allowed: false},
+				{allowed: false},
+			},
+		},
+		{
+			name: "success reset the failures",
+			steps: []step{
+				{allowed: true, result: unavailable},
+				{allowed: true, result: nil},
+				{allowed: true, result: unavailable},
+				{allowed: true, result: unavailable},
+				{allowed: false},
+			},
+		},
+		{
+			name: "error of the request is not a failure",
+			steps: []step{
+				{allowed: true, result: unavailable},
+				{allowed: true, result: notFound},
+				{allowed: true, result: unavailable},
+				{allowed: true},
+			},
+		},
+		{
+			name: "successful probe close the breaker",
+			steps: []step{
+				{allowed: true, result: unavailable},
+				{allowed: true, result: unavailable},
+				{wait: 30 * time.Millisecond, allowed: true, result: nil},
+				{allowed: true, result: nil},
+				{allowed: true},
+			},
+		},
+		{
+			name: "failed probe open the breaker again",
+			steps: []step{
+				{allowed: true, result: unavailable},
+				{allowed: true, result: unavailable},
+				{wait: 30 * time.Millisecond, allowed: true, result: status.Error(codes.DeadlineExceeded, "slow")},
+				{allowed: false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Breaker{Name: "inventory", Failures: 2, OpenFor: 20 * time.Millisecond}
+			for i, s := range tt.steps {
+				time.Sleep(s.wait)
+				err := b.Allow()
+				if allowed := err == nil; allowed != s.allowed {
+					t.Fatalf("step %d: Allow() = %v, want allowed %v", i, err, s.allowed)
+				}
+				if err != nil {
+					if status.Code(err) != codes.Unavailable {
+						t.Fatalf("step %d: Allow() error %v, want Unavailable", i, err)
+					}
+					continue
+				}
+				b.Done(s.result)
+			}
+		})
+	}
+}
+
+func TestBreakerOneProbe(t *testing.T) {
+	b := &Breaker{Name: "inventory", Failures: 1, OpenFor: 10 * time.Millisecond}
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Done(status.Error(codes.Unavailable, "down"))
+
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe is not allowed: %v", err)
+	}
+	if err := b.Allow(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("second call during the probe = %v, want Unavailable", err)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	for _, b := range []*Breaker{nil, {Name: "inventory"}} {
+		for i := 0; i < 10; i++ {
+			if err := b.Allow(); err != nil {
+				t.Fatalf("disabled breaker Allow() = %v", err)
+			}
+			b.Done(status.Error(codes.Unavailable, "down"))
+		}
+	}
+}
+
+func TestIsDownstreamFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{status.Error(codes.Unavailable, ""), true},
+		{status.Error(codes.DeadlineExceeded, ""), true},
+		{status.Error(codes.ResourceExhausted, ""), true},
+		{status.Error(codes.NotFound, ""), false},
+		{status.Error(codes.InvalidArgument, ""), false},
+		{status.Error(codes.Internal, ""), false},
+		{context.Canceled, false},
+		{errors.New("plain error"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsDownstreamFailure(tt.err); got != tt.want {
+			t.Errorf("IsDownstreamFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
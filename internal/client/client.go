@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/sales-service/internal/logging"
+	"github.com/jacky-htg/sales-service/internal/metrics"
+	"google.golang.org/grpc"
+)
+
+// readPrefixes are the method names of idempotent reads, only they are retried
+var readPrefixes = []string{"View", "List", "Get", "Has", "Find"}
+
+// Options tune the calls to one downstream service
+type Options struct {
+	Name string
+	// Timeout of each call when the context has no earlier deadline
+	Timeout time.Duration
+	// Retries of a failed read, with exponential Backoff between them
+	Retries int
+	Backoff time.Duration
+	Breaker *Breaker
+}
+
+// OptionsFromEnv read CLIENT_TIMEOUT (default 5s), CLIENT_RETRIES (default 2), CLIENT_BACKOFF (default 100ms),
+// CLIENT_BREAKER_FAILURES (default 5, 0 disable the breaker) and CLIENT_BREAKER_OPEN (default 30s).
+// <NAME>_SERVICE_TIMEOUT and <NAME>_SERVICE_RETRIES override them for one downstream, for example INVENTORY_SERVICE_TIMEOUT.
+func OptionsFromEnv(name string) Options {
+	prefix := strings.ToUpper(name) + "_SERVICE_"
+
+	return Options{
+		Name:    name,
+		Timeout: envDuration(prefix+"TIMEOUT", envDuration("CLIENT_TIMEOUT", 5*time.Second)),
+		Retries: envInt(prefix+"RETRIES", envInt("CLIENT_RETRIES", 2)),
+		Backoff: envDuration("CLIENT_BACKOFF", 100*time.Millisecond),
+		Breaker: &Breaker{
+			Name:     name,
+			Failures: envInt("CLIENT_BREAKER_FAILURES", 5),
+			OpenFor:  envDuration("CLIENT_BREAKER_OPEN", 30*time.Second),
+		},
+	}
+}
+
+// Dial connect to the downstream with the deadline, retry and breaker interceptors of opts
+func Dial(target string, opts Options, dialOptions ...grpc.DialOption) (*grpc.ClientConn, error) {
+	dialOptions = append(dialOptions,
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor(), opts.UnaryInterceptor(), metrics.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(logging.StreamClientInterceptor(), opts.StreamInterceptor(), metrics.StreamClientInterceptor()),
+	)
+
+	return grpc.Dial(target, dialOptions...)
+}
+
+func (o Options) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		attempts := 1
+		if isRead(method) {
+			attempts += o.Retries
+		}
+
+		var err error
+		for attempt := 0; attempt < attempts; attempt++ {
+			if attempt > 0 {
+				if waitErr := o.wait(ctx, attempt); waitErr != nil {
+					return err
+				}
+			}
+
+			if err = o.Breaker.Allow(); err != nil {
+				return err
+			}
+
+			callCtx, cancel := o.deadline(ctx)
+			err = invoker(callCtx, method, req, reply, cc, callOpts...)
+			cancel()
+			o.Breaker.Done(err)
+
+			if !IsDownstreamFailure(err) {
+				return err
+			}
+		}
+
+		return err
+	}
+}
+
+// StreamInterceptor bound the whole stream by the deadline, only opening a stream of a read is retried
+func (o Options) StreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		attempts := 1
+		if isRead(method) {
+			attempts += o.Retries
+		}
+
+		var err error
+		for attempt := 0; attempt < attempts; attempt++ {
+			if attempt > 0 {
+				if waitErr := o.wait(ctx, attempt); waitErr != nil {
+					return nil, err
+				}
+			}
+
+			if err = o.Breaker.Allow(); err != nil {
+				return nil, err
+			}
+
+			callCtx, cancel := o.deadline(ctx)
+			var stream grpc.ClientStream
+			stream, err = streamer(callCtx, desc, cc, method, callOpts...)
+			if err == nil {
+				return &clientStream{ClientStream: stream, cancel: cancel, breaker: o.Breaker}, nil
+			}
+
+			cancel()
+			o.Breaker.Done(err)
+
+			if !IsDownstreamFailure(err) {
+				return nil, err
+			}
+		}
+
+		return nil, err
+	}
+}
+
+func (o Options) deadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < o.Timeout {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, o.Timeout)
+}
+
+func (o Options) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(o.Backoff << uint(attempt-1))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// clientStream release the deadline and record the result in the breaker when the stream ends
+type clientStream struct {
+	grpc.ClientStream
+	cancel  context.CancelFunc
+	breaker *Breaker
+	done    bool
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil && !s.done {
+		s.done = true
+		if err == io.EOF {
+			s.breaker.Done(nil)
+		} else {
+			s.breaker.Done(err)
+		}
+		s.cancel()
+	}
+
+	return err
+}
+
+func isRead(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+	for _, prefix := range readPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
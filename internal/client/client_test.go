@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryInterceptor(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	tests := []struct {
+		name      string
+		method    string
+		retries   int
+		failures  int
+		results   []error
+		wantCalls int
+		wantCode  codes.Code
+	}{
+		{name: "success", method: "/inventory.ProductService/View", retries: 2, results: []error{nil}, wantCalls: 1},
+		{name: "read retried until success", method: "/inventory.ProductService/View", retries: 2,
+			results: []error{unavailable, unavailable, nil}, wantCalls: 3},
+		{name: "read retried until retries are used", method: "/inventory.ProductService/List", retries: 2,
+			results: []error{unavailable, unavailable, unavailable, nil}, wantCalls: 3, wantCode: codes.Unavailable},
+		{name: "write is not retried", method: "/inventory.ReceiveService/Create", retries: 2,
+			results: []error{unavailable, nil}, wantCalls: 1, wantCode: codes.Unavailable},
+		{name: "error of the request is not retried", method: "/inventory.ProductService/View", retries: 2,
+			results: []error{status.Error(codes.NotFound, "not found"), nil}, wantCalls: 1, wantCode: codes.NotFound},
+		{name: "open breaker stop the retries", method: "/inventory.ProductService/View", retries: 5, failures: 2,
+			results: []error{unavailable, unavailable, nil}, wantCalls: 2, wantCode: codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Options{Name: "inventory", Timeout: time.Second, Retries: tt.retries, Backoff: time.Millisecond,
+				Breaker: &Breaker{Name: "inventory", Failures: tt.failures, OpenFor: time.Minute}}
+
+			calls := 0
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				err := tt.results[calls]
+				calls++
+				return err
+			}
+
+			err := o.UnaryInterceptor()(context.Background(), tt.method, nil, nil, nil, invoker)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("error %v, want %v", err, tt.wantCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestUnaryInterceptorCanceledDuringBackoff(t *testing.T) {
+	o := Options{Name: "inventory", Retries: 3, Backoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		cancel()
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	err := o.UnaryInterceptor()(ctx, "/inventory.ProductService/View", nil, nil, nil, invoker)
+	if status.Code(err) != codes.Unavailable || calls != 1 {
+		t.Errorf("error %v after %d calls, want the Unavailable of the only call", err, calls)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		parent      time.Duration
+		wantNone    bool
+		wantAtLeast time.Duration
+		wantAtMost  time.Duration
+	}{
+		{name: "no timeout", timeout: 0, wantNone: true},
+		{name: "timeout", timeout: time.Second, wantAtLeast: 900 * time.Millisecond, wantAtMost: time.Second},
+		{name: "earlier deadline of the caller", timeout: time.Minute, parent: time.Second, wantAtLeast: 900 * time.Millisecond, wantAtMost: time.Second},
+		{name: "later deadline of the caller", timeout: time.Second, parent: time.Minute, wantAtLeast: 900 * time.Millisecond, wantAtMost: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.parent > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.parent)
+				defer cancel()
+			}
+
+			callCtx, cancel := Options{Timeout: tt.timeout}.deadline(ctx)
+			defer cancel()
+
+			deadline, ok := callCtx.Deadline()
+			if tt.wantNone {
+				if ok {
+					t.Errorf("deadline %v, want none", deadline)
+				}
+				return
+			}
+			if left := time.Until(deadline); !ok || left < tt.wantAtLeast || left > tt.wantAtMost {
+				t.Errorf("deadline in %v, want between %v and %v", left, tt.wantAtLeast, tt.wantAtMost)
+			}
+		})
+	}
+}
+
+type fakeStream struct {
+	grpc.ClientStream
+	err error
+}
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	return s.err
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	tests := []struct {
+		name         string
+		method       string
+		openErrors   []error
+		recvErr      error
+		wantCalls    int
+		wantCode     codes.Code
+		wantFailures int
+	}{
+		{name: "stream ended", method: "/inventory.ProductService/List", openErrors: []error{nil}, recvErr: io.EOF, wantCalls: 1},
+		{name: "open of a read retried", method: "/inventory.ProductService/List", openErrors: []error{unavailable, nil}, recvErr: io.EOF, wantCalls: 2},
+		{name: "open of a write not retried", method: "/inventory.ReceiveService/Upload", openErrors: []error{unavailable, nil},
+			wantCalls: 1, wantCode: codes.Unavailable, wantFailures: 1},
+		{name: "stream broken", method: "/inventory.ProductService/List", openErrors: []error{nil}, recvErr: unavailable,
+			wantCalls: 1, wantFailures: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Breaker{Name: "inventory", Failures: 10, OpenFor: time.Minute}
+			o := Options{Name: "inventory", Timeout: time.Second, Retries: 2, Backoff: time.Millisecond, Breaker: b}
+
+			calls := 0
+			streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				err := tt.openErrors[calls]
+				calls++
+				if err != nil {
+					return nil, err
+				}
+				return &fakeStream{err: tt.recvErr}, nil
+			}
+
+			stream, err := o.StreamInterceptor()(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, tt.method, streamer)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("error %v, want %v", err, tt.wantCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", calls, tt.wantCalls)
+			}
+			if stream != nil {
+				stream.RecvMsg(nil)
+				stream.RecvMsg(nil)
+			}
+			if b.failures != tt.wantFailures {
+				t.Errorf("breaker has %d failures, want %d", b.failures, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestIsRead(t *testing.T) {
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"/inventory.ProductService/View", true},
+		{"/inventory.ProductService/List", true},
+		{"/users.UserService/GetByToken", true},
+		{"/inventory.StockService/HasStock", true},
+		{"/inventory.ProductService/FindByCode", true},
+		{"/inventory.ReceiveService/Create", false},
+		{"/inventory.ReceiveService/Update", false},
+		{"/inventory.ViewService/Delete", false},
+		{"View", true},
+	}
+
+	for _, tt := range tests {
+		if got := isRead(tt.method); got != tt.want {
+			t.Errorf("isRead(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantTimeout time.Duration
+		wantRetries int
+		wantBackoff time.Duration
+		wantFails   int
+	}{
+		{name: "defaults", wantTimeout: 5 * time.Second, wantRetries: 2, wantBackoff: 100 * time.Millisecond, wantFails: 5},
+		{name: "every service", env: map[string]string{"CLIENT_TIMEOUT": "2s", "CLIENT_RETRIES": "0", "CLIENT_BACKOFF": "1s", "CLIENT_BREAKER_FAILURES": "0"},
+			wantTimeout: 2 * time.Second, wantRetries: 0, wantBackoff: time.Second, wantFails: 0},
+		{name: "one service override", env: map[string]string{"CLIENT_TIMEOUT": "2s", "INVENTORY_SERVICE_TIMEOUT": "10s", "INVENTORY_SERVICE_RETRIES": "4"},
+			wantTimeout: 10 * time.Second, wantRetries: 4, wantBackoff: 100 * time.Millisecond, wantFails: 5},
+		{name: "invalid values fall back", env: map[string]string{"CLIENT_TIMEOUT": "-1s", "CLIENT_RETRIES": "two", "CLIENT_BACKOFF": "fast"},
+			wantTimeout: 5 * time.Second, wantRetries: 2, wantBackoff: 100 * time.Millisecond, wantFails: 5},
+	}
+
+	keys := []string{"CLIENT_TIMEOUT", "CLIENT_RETRIES", "CLIENT_BACKOFF", "CLIENT_BREAKER_FAILURES", "CLIENT_BREAKER_OPEN",
+		"INVENTORY_SERVICE_TIMEOUT", "INVENTORY_SERVICE_RETRIES"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range keys {
+				t.Setenv(key, tt.env[key])
+			}
+
+			o := OptionsFromEnv("inventory")
+			if o.Timeout != tt.wantTimeout || o.Retries != tt.wantRetries || o.Backoff != tt.wantBackoff || o.Breaker.Failures != tt.wantFails {
+				t.Errorf("OptionsFromEnv = timeout %v retries %d backoff %v failures %d, want %v %d %v %d",
+					o.Timeout, o.Retries, o.Backoff, o.Breaker.Failures, tt.wantTimeout, tt.wantRetries, tt.wantBackoff, tt.wantFails)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+
+	"github.com/jacky-htg/sales-service/internal/pdf"
+)
+
+const (
+	margin     = 40.0
+	rowHeight  = 16.0
+	fontSize   = 9.0
+	footerY    = pdf.PageHeight - 30
+	bodyBottom = pdf.PageHeight - 70
+)
+
+// Template is the per company layout of printed documents
+type Template struct {
+	Logo   []byte
+	Header string
+	Footer string
+	Terms  string
+}
+
+type Line struct {
+	ProductCode string
+	ProductName string
+	Quantity    int32
+	Price       float64
+	DiscAmount  float64
+	TotalPrice  float64
+}
+
+type Data struct {
+	Title         string
+	Code          string
+	Date          string
+	Reference     string
+	BranchName    string
+	CustomerName  string
+	CustomerAddr  string
+	CustomerPhone string
+	SalesmanName  string
+	Remark        string
+	Lines         []Line
+	// ShowPrices false for picking and delivery note
+	ShowPrices           bool
+	Price                float64
+	AdditionalDiscAmount float64
+	TotalPrice           float64
+	Signatures           []string
+}
+
+type column struct {
+	title string
+	x     float64
+	right bool
+}
+
+// ValidateLogo check the logo is a png or jpeg image
+func ValidateLogo(logo []byte) error {
+	if len(logo) == 0 {
+		return nil
+	}
+	_, _, err := image.DecodeConfig(bytes.NewReader(logo))
+	return err
+}
+
+// Render produce the pdf of a sales document
+func Render(tpl Template, data Data) ([]byte, error) {
+	doc := pdf.New()
+
+	y := renderHeader(doc, tpl, data)
+	columns := tableColumns(data.ShowPrices)
+	y = renderTableHeader(doc, columns, y)
+
+	for i, line := range data.Lines {
+		if y+rowHeight > bodyBottom {
+			doc.AddPage()
+			y = renderTableHeader(doc, columns, margin)
+		}
+
+		values := []string{fmt.Sprint(i + 1), line.ProductCode, truncate(line.ProductName, columns[3].x-columns[2].x-5), fmt.Sprint(line.Quantity)}
+		if data.ShowPrices {
+			values = append(values, formatAmount(line.Price), formatAmount(line.DiscAmount), formatAmount(line.TotalPrice))
+		} else {
+			values = append(values, "")
+		}
+
+		y += rowHeight
+		for j, value := range values {
+			if columns[j].right {
+				doc.TextRight(columns[j].x, y, fontSize, false, value)
+			} else {
+				doc.Text(columns[j].x, y, fontSize, false, value)
+			}
+		}
+
+		if !data.ShowPrices {
+			// check box for the picker
+			doc.Line(columns[4].x-10, y-8, columns[4].x, y-8)
+			doc.Line(columns[4].x-10, y+2, columns[4].x, y+2)
+			doc.Line(columns[4].x-10, y-8, columns[4].x-10, y+2)
+			doc.Line(columns[4].x, y-8, columns[4].x, y+2)
+		}
+	}
+
+	y += 8
+	doc.Line(margin, y, pdf.PageWidth-margin, y)
+
+	var closing []func()
+	if data.ShowPrices {
+		totals := [][2]string{
+			{"Subtotal", formatAmount(data.Price)},
+			{"Additional Discount", formatAmount(data.AdditionalDiscAmount)},
+			{"Total", formatAmount(data.TotalPrice)},
+		}
+		for _, total := range totals {
+			total := total
+			closing = append(closing, func() {
+				y += rowHeight
+				doc.Text(pdf.PageWidth-margin-200, y, fontSize, total[0] == "Total", total[0])
+				doc.TextRight(pdf.PageWidth-margin, y, fontSize, total[0] == "Total", total[1])
+			})
+		}
+	}
+
+	if len(data.Remark) > 0 {
+		closing = append(closing, func() { y += rowHeight })
+		for _, line := range pdf.WrapText("Remark: "+data.Remark, fontSize, pdf.PageWidth-2*margin) {
+			line := line
+			closing = append(closing, func() {
+				y += rowHeight - 4
+				doc.Text(margin, y, fontSize, false, line)
+			})
+		}
+	}
+
+	if len(tpl.Terms) > 0 {
+		closing = append(closing, func() { y += rowHeight })
+		for _, line := range pdf.WrapText(tpl.Terms, fontSize-1, pdf.PageWidth-2*margin) {
+			line := line
+			closing = append(closing, func() {
+				y += rowHeight - 5
+				doc.Text(margin, y, fontSize-1, false, line)
+			})
+		}
+	}
+
+	for _, draw := range closing {
+		if y+rowHeight > bodyBottom {
+			doc.AddPage()
+			y = margin
+		}
+		draw()
+	}
+
+	if len(data.Signatures) > 0 {
+		if y+90 > bodyBottom {
+			doc.AddPage()
+			y = margin
+		}
+		y += 30
+		width := (pdf.PageWidth - 2*margin) / float64(len(data.Signatures))
+		for i, signature := range data.Signatures {
+			x := margin + float64(i)*width
+			doc.Text(x+10, y, fontSize, false, signature)
+			doc.Line(x+10, y+50, x+width-20, y+50)
+		}
+	}
+
+	renderFooter(doc, tpl)
+
+	return doc.Bytes()
+}
+
+func renderHeader(doc *pdf.Document, tpl Template, data Data) float64 {
+	headerX := margin
+	if len(tpl.Logo) > 0 {
+		if img, _, err := image.Decode(bytes.NewReader(tpl.Logo)); err == nil {
+			bounds := img.Bounds()
+			w, h := float64(bounds.Dx()), float64(bounds.Dy())
+			scale := math.Min(60/w, 60/h)
+			doc.Image(img, margin, margin, w*scale, h*scale)
+			headerX = margin + w*scale + 10
+		}
+	}
+
+	y := margin + 10
+	for i, line := range pdf.WrapText(tpl.Header, fontSize, 280) {
+		doc.Text(headerX, y, fontSize, i == 0, line)
+		y += 12
+	}
+
+	right := pdf.PageWidth - margin
+	doc.TextRight(right, margin+14, 16, true, data.Title)
+	doc.TextRight(right, margin+32, fontSize+1, true, data.Code)
+	doc.TextRight(right, margin+46, fontSize, false, data.Date)
+
+	y = math.Max(y, margin+70)
+	doc.Line(margin, y, pdf.PageWidth-margin, y)
+
+	y += 16
+	left := [][2]string{
+		{"Customer", data.CustomerName},
+		{"Address", data.CustomerAddr},
+		{"Phone", data.CustomerPhone},
+	}
+	rightInfo := [][2]string{
+		{"Branch", data.BranchName},
+		{"Salesman", data.SalesmanName},
+	}
+	if len(data.Reference) > 0 {
+		rightInfo = append(rightInfo, [2]string{"Reference", data.Reference})
+	}
+
+	for i := 0; i < len(left) || i < len(rightInfo); i++ {
+		if i < len(left) {
+			doc.Text(margin, y, fontSize, true, left[i][0])
+			doc.Text(margin+55, y, fontSize, false, ": "+truncate(left[i][1], 230))
+		}
+		if i < len(rightInfo) {
+			doc.Text(340, y, fontSize, true, rightInfo[i][0])
+			doc.Text(395, y, fontSize, false, ": "+truncate(rightInfo[i][1], 150))
+		}
+		y += 13
+	}
+
+	return y + 6
+}
+
+func tableColumns(showPrices bool) []column {
+	if showPrices {
+		return []column{
+			{"No", margin, false},
+			{"Code", margin + 25, false},
+			{"Product", margin + 100, false},
+			{"Qty", 340, true},
+			{"Price", 410, true},
+			{"Disc", 470, true},
+			{"Total", pdf.PageWidth - margin, true},
+		}
+	}
+
+	return []column{
+		{"No", margin, false},
+		{"Code", margin + 25, false},
+		{"Product", margin + 100, false},
+		{"Qty", 440, true},
+		{"Checked", pdf.PageWidth - margin, true},
+	}
+}
+
+func renderTableHeader(doc *pdf.Document, columns []column, y float64) float64 {
+	doc.Line(margin, y, pdf.PageWidth-margin, y)
+	y += 12
+	for _, c := range columns {
+		if c.right {
+			doc.TextRight(c.x, y, fontSize, true, c.title)
+		} else {
+			doc.Text(c.x, y, fontSize, true, c.title)
+		}
+	}
+	y += 5
+	doc.Line(margin, y, pdf.PageWidth-margin, y)
+	return y
+}
+
+func renderFooter(doc *pdf.Document, tpl Template) {
+	pages := doc.PageCount()
+	for i := 0; i < pages; i++ {
+		doc.SetPage(i)
+		doc.Line(margin, footerY-12, pdf.PageWidth-margin, footerY-12)
+		if len(tpl.Footer) > 0 {
+			doc.Text(margin, footerY, fontSize-1, false, truncate(strings.ReplaceAll(tpl.Footer, "\n", " "), 420))
+		}
+		doc.TextRight(pdf.PageWidth-margin, footerY, fontSize-1, false, fmt.Sprintf("Page %d / %d", i+1, pages))
+	}
+}
+
+func truncate(s string, width float64) string {
+	if pdf.TextWidth(s, fontSize, false) <= width {
+		return s
+	}
+
+	r := []rune(s)
+	for len(r) > 0 && pdf.TextWidth(string(r)+"...", fontSize, false) > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "..."
+}
+
+// formatAmount format number with thousand separator and two decimals
+func formatAmount(v float64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	s := fmt.Sprintf("%.2f", v)
+	integer, decimal := s[:len(s)-3], s[len(s)-3:]
+
+	var b strings.Builder
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+
+	return sign + b.String() + decimal
+}
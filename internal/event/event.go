@@ -0,0 +1,42 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrTooLarge is returned by a broker that can not carry the event, the relay move the event to dead letter without retry
+var ErrTooLarge = errors.New("event too large for the broker")
+
+// Event is the message published to the broker for every document change.
+// Delivery is at least once, consumers should ignore an Id they already handled.
+type Event struct {
+	Id            string          `json:"id"`
+	Sequence      int64           `json:"sequence"`
+	CompanyID     string          `json:"company_id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	CreatedBy     string          `json:"created_by"`
+}
+
+// Broker deliver events to other services
+type Broker interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// Brokers publish every event to each broker, an event is published again to all of them when one fails
+type Brokers []Broker
+
+func (b Brokers) Publish(ctx context.Context, e Event) error {
+	for _, broker := range b {
+		if err := broker.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker keep published events in memory and pass them to subscribers, only built with the tests
+type MemoryBroker struct {
+	mu          sync.Mutex
+	events      []Event
+	subscribers []func(Event) error
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// Subscribe register handler, an error from handler fails the publish so the relay retries the event
+func (b *MemoryBroker) Subscribe(handler func(Event) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, handler)
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, e Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, handler := range b.subscribers {
+		if err := handler(e); err != nil {
+			return err
+		}
+	}
+
+	b.events = append(b.events, e)
+	return nil
+}
+
+// Events return every event published so far
+func (b *MemoryBroker) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Event(nil), b.events...)
+}
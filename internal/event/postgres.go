@@ -0,0 +1,76 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultChannel is the postgres notification channel of sales events
+const DefaultChannel = "sales_events"
+
+// postgres rejects notification payload of 8000 bytes or more
+const maxNotifyPayload = 7900
+
+// PostgresBroker publish events with NOTIFY so any service connected to the database can LISTEN
+type PostgresBroker struct {
+	Db      *sql.DB
+	Channel string
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal event: %v", err)
+	}
+
+	if len(data) > maxNotifyPayload {
+		return fmt.Errorf("%w: %d bytes, notify accept %d", ErrTooLarge, len(data), maxNotifyPayload)
+	}
+
+	_, err = b.Db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, b.channel(), string(data))
+	if err != nil {
+		return fmt.Errorf("notify event: %v", err)
+	}
+
+	return nil
+}
+
+func (b *PostgresBroker) channel() string {
+	if len(b.Channel) == 0 {
+		return DefaultChannel
+	}
+	return b.Channel
+}
+
+// Listen call handler for every event notified on channel until ctx is done
+func Listen(ctx context.Context, dsn, channel string, handler func(Event)) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, nil)
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		return fmt.Errorf("listen %s: %v", channel, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-listener.Notify:
+			// nil notification means the connection was re-established
+			if n == nil {
+				continue
+			}
+
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				continue
+			}
+			handler(e)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jacky-htg/sales-service/internal/model"
+)
+
+// relayLockKey is the advisory lock held by the relay publishing the outbox, only one relay runs at a time
+const relayLockKey = 7310001
+
+// MaxAttempts before an event is moved to dead letter
+const MaxAttempts = 10
+
+// Relay publish outbox events to the broker.
+// Events of a document are published in the order they were written, a failed event blocks the next events of the same document until it succeed.
+// A failed event is retried with exponential backoff, after MaxAttempts it is moved to dead letter and stop blocking its document.
+type Relay struct {
+	Db        *sql.DB
+	Broker    Broker
+	Log       *slog.Logger
+	Interval  time.Duration
+	BatchSize int
+}
+
+// Run poll the outbox until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.Log.Error("relay outbox", "error", err)
+		}
+
+		// drain a full batch without waiting
+		if err == nil && published > 0 && published == r.batchSize() {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publish one batch of pending events and return how many were published
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	tx, err := model.BeginSystemTx(ctx, r.Db, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, relayLockKey).Scan(&locked)
+	if err != nil {
+		return 0, fmt.Errorf("lock outbox: %v", err)
+	}
+
+	if !locked {
+		return 0, nil
+	}
+
+	events, err := model.PendingOutboxEvents(ctx, tx, r.batchSize())
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	blocked := map[string]bool{}
+	for _, e := range events {
+		if blocked[e.AggregateID] {
+			continue
+		}
+
+		err = r.Broker.Publish(ctx, Event{
+			Id:            e.Id,
+			Sequence:      e.Sequence,
+			CompanyID:     e.CompanyID,
+			AggregateType: e.AggregateType,
+			AggregateID:   e.AggregateID,
+			Type:          e.EventType,
+			Payload:       e.Payload,
+			CreatedAt:     e.CreatedAt,
+			CreatedBy:     e.CreatedBy,
+		})
+		if err != nil {
+			attempts := e.Attempts + 1
+			dead := attempts >= MaxAttempts || errors.Is(err, ErrTooLarge)
+			if dead {
+				r.Log.Error("outbox event moved to dead letter", "event_id", e.Id, "event_type", e.EventType, "attempts", attempts, "error", err)
+			} else {
+				blocked[e.AggregateID] = true
+			}
+
+			if err := e.MarkFailed(ctx, tx, err, time.Now().UTC().Add(backoff(attempts)), dead); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if err := e.MarkPublished(ctx, tx); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	// a failed commit leaves the events pending, they are published again on the next round
+	if err := tx.Commit(); err != nil {
+		return published, fmt.Errorf("commit outbox: %v", err)
+	}
+
+	return published, nil
+}
+
+// backoff double the wait from 1 second up to 10 minutes
+func backoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return 10 * time.Minute
+	}
+
+	wait := time.Second << uint(attempts-1)
+	if wait > 10*time.Minute {
+		wait = 10 * time.Minute
+	}
+	return wait
+}
+
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return 100
+	}
+	return r.BatchSize
+}
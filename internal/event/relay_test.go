@@ -0,0 +1,295 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/schema"
+)
+
+// testDB open the database of TEST_DATABASE_URL with the migrations applied, the test is skipped without it
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if len(dsn) == 0 {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := schema.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
+
+// testWorkerDB open the database as the role of the workers, TEST_WORKER_DATABASE_URL or else TEST_DATABASE_URL.
+// The test is skipped when the role does not bypass row level security.
+func testWorkerDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_WORKER_DATABASE_URL")
+	if len(dsn) == 0 {
+		dsn = os.Getenv("TEST_DATABASE_URL")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open worker database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := model.CheckSystemDB(context.Background(), db); err != nil {
+		t.Skipf("worker database: %v", err)
+	}
+
+	return db
+}
+
+// writeEvents create one outbox event per type of the aggregate in a single transaction, as a document change does
+func writeEvents(t *testing.T, db *sql.DB, companyID, aggregateID string, eventTypes ...string) []*model.OutboxEvent {
+	t.Helper()
+
+	ctx := context.WithValue(context.Background(), app.Ctx("companyID"), companyID)
+	ctx = context.WithValue(ctx, app.Ctx("userID"), uuid.New().String())
+
+	tx, err := model.BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatalf("begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var events []*model.OutboxEvent
+	for _, eventType := range eventTypes {
+		e, err := model.NewOutboxEvent(model.AggregateSales, aggregateID, eventType, map[string]string{"id": aggregateID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Create(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	return events
+}
+
+// setNextAttempt move the next attempt of the event, to make it due or keep it waiting whatever the speed of the test
+func setNextAttempt(t *testing.T, db *sql.DB, e *model.OutboxEvent, at time.Time) {
+	t.Helper()
+
+	tx, err := model.BeginCompanyTx(context.Background(), db, nil, e.CompanyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE outbox_events SET next_attempt_at = $1 WHERE id = $2`, at, e.Id)
+	if err != nil {
+		t.Fatalf("update next attempt: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+// outboxState return attempts and whether the event is published and dead
+func outboxState(t *testing.T, db *sql.DB, e *model.OutboxEvent) (int, bool, bool) {
+	t.Helper()
+
+	tx, err := model.BeginCompanyTx(context.Background(), db, nil, e.CompanyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	var attempts int
+	var published, dead bool
+	err = tx.QueryRow(`SELECT attempts, published_at IS NOT NULL, dead_at IS NOT NULL FROM outbox_events WHERE id = $1`, e.Id).
+		Scan(&attempts, &published, &dead)
+	if err != nil {
+		t.Fatalf("read outbox event: %v", err)
+	}
+
+	return attempts, published, dead
+}
+
+// relayed return the ids of the events of the aggregates published to broker, in publish order
+func relayed(broker *MemoryBroker, aggregateIDs ...string) []string {
+	var ids []string
+	for _, e := range broker.Events() {
+		for _, aggregateID := range aggregateIDs {
+			if e.AggregateID == aggregateID {
+				ids = append(ids, e.Id)
+			}
+		}
+	}
+	return ids
+}
+
+func ids(events ...*model.OutboxEvent) []string {
+	var list []string
+	for _, e := range events {
+		list = append(list, e.Id)
+	}
+	return list
+}
+
+func newTestRelay(db *sql.DB, broker Broker) *Relay {
+	return &Relay{Db: db, Broker: broker, Log: slog.New(slog.NewTextHandler(io.Discard, nil)), BatchSize: 1000}
+}
+
+func TestRelayOrderAndRedelivery(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	companyID := uuid.New().String()
+	salesA := uuid.New().String()
+	salesB := uuid.New().String()
+
+	a := writeEvents(t, db, companyID, salesA, model.EventSalesCreated, model.EventSalesUpdated, model.EventSalesUpdated)
+	b := writeEvents(t, db, companyID, salesB, model.EventSalesCreated)
+	workerDb := testWorkerDB(t)
+
+	broker := NewMemoryBroker()
+	failing := map[string]bool{a[0].Id: true}
+	broker.Subscribe(func(e Event) error {
+		if failing[e.Id] {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	relay := newTestRelay(workerDb, broker)
+
+	// the first event of A fails: the rest of A waits, B is published
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got, want := relayed(broker, salesA, salesB), ids(b...); !equal(got, want) {
+		t.Fatalf("after failure relayed %v, want %v", got, want)
+	}
+	if attempts, published, dead := outboxState(t, db, a[0]); attempts != 1 || published || dead {
+		t.Fatalf("failed event attempts %d published %v dead %v, want 1 false false", attempts, published, dead)
+	}
+
+	// during the backoff nothing of A is published, even after the broker recovers
+	delete(failing, a[0].Id)
+	setNextAttempt(t, db, a[0], time.Now().UTC().Add(time.Hour))
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got, want := relayed(broker, salesA), []string(nil); !equal(got, want) {
+		t.Fatalf("during backoff relayed %v, want none", got)
+	}
+
+	// once due the failed event is delivered again, followed by the rest of A in order
+	setNextAttempt(t, db, a[0], time.Now().UTC().Add(-time.Second))
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got, want := relayed(broker, salesA), ids(a...); !equal(got, want) {
+		t.Fatalf("after redelivery relayed %v, want %v", got, want)
+	}
+	if attempts, published, _ := outboxState(t, db, a[0]); attempts != 2 || !published {
+		t.Fatalf("redelivered event attempts %d published %v, want 2 true", attempts, published)
+	}
+
+	// published events are not relayed again
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got := relayed(broker, salesA, salesB); len(got) != len(a)+len(b) {
+		t.Fatalf("relayed %d events, want %d", len(got), len(a)+len(b))
+	}
+}
+
+func TestRelayDeadLetter(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	companyID := uuid.New().String()
+	sales := uuid.New().String()
+
+	events := writeEvents(t, db, companyID, sales, model.EventSalesCreated, model.EventSalesUpdated)
+	workerDb := testWorkerDB(t)
+
+	broker := NewMemoryBroker()
+	broker.Subscribe(func(e Event) error {
+		if e.Id == events[0].Id {
+			return fmt.Errorf("%w: test", ErrTooLarge)
+		}
+		return nil
+	})
+	relay := newTestRelay(workerDb, broker)
+
+	// an event the broker can not carry is not retried and does not hold back its document
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if attempts, published, dead := outboxState(t, db, events[0]); attempts != 1 || published || !dead {
+		t.Fatalf("too large event attempts %d published %v dead %v, want 1 false true", attempts, published, dead)
+	}
+	if got, want := relayed(broker, sales), ids(events[1]); !equal(got, want) {
+		t.Fatalf("relayed %v, want %v", got, want)
+	}
+}
+
+func TestPostgresBrokerTooLarge(t *testing.T) {
+	payload := `{"remark":"` + strings.Repeat("x", maxNotifyPayload) + `"}`
+	err := (&PostgresBroker{}).Publish(context.Background(), Event{Id: uuid.New().String(), Payload: []byte(payload)})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("publish error %v, want ErrTooLarge", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{10, 512 * time.Second},
+		{11, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,376 @@
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxConditions = 20
+	maxValues     = 100
+	maxWords      = 10
+)
+
+// Type of a field, it decide the operators allowed and how values are parsed
+type Type int
+
+const (
+	Text Type = iota
+	ID
+	Date
+	Timestamp
+	Number
+	Enum
+	// FullText match words on the search_vector and search_text columns of the table in Expr, with the ~ operator only
+	FullText
+)
+
+// Field is a field callers can filter or sort on.
+// Expr is the sql of the field, written by the model and never by the caller.
+// When Expr contain %s the comparison is put there, e.g. EXISTS (... AND product_id %s), else it follow Expr.
+type Field struct {
+	Expr string
+	Type Type
+	// Values allowed of an Enum
+	Values []string
+	// Sortable field can be the order by of a list
+	Sortable bool
+	// NoFilter field can only be sorted on
+	NoFilter bool
+}
+
+// Cast is the postgres cast of a text parameter compared to the field
+func (f Field) Cast() string {
+	switch f.Type {
+	case ID:
+		return "::uuid"
+	case Date, Timestamp:
+		return "::timestamp"
+	case Number:
+		return "::double precision"
+	}
+	return ""
+}
+
+// Schema is the whitelist of fields of a list, by name
+type Schema map[string]Field
+
+// Sort return the sortable field name
+func (s Schema) Sort(name string) (Field, error) {
+	f, ok := s[name]
+	if !ok || !f.Sortable {
+		return Field{}, status.Errorf(codes.InvalidArgument, "can not order by %s, use one of %s", name, strings.Join(s.sortable(), ", "))
+	}
+	return f, nil
+}
+
+func (s Schema) sortable() []string {
+	var names []string
+	for name, f := range s {
+		if f.Sortable {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Condition compare a field to its values. Op is one of = != < <= > >= ~ (contains, text only) and in.
+type Condition struct {
+	Field  string
+	Op     string
+	Values []string
+}
+
+// Expression is conditions joined with AND
+type Expression []Condition
+
+// Eq is the condition field = value, nothing when value is empty
+func (e Expression) Eq(field, value string) Expression {
+	if len(value) == 0 {
+		return e
+	}
+	return append(e, Condition{Field: field, Op: "=", Values: []string{value}})
+}
+
+// Contains is the condition field ~ value, nothing when value is empty
+func (e Expression) Contains(field, value string) Expression {
+	if len(value) == 0 {
+		return e
+	}
+	return append(e, Condition{Field: field, Op: "~", Values: []string{value}})
+}
+
+// Where compile the expression to sql conditions appended to where, its values appended to paramQueries as parameters.
+// Only fields of schema are allowed, values are checked against the type of the field.
+func (e Expression) Where(schema Schema, where []string, paramQueries []interface{}) ([]string, []interface{}, error) {
+	for _, c := range e {
+		f, ok := schema[c.Field]
+		if !ok || f.NoFilter {
+			return where, paramQueries, status.Errorf(codes.InvalidArgument, "can not filter on %s", c.Field)
+		}
+
+		if !allowed(f.Type, c.Op) {
+			return where, paramQueries, status.Errorf(codes.InvalidArgument, "operator %s is not allowed on %s", c.Op, c.Field)
+		}
+
+		if f.Type == FullText {
+			tsquery, text, err := Search(c.Values[0])
+			if err != nil {
+				return where, paramQueries, err
+			}
+			paramQueries = append(paramQueries, tsquery, text)
+			where = append(where, f.Match(fmt.Sprintf("$%d", len(paramQueries)-1), fmt.Sprintf("$%d", len(paramQueries))))
+			continue
+		}
+
+		var placeholders []string
+		for _, v := range c.Values {
+			value, err := parse(f, c.Op, v)
+			if err != nil {
+				return where, paramQueries, status.Errorf(codes.InvalidArgument, "invalid value of %s: %v", c.Field, err)
+			}
+			paramQueries = append(paramQueries, value)
+			placeholders = append(placeholders, fmt.Sprintf("$%d%s", len(paramQueries), f.Cast()))
+		}
+
+		var cmp string
+		switch c.Op {
+		case "in":
+			cmp = "IN (" + strings.Join(placeholders, ", ") + ")"
+		case "~":
+			cmp = "ILIKE " + placeholders[0]
+		case "!=":
+			cmp = "<> " + placeholders[0]
+		default:
+			cmp = c.Op + " " + placeholders[0]
+		}
+
+		if strings.Contains(f.Expr, "%s") {
+			where = append(where, strings.ReplaceAll(f.Expr, "%s", cmp))
+		} else {
+			where = append(where, f.Expr+" "+cmp)
+		}
+	}
+
+	return where, paramQueries, nil
+}
+
+func allowed(t Type, op string) bool {
+	if t == FullText {
+		return op == "~"
+	}
+
+	switch op {
+	case "=", "!=", "in":
+		return true
+	case "<", "<=", ">", ">=":
+		return t == Date || t == Timestamp || t == Number
+	case "~":
+		return t == Text || t == FullText
+	}
+	return false
+}
+
+// Search is the tsquery of the words of q, each word match as prefix, and the lower case words of q for the trigram similarity
+func Search(q string) (tsquery, text string, err error) {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "", "", status.Error(codes.InvalidArgument, "Please supply search with letters or digits")
+	}
+	if len(words) > maxWords {
+		return "", "", status.Errorf(codes.InvalidArgument, "search has more than %d words", maxWords)
+	}
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = w + ":*"
+	}
+
+	return strings.Join(terms, " & "), strings.Join(words, " "), nil
+}
+
+// Match is the condition of a FullText field: every word found by full text search,
+// or the text similar enough to a part of search_text (pg_trgm word similarity) to catch typos.
+// tsquery and text are the placeholders of the values of Search.
+func (f Field) Match(tsquery, text string) string {
+	return fmt.Sprintf(`(%[1]s.search_vector @@ to_tsquery('simple', %[2]s) OR %[3]s <%% %[1]s.search_text)`, f.Expr, tsquery, text)
+}
+
+// Rank of a row matched by a FullText field, higher is better
+func (f Field) Rank(tsquery, text string) string {
+	return fmt.Sprintf(`(ts_rank(%[1]s.search_vector, to_tsquery('simple', %[2]s)) + word_similarity(%[3]s, %[1]s.search_text))`, f.Expr, tsquery, text)
+}
+
+func parse(f Field, op, v string) (interface{}, error) {
+	switch f.Type {
+	case ID:
+		if _, err := uuid.Parse(v); err != nil {
+			return nil, fmt.Errorf("%q is not an id", v)
+		}
+	case Date:
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return nil, fmt.Errorf("%q is not a date yyyy-mm-dd", v)
+		}
+	case Timestamp:
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return nil, fmt.Errorf("%q is not a RFC 3339 time or a date", v)
+			}
+		}
+	case Number:
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+	case Enum:
+		for _, allowed := range f.Values {
+			if v == allowed {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %s", v, strings.Join(f.Values, ", "))
+	case Text:
+		if op == "~" {
+			return "%" + escapeLike(v) + "%", nil
+		}
+	}
+	return v, nil
+}
+
+// escapeLike make % _ and \ match themselves in an ILIKE pattern
+func escapeLike(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(v)
+}
+
+// Parse read an expression of conditions joined by AND:
+//
+//	sales_date >= 2024-01-01 AND total_price < 1000 AND customer_name ~ "pt abc" AND status in (posted, failed)
+//
+// Values with spaces, commas or parentheses are double quoted, \" and \\ escape inside quotes.
+func Parse(s string) (Expression, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+	}
+
+	var e Expression
+	for i := 0; i < len(tokens); {
+		if len(e) > 0 {
+			if !strings.EqualFold(tokens[i].text, "and") || tokens[i].quoted {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid filter: expected AND before %q", tokens[i].text)
+			}
+			i++
+		}
+
+		if i+2 >= len(tokens) {
+			return nil, status.Error(codes.InvalidArgument, "invalid filter: incomplete condition")
+		}
+
+		if tokens[i].quoted {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid filter: expected a field before %q", tokens[i].text)
+		}
+		c := Condition{Field: tokens[i].text, Op: strings.ToLower(tokens[i+1].text)}
+		i += 2
+
+		if c.Op == "in" {
+			if tokens[i].text != "(" || tokens[i].quoted {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid filter: expected ( after %s in", c.Field)
+			}
+			i++
+			for {
+				if i >= len(tokens) {
+					return nil, status.Error(codes.InvalidArgument, "invalid filter: missing )")
+				}
+				c.Values = append(c.Values, tokens[i].text)
+				i++
+				if i >= len(tokens) {
+					return nil, status.Error(codes.InvalidArgument, "invalid filter: missing )")
+				}
+				if tokens[i].text == ")" && !tokens[i].quoted {
+					i++
+					break
+				}
+				if tokens[i].text != "," || tokens[i].quoted {
+					return nil, status.Errorf(codes.InvalidArgument, "invalid filter: expected , or ) in values of %s", c.Field)
+				}
+				i++
+			}
+			if len(c.Values) > maxValues {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid filter: at most %d values in %s", maxValues, c.Field)
+			}
+		} else {
+			c.Values = []string{tokens[i].text}
+			i++
+		}
+
+		e = append(e, c)
+		if len(e) > maxConditions {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid filter: at most %d conditions", maxConditions)
+		}
+	}
+
+	return e, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '~':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{text: "="})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(s) && s[i+1] == '=' {
+				tokens = append(tokens, token{text: s[i : i+2]})
+				i += 2
+			} else if c == '!' {
+				return nil, fmt.Errorf("unexpected ! at %d", i)
+			} else {
+				tokens = append(tokens, token{text: string(c)})
+				i++
+			}
+		case c == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			i++
+			tokens = append(tokens, token{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r(),=!<>~\"", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, token{text: s[start:i]})
+		}
+	}
+	return tokens, nil
+}
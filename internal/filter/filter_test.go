@@ -0,0 +1,236 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var testSchema = Schema{
+	"code":          {Expr: "code", Type: Text, Sortable: true},
+	"customer_id":   {Expr: "customer_id", Type: ID},
+	"sales_date":    {Expr: "sales_date", Type: Date, Sortable: true},
+	"created_at":    {Expr: "created_at", Type: Timestamp, Sortable: true},
+	"total_price":   {Expr: "total_price", Type: Number, Sortable: true},
+	"status":        {Expr: "posting_status", Type: Enum, Values: []string{"pending", "posted", "failed"}},
+	"product_id":    {Expr: "EXISTS (SELECT 1 FROM sales_details WHERE sales_id = sales.id AND product_id %s)", Type: ID},
+	"customer_name": {Expr: "customer_name", Type: Text, Sortable: true, NoFilter: true},
+	"search":        {Expr: "sales", Type: FullText},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Expression
+		wantErr bool
+	}{
+		{
+			name: "single condition",
+			in:   "total_price < 1000",
+			want: Expression{{Field: "total_price", Op: "<", Values: []string{"1000"}}},
+		},
+		{
+			name: "conditions joined by and of any case",
+			in:   `sales_date >= 2024-01-01 AND code ~ "SO 01" and status != posted`,
+			want: Expression{
+				{Field: "sales_date", Op: ">=", Values: []string{"2024-01-01"}},
+				{Field: "code", Op: "~", Values: []string{"SO 01"}},
+				{Field: "status", Op: "!=", Values: []string{"posted"}},
+			},
+		},
+		{
+			name: "in list with quoted value",
+			in:   `status IN (posted, "fail,ed")`,
+			want: Expression{{Field: "status", Op: "in", Values: []string{"posted", "fail,ed"}}},
+		},
+		{
+			name: "escape inside quotes",
+			in:   `code = "a\"b\\c"`,
+			want: Expression{{Field: "code", Op: "=", Values: []string{`a"b\c`}}},
+		},
+		{
+			name: "operators without spaces",
+			in:   "total_price<=10 AND total_price>1",
+			want: Expression{
+				{Field: "total_price", Op: "<=", Values: []string{"10"}},
+				{Field: "total_price", Op: ">", Values: []string{"1"}},
+			},
+		},
+		{name: "empty", in: "", want: nil},
+		{name: "missing value", in: "code =", wantErr: true},
+		{name: "missing and", in: "code = a code = b", wantErr: true},
+		{name: "or is not supported", in: "code = a OR code = b", wantErr: true},
+		{name: "quoted and", in: `code = a "AND" code = b`, wantErr: true},
+		{name: "quoted field", in: `"code" = a`, wantErr: true},
+		{name: "unterminated quote", in: `code = "abc`, wantErr: true},
+		{name: "single bang", in: "code ! a", wantErr: true},
+		{name: "in without parenthesis", in: "status in posted", wantErr: true},
+		{name: "in without closing parenthesis", in: "status in (posted, failed", wantErr: true},
+		{name: "in with missing comma", in: "status in (posted failed)", wantErr: true},
+		{name: "too many values", in: "status in (" + strings.Repeat("a, ", maxValues) + "a)", wantErr: true},
+		{name: "too many conditions", in: strings.Repeat("code = a AND ", maxConditions) + "code = a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Parse(%q) error %v, want InvalidArgument", tt.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		name       string
+		expr       Expression
+		wantWhere  []string
+		wantParams []interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "number comparison",
+			expr:       Expression{{Field: "total_price", Op: ">=", Values: []string{"10.5"}}},
+			wantWhere:  []string{"company_id = $1", "total_price >= $2::double precision"},
+			wantParams: []interface{}{"company", "10.5"},
+		},
+		{
+			name:       "not equal",
+			expr:       Expression{{Field: "code", Op: "!=", Values: []string{"SO1"}}},
+			wantWhere:  []string{"company_id = $1", "code <> $2"},
+			wantParams: []interface{}{"company", "SO1"},
+		},
+		{
+			name:       "contains escape like characters",
+			expr:       Expression{{Field: "code", Op: "~", Values: []string{`10%_a\`}}},
+			wantWhere:  []string{"company_id = $1", "code ILIKE $2"},
+			wantParams: []interface{}{"company", `%10\%\_a\\%`},
+		},
+		{
+			name:       "enum in",
+			expr:       Expression{{Field: "status", Op: "in", Values: []string{"posted", "failed"}}},
+			wantWhere:  []string{"company_id = $1", "posting_status IN ($2, $3)"},
+			wantParams: []interface{}{"company", "posted", "failed"},
+		},
+		{
+			name:       "date and timestamp",
+			expr:       Expression{{Field: "sales_date", Op: "<", Values: []string{"2024-02-01"}}, {Field: "created_at", Op: ">", Values: []string{"2024-01-01T10:00:00Z"}}},
+			wantWhere:  []string{"company_id = $1", "sales_date < $2::timestamp", "created_at > $3::timestamp"},
+			wantParams: []interface{}{"company", "2024-02-01", "2024-01-01T10:00:00Z"},
+		},
+		{
+			name:       "expression with placeholder",
+			expr:       Expression{{Field: "product_id", Op: "=", Values: []string{"6c3c8a56-36a4-4a8e-9b0a-0a2f5a0e0d11"}}},
+			wantWhere:  []string{"company_id = $1", "EXISTS (SELECT 1 FROM sales_details WHERE sales_id = sales.id AND product_id = $2::uuid)"},
+			wantParams: []interface{}{"company", "6c3c8a56-36a4-4a8e-9b0a-0a2f5a0e0d11"},
+		},
+		{
+			name: "full text",
+			expr: Expression{{Field: "search", Op: "~", Values: []string{"PT Maju-Jaya"}}},
+			wantWhere: []string{"company_id = $1",
+				"(sales.search_vector @@ to_tsquery('simple', $2) OR $3 <% sales.search_text)"},
+			wantParams: []interface{}{"company", "pt:* & maju:* & jaya:*", "pt maju jaya"},
+		},
+		{name: "unknown field", expr: Expression{{Field: "company_id", Op: "=", Values: []string{"x"}}}, wantErr: true},
+		{name: "sort only field", expr: Expression{{Field: "customer_name", Op: "=", Values: []string{"x"}}}, wantErr: true},
+		{name: "less than on text", expr: Expression{{Field: "code", Op: "<", Values: []string{"x"}}}, wantErr: true},
+		{name: "contains on number", expr: Expression{{Field: "total_price", Op: "~", Values: []string{"1"}}}, wantErr: true},
+		{name: "equal on full text", expr: Expression{{Field: "search", Op: "=", Values: []string{"x"}}}, wantErr: true},
+		{name: "invalid number", expr: Expression{{Field: "total_price", Op: "=", Values: []string{"1; DROP TABLE sales"}}}, wantErr: true},
+		{name: "invalid id", expr: Expression{{Field: "customer_id", Op: "=", Values: []string{"abc"}}}, wantErr: true},
+		{name: "invalid date", expr: Expression{{Field: "sales_date", Op: "=", Values: []string{"01/02/2024"}}}, wantErr: true},
+		{name: "invalid timestamp", expr: Expression{{Field: "created_at", Op: "=", Values: []string{"yesterday"}}}, wantErr: true},
+		{name: "value out of enum", expr: Expression{{Field: "status", Op: "=", Values: []string{"deleted"}}}, wantErr: true},
+		{name: "empty search", expr: Expression{{Field: "search", Op: "~", Values: []string{"--"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, params, err := tt.expr.Where(testSchema, []string{"company_id = $1"}, []interface{}{"company"})
+			if tt.wantErr {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Where error %v, want InvalidArgument", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Where error %v", err)
+			}
+			if !reflect.DeepEqual(where, tt.wantWhere) {
+				t.Errorf("where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("params = %q, want %q", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantExpr string
+		wantErr  bool
+	}{
+		{name: "total_price", wantExpr: "total_price"},
+		{name: "customer_name", wantExpr: "customer_name"},
+		{name: "status", wantErr: true},
+		{name: "total_price; DROP TABLE sales", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		f, err := testSchema.Sort(tt.name)
+		if tt.wantErr {
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Sort(%q) error %v, want InvalidArgument", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || f.Expr != tt.wantExpr {
+			t.Errorf("Sort(%q) = %q, %v, want %q", tt.name, f.Expr, err, tt.wantExpr)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		q           string
+		wantTsquery string
+		wantText    string
+		wantErr     bool
+	}{
+		{q: "budi", wantTsquery: "budi:*", wantText: "budi"},
+		{q: "  PT. Sinar  Jaya ", wantTsquery: "pt:* & sinar:* & jaya:*", wantText: "pt sinar jaya"},
+		{q: "so-2024 & 'x' | !y", wantTsquery: "so:* & 2024:* & x:* & y:*", wantText: "so 2024 x y"},
+		{q: "", wantErr: true},
+		{q: "&|!:*", wantErr: true},
+		{q: strings.Repeat("a ", maxWords+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tsquery, text, err := Search(tt.q)
+		if tt.wantErr {
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Search(%q) error %v, want InvalidArgument", tt.q, err)
+			}
+			continue
+		}
+		if err != nil || tsquery != tt.wantTsquery || text != tt.wantText {
+			t.Errorf("Search(%q) = %q, %q, %v, want %q, %q", tt.q, tsquery, text, err, tt.wantTsquery, tt.wantText)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/sales-service/internal/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Gateway serve the sales, sales return, customer and salesman services as http/json.
+// Requests are sent to Server through an in-process connection, so they pass the same
+// logging, metrics and permission interceptors as the grpc clients.
+type Gateway struct {
+	// Server must have the services registered, see Registrars
+	Server *grpc.Server
+	// Origins allowed to call from a browser, * for any, none when empty
+	Origins []string
+
+	lis  *bufconn.Listener
+	conn *grpc.ClientConn
+	http *http.Server
+	mux  *http.ServeMux
+}
+
+// New create the in-process grpc server of the gateway with opt, usually the interceptors of the public server.
+// dialOptions are added to the in-process connection, for example the tracing ones.
+func New(opt []grpc.ServerOption, dialOptions ...grpc.DialOption) (*Gateway, error) {
+	g := &Gateway{
+		Server: grpc.NewServer(opt...),
+		lis:    bufconn.Listen(1 << 20),
+	}
+
+	conn, err := grpc.NewClient("passthrough:///gateway", append(dialOptions,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return g.lis.DialContext(ctx)
+		}),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	g.conn = conn
+
+	g.mux = http.NewServeMux()
+	g.mux.HandleFunc("/openapi.json", g.openAPI)
+	g.mux.HandleFunc("/v1/", g.call)
+
+	return g, nil
+}
+
+// ListenAndServe serve http on addr, https when config is not nil. It return http.ErrServerClosed after Shutdown.
+func (g *Gateway) ListenAndServe(addr string, config *tls.Config) error {
+	go g.Server.Serve(g.lis)
+
+	g.http = &http.Server{Addr: addr, Handler: g, TLSConfig: config, ReadHeaderTimeout: 5 * time.Second}
+	if config != nil {
+		return g.http.ListenAndServeTLS("", "")
+	}
+	return g.http.ListenAndServe()
+}
+
+// Shutdown stop accepting http requests, wait the in-flight ones until ctx is done, then stop the in-process server
+func (g *Gateway) Shutdown(ctx context.Context) {
+	if g == nil {
+		return
+	}
+
+	if g.http != nil {
+		if err := g.http.Shutdown(ctx); err != nil {
+			g.http.Close()
+		}
+	}
+	g.conn.Close()
+	g.Server.Stop()
+}
+
+// ServeHTTP answer the cors preflight of allowed origins, then route the request
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); len(origin) > 0 && g.allowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id, Version, ETag, Page-Token, Tax-Id")
+		w.Header().Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key, If-Match, X-Request-Id, Page-Token, Page-Mode, Total-Count, Filter, Tax-Id, Traceparent, Tracestate")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	g.mux.ServeHTTP(w, r)
+}
+
+func (g *Gateway) allowed(origin string) bool {
+	for _, o := range g.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// outgoing turn the http headers of the caller into the grpc metadata read by the services:
+// Authorization: Bearer <token> (or Token) become token, If-Match become version,
+// Idempotency-Key and X-Request-Id are kept, the trace context continue the one of the caller.
+// The paging and filter of lists and the customer tax id are read from the Page-Token, Page-Mode, Total-Count, Filter and Tax-Id headers
+// or the query of the same name in snake case.
+func outgoing(r *http.Request) context.Context {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	md := metadata.MD{}
+	token := r.Header.Get("Token")
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		token = strings.TrimSpace(auth[7:])
+	}
+	if len(token) > 0 {
+		md.Set("token", token)
+	}
+	if version := strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`); len(version) > 0 {
+		md.Set("version", version)
+	}
+	if key := r.Header.Get("Idempotency-Key"); len(key) > 0 {
+		md.Set("idempotency-key", key)
+	}
+	if id := r.Header.Get(logging.RequestIDHeader); len(id) > 0 {
+		md.Set(logging.RequestIDHeader, id)
+	}
+	for header, query := range metadataParams {
+		if value := r.Header.Get(header); len(value) > 0 {
+			md.Set(header, value)
+		}
+		if value := r.URL.Query().Get(query); len(value) > 0 {
+			md.Set(header, value)
+		}
+	}
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// Registrars register a service on every server, the public grpc server and the one of the gateway
+type Registrars []grpc.ServiceRegistrar
+
+func (rs Registrars) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	for _, r := range rs {
+		if r != nil {
+			r.RegisterService(desc, impl)
+		}
+	}
+}
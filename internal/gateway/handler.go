@@ -0,0 +1,388 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxBody is the largest json request body
+const maxBody = 4 << 20
+
+// metadataParams are the query of the metadata read by the services (paging and filter of lists, tax id of customer), by metadata name
+var metadataParams = map[string]string{"page-token": "page_token", "page-mode": "page_mode", "total-count": "total_count", "filter": "filter", "tax-id": "tax_id"}
+
+func metadataQuery(key string) bool {
+	for _, query := range metadataParams {
+		if query == key {
+			return true
+		}
+	}
+	return false
+}
+
+// paginationFields can be given in the query without the pagination. prefix
+var paginationFields = map[string]bool{"limit": true, "offset": true, "search": true, "order_by": true, "sort": true}
+
+var (
+	unmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+	marshal   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+)
+
+func (g *Gateway) call(w http.ResponseWriter, r *http.Request) {
+	rt, params, allowed := match(r.Method, r.URL.Path)
+	if rt == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeError(w, http.StatusMethodNotAllowed, status.New(codes.Unimplemented, "method not allowed"))
+			return
+		}
+		writeError(w, http.StatusNotFound, status.New(codes.NotFound, "no route for "+r.URL.Path))
+		return
+	}
+
+	in := rt.In()
+	if err := decode(r, in, params); err != nil {
+		writeError(w, http.StatusBadRequest, status.New(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	ctx := outgoing(r)
+	if rt.Stream {
+		g.stream(ctx, w, r, rt, in)
+		return
+	}
+
+	var header metadata.MD
+	out := rt.Out()
+	if err := g.conn.Invoke(ctx, rt.RPC, in, out, grpc.Header(&header)); err != nil {
+		writeHeader(w, header)
+		st := status.Convert(err)
+		writeError(w, HTTPStatus(st.Code()), st)
+		return
+	}
+
+	writeHeader(w, header)
+	body, err := marshal.Marshal(out)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, status.New(codes.Internal, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// stream answer a server streaming rpc as one json page, {"pagination": {...}, "items": [...], "next_page_token": "..."},
+// or as ndjson with one response per line when the caller accept application/x-ndjson or ask ?format=ndjson,
+// the next page token is then the Page-Token trailer
+func (g *Gateway) stream(ctx context.Context, w http.ResponseWriter, r *http.Request, rt *route, in proto.Message) {
+	s, err := g.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, rt.RPC)
+	if err == nil {
+		err = s.SendMsg(in)
+	}
+	if err == nil {
+		err = s.CloseSend()
+	}
+	if err != nil {
+		st := status.Convert(err)
+		writeError(w, HTTPStatus(st.Code()), st)
+		return
+	}
+
+	ndjson := r.URL.Query().Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+
+	page := struct {
+		Pagination    json.RawMessage   `json:"pagination,omitempty"`
+		Items         []json.RawMessage `json:"items"`
+		NextPageToken string            `json:"next_page_token,omitempty"`
+	}{Items: []json.RawMessage{}}
+
+	started := false
+	for {
+		out := rt.Out()
+		err := s.RecvMsg(out)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			st := status.Convert(err)
+			if started {
+				// the status is already sent, the error is the last line
+				line, _ := json.Marshal(map[string]interface{}{"error": errorBody(st)})
+				w.Write(append(line, '\n'))
+				return
+			}
+			if header, hErr := s.Header(); hErr == nil {
+				writeHeader(w, header)
+			}
+			writeError(w, HTTPStatus(st.Code()), st)
+			return
+		}
+
+		if ndjson {
+			if !started {
+				if header, hErr := s.Header(); hErr == nil {
+					writeHeader(w, header)
+				}
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Header().Set("Trailer", "Page-Token")
+				started = true
+			}
+			line, err := marshal.Marshal(out)
+			if err != nil {
+				return
+			}
+			w.Write(append(line, '\n'))
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			continue
+		}
+
+		pagination, item, err := split(out)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, status.New(codes.Internal, err.Error()))
+			return
+		}
+		if page.Pagination == nil {
+			page.Pagination = pagination
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	next := s.Trailer().Get("page-token")
+	if ndjson {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		if len(next) > 0 {
+			w.Header().Set("Page-Token", next[0])
+		}
+		return
+	}
+	if len(next) > 0 {
+		page.NextPageToken = next[0]
+	}
+
+	if header, err := s.Header(); err == nil {
+		writeHeader(w, header)
+	}
+	body, err := json.Marshal(page)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, status.New(codes.Internal, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// split a list response into its pagination and its item, the other message field
+func split(m proto.Message) (pagination, item json.RawMessage, err error) {
+	msg := m.ProtoReflect()
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			continue
+		}
+
+		data, err := marshal.Marshal(msg.Get(fd).Message().Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+		if fd.Name() == "pagination" {
+			pagination = data
+		} else if item == nil {
+			item = data
+		}
+	}
+
+	if item == nil {
+		// not a pagination and item pair, keep the whole response
+		data, err := marshal.Marshal(m)
+		return pagination, data, err
+	}
+	return pagination, item, nil
+}
+
+// decode fill in from the json body, the query string then the path parameters
+func decode(r *http.Request, in proto.Message, params map[string]string) error {
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBody))
+		if err != nil {
+			return fmt.Errorf("read body: %v", err)
+		}
+		if len(body) > 0 {
+			if err := unmarshal.Unmarshal(body, in); err != nil {
+				return fmt.Errorf("invalid json body: %v", err)
+			}
+		}
+	}
+
+	msg := in.ProtoReflect()
+	for key, values := range r.URL.Query() {
+		if key == "format" || metadataQuery(key) {
+			continue
+		}
+		path := strings.Split(key, ".")
+		if len(path) == 1 && paginationFields[key] && msg.Descriptor().Fields().ByName(protoreflect.Name(key)) == nil {
+			path = []string{"pagination", key}
+		}
+		for _, value := range values {
+			if err := setField(msg, path, value); err != nil {
+				return fmt.Errorf("query %s: %v", key, err)
+			}
+		}
+	}
+
+	for name, value := range params {
+		if err := setField(msg, []string{name}, value); err != nil {
+			return fmt.Errorf("path %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// setField set the field of msg at path, a field name or its json name per level, from its text value
+func setField(msg protoreflect.Message, path []string, value string) error {
+	fields := msg.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(path[0]))
+	if fd == nil {
+		fd = fields.ByJSONName(path[0])
+	}
+	if fd == nil {
+		return fmt.Errorf("unknown field %s", path[0])
+	}
+
+	if len(path) > 1 {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("%s is not a message", path[0])
+		}
+		return setField(msg.Mutable(fd).Message(), path[1:], value)
+	}
+
+	if fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		return fmt.Errorf("%s can not be set from text", path[0])
+	}
+
+	v, err := scalar(fd, value)
+	if err != nil {
+		return err
+	}
+	if fd.IsList() {
+		msg.Mutable(fd).List().Append(v)
+		return nil
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+func scalar(fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(strings.ToUpper(value))); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid %s %q", fd.Enum().Name(), value)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(value)), nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported type %s", fd.Kind())
+}
+
+// writeHeader copy the response metadata of the rpc, x-request-id and version, to the http headers.
+// version is also the ETag, to send back as If-Match on update.
+func writeHeader(w http.ResponseWriter, header metadata.MD) {
+	for _, key := range []string{"x-request-id", "version", "tax-id"} {
+		if values := header.Get(key); len(values) > 0 {
+			w.Header().Set(key, values[0])
+		}
+	}
+	if values := header.Get("version"); len(values) > 0 {
+		w.Header().Set("ETag", `"`+values[0]+`"`)
+	}
+}
+
+func errorBody(st *status.Status) map[string]interface{} {
+	return map[string]interface{}{
+		"code":    int(st.Code()),
+		"status":  st.Code().String(),
+		"message": st.Message(),
+	}
+}
+
+func writeError(w http.ResponseWriter, httpStatus int, st *status.Status) {
+	body, _ := json.Marshal(errorBody(st))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	w.Write(body)
+}
+
+// HTTPStatus map a grpc code to its http status, as grpc-gateway does
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,270 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+)
+
+// openAPI serve the OpenAPI 3 document of the routes, built from the protobuf descriptors of their messages
+func (g *Gateway) openAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIDoc, _ = json.Marshal(document())
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc)
+}
+
+type object = map[string]interface{}
+
+func document() object {
+	schemas := object{
+		"Error": object{
+			"type": "object",
+			"properties": object{
+				"code":    object{"type": "integer", "description": "grpc status code"},
+				"status":  object{"type": "string", "description": "grpc status name"},
+				"message": object{"type": "string"},
+			},
+		},
+	}
+
+	paths := object{}
+	for _, rt := range routes {
+		in := rt.In().ProtoReflect().Descriptor()
+		out := rt.Out().ProtoReflect().Descriptor()
+		addSchema(schemas, in)
+		addSchema(schemas, out)
+
+		service, method := splitRPC(rt.RPC)
+		op := object{
+			"operationId": strings.TrimPrefix(service, "sales.") + "_" + method,
+			"tags":        []string{strings.TrimPrefix(service, "sales.")},
+			"summary":     rt.RPC,
+			"parameters":  parameters(rt, in),
+			"responses": object{
+				"200":     response(rt, out),
+				"default": object{"description": "error", "content": jsonContent(ref("Error"))},
+			},
+		}
+		if rt.Method == http.MethodPost || rt.Method == http.MethodPut {
+			op["requestBody"] = object{"required": true, "content": jsonContent(ref(string(in.FullName())))}
+		}
+
+		item, ok := paths[rt.Path].(object)
+		if !ok {
+			item = object{}
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "Sales Service",
+			"version": version(),
+		},
+		"paths":    paths,
+		"security": []object{{"bearer": []string{}}},
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"bearer": object{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func parameters(rt route, in protoreflect.MessageDescriptor) []object {
+	params := []object{
+		{"name": "Idempotency-Key", "in": "header", "schema": object{"type": "string", "maxLength": 100}},
+		{"name": "X-Request-Id", "in": "header", "schema": object{"type": "string"}},
+	}
+	if rt.Method == http.MethodPut {
+		params = append(params, object{"name": "If-Match", "in": "header", "schema": object{"type": "string"},
+			"description": "version of the document, the update is aborted when it changed"})
+	}
+
+	for _, part := range strings.Split(rt.Path, "/") {
+		if strings.HasPrefix(part, "{") {
+			params = append(params, object{"name": part[1 : len(part)-1], "in": "path", "required": true, "schema": object{"type": "string"}})
+		}
+	}
+
+	if rt.Method != http.MethodGet || !rt.Stream {
+		return params
+	}
+
+	fields := in.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Kind() == protoreflect.MessageKind && fd.Name() == "pagination" && !fd.IsList() {
+			sub := fd.Message().Fields()
+			for j := 0; j < sub.Len(); j++ {
+				if paginationFields[string(sub.Get(j).Name())] {
+					params = append(params, object{"name": string(sub.Get(j).Name()), "in": "query", "schema": fieldSchema(sub.Get(j))})
+				}
+			}
+			continue
+		}
+		if fd.Kind() == protoreflect.MessageKind || fd.IsMap() {
+			continue
+		}
+		params = append(params, object{"name": string(fd.Name()), "in": "query", "schema": fieldSchema(fd)})
+	}
+	params = append(params,
+		object{"name": "format", "in": "query", "schema": object{"type": "string", "enum": []string{"json", "ndjson"}}},
+		object{"name": "page_mode", "in": "query", "schema": object{"type": "string", "enum": []string{"offset", "keyset"}}},
+		object{"name": "page_token", "in": "query", "schema": object{"type": "string"}, "description": "next_page_token of the previous page, keyset mode"},
+		object{"name": "total_count", "in": "query", "schema": object{"type": "boolean"}, "description": "compute the count of the pagination, default true in offset mode only"},
+	)
+	if strings.HasPrefix(rt.RPC, "/sales.SalesService/") || strings.HasPrefix(rt.RPC, "/sales.SalesReturnService/") {
+		params = append(params, object{"name": "filter", "in": "query", "schema": object{"type": "string"},
+			"description": "filter expression, e.g. sales_date >= 2024-01-01 AND total_price > 1000"})
+	}
+
+	return params
+}
+
+func response(rt route, out protoreflect.MessageDescriptor) object {
+	if !rt.Stream {
+		return object{"description": "OK", "content": jsonContent(ref(string(out.FullName())))}
+	}
+
+	page := object{"type": "object", "properties": object{
+		"items":           object{"type": "array", "items": ref(string(out.FullName()))},
+		"next_page_token": object{"type": "string", "description": "token of the next page in keyset mode, absent on the last page"},
+	}}
+	fields := out.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			continue
+		}
+		if fd.Name() == "pagination" {
+			page["properties"].(object)["pagination"] = ref(string(fd.Message().FullName()))
+		} else {
+			page["properties"].(object)["items"] = object{"type": "array", "items": ref(string(fd.Message().FullName()))}
+			break
+		}
+	}
+
+	return object{
+		"description": "one page, or one response per line with format=ndjson",
+		"content": object{
+			"application/json":     object{"schema": page},
+			"application/x-ndjson": object{"schema": ref(string(out.FullName()))},
+		},
+	}
+}
+
+// addSchema add the schema of md and of the messages it use
+func addSchema(schemas object, md protoreflect.MessageDescriptor) {
+	name := string(md.FullName())
+	if _, ok := schemas[name]; ok {
+		return
+	}
+
+	properties := object{}
+	schemas[name] = object{"type": "object", "properties": properties}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		properties[string(fd.Name())] = fieldSchema(fd)
+
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		if fd.Kind() == protoreflect.MessageKind && !wellKnown(fd.Message()) {
+			addSchema(schemas, fd.Message())
+		}
+	}
+}
+
+func fieldSchema(fd protoreflect.FieldDescriptor) object {
+	if fd.IsMap() {
+		return object{"type": "object", "additionalProperties": kindSchema(fd.MapValue())}
+	}
+	if fd.IsList() {
+		return object{"type": "array", "items": kindSchema(fd)}
+	}
+	return kindSchema(fd)
+}
+
+// kindSchema is the schema of one value of fd, as protojson write it
+func kindSchema(fd protoreflect.FieldDescriptor) object {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return object{"type": "boolean"}
+	case protoreflect.StringKind:
+		return object{"type": "string"}
+	case protoreflect.BytesKind:
+		return object{"type": "string", "format": "byte"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return object{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return object{"type": "integer", "format": "int64", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return object{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind:
+		return object{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return object{"type": "number", "format": "double"}
+	case protoreflect.EnumKind:
+		var names []string
+		values := fd.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			names = append(names, string(values.Get(i).Name()))
+		}
+		return object{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		switch fd.Message().FullName() {
+		case "google.protobuf.Timestamp":
+			return object{"type": "string", "format": "date-time"}
+		case "google.protobuf.Duration":
+			return object{"type": "string"}
+		}
+		if wellKnown(fd.Message()) {
+			return object{}
+		}
+		return ref(string(fd.Message().FullName()))
+	}
+	return object{}
+}
+
+func wellKnown(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile().Package() == "google.protobuf"
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+func splitRPC(rpc string) (service, method string) {
+	parts := strings.Split(strings.TrimPrefix(rpc, "/"), "/")
+	return parts[0], parts[1]
+}
+
+func version() string {
+	if v := os.Getenv("SERVICE_VERSION"); len(v) > 0 {
+		return v
+	}
+	return "1"
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"google.golang.org/protobuf/proto"
+)
+
+// route map an http method and path to a grpc method, {id} in the path is copied to the id field of the request
+type route struct {
+	Method string
+	Path   string
+	// RPC is the full grpc method, /package.Service/Method
+	RPC string
+	// Stream is a server streaming rpc, answered as paged json or ndjson
+	Stream bool
+	In     func() proto.Message
+	Out    func() proto.Message
+}
+
+var routes = []route{
+	{http.MethodPost, "/v1/sales", "/sales.SalesService/Create", false,
+		func() proto.Message { return &sales.Sales{} }, func() proto.Message { return &sales.Sales{} }},
+	{http.MethodPut, "/v1/sales/{id}", "/sales.SalesService/Update", false,
+		func() proto.Message { return &sales.Sales{} }, func() proto.Message { return &sales.Sales{} }},
+	{http.MethodGet, "/v1/sales/{id}", "/sales.SalesService/View", false,
+		func() proto.Message { return &sales.Id{} }, func() proto.Message { return &sales.Sales{} }},
+	{http.MethodGet, "/v1/sales", "/sales.SalesService/List", true,
+		func() proto.Message { return &sales.ListSalesRequest{} }, func() proto.Message { return &sales.ListSalesResponse{} }},
+
+	{http.MethodPost, "/v1/sales-returns", "/sales.SalesReturnService/Create", false,
+		func() proto.Message { return &sales.SalesReturn{} }, func() proto.Message { return &sales.SalesReturn{} }},
+	{http.MethodPut, "/v1/sales-returns/{id}", "/sales.SalesReturnService/Update", false,
+		func() proto.Message { return &sales.SalesReturn{} }, func() proto.Message { return &sales.SalesReturn{} }},
+	{http.MethodGet, "/v1/sales-returns/{id}", "/sales.SalesReturnService/View", false,
+		func() proto.Message { return &sales.Id{} }, func() proto.Message { return &sales.SalesReturn{} }},
+	{http.MethodGet, "/v1/sales-returns", "/sales.SalesReturnService/List", true,
+		func() proto.Message { return &sales.ListSalesReturnRequest{} }, func() proto.Message { return &sales.ListSalesReturnResponse{} }},
+
+	{http.MethodPost, "/v1/customers", "/sales.CustomerService/CustomerCreate", false,
+		func() proto.Message { return &sales.Customer{} }, func() proto.Message { return &sales.Customer{} }},
+	{http.MethodPut, "/v1/customers/{id}", "/sales.CustomerService/CustomerUpdate", false,
+		func() proto.Message { return &sales.Customer{} }, func() proto.Message { return &sales.Customer{} }},
+	{http.MethodGet, "/v1/customers/{id}", "/sales.CustomerService/CustomerView", false,
+		func() proto.Message { return &sales.Id{} }, func() proto.Message { return &sales.Customer{} }},
+	{http.MethodDelete, "/v1/customers/{id}", "/sales.CustomerService/CustomerDelete", false,
+		func() proto.Message { return &sales.Id{} }, func() proto.Message { return &sales.MyBoolean{} }},
+	{http.MethodGet, "/v1/customers", "/sales.CustomerService/CustomerList", true,
+		func() proto.Message { return &sales.ListCustomerRequest{} }, func() proto.Message { return &sales.ListCustomerResponse{} }},
+
+	{http.MethodPost, "/v1/salesmen", "/sales.SalesmanService/SalesmanCreate", false,
+		func() proto.Message { return &sales.Salesman{} }, func() proto.Message { return &sales.Salesman{} }},
+	{http.MethodPut, "/v1/salesmen/{id}", "/sales.SalesmanService/SalesmanUpdate", false,
+		func() proto.Message { return &sales.Salesman{} }, func() proto.Message { return &sales.Salesman{} }},
+	{http.MethodGet, "/v1/salesmen/{id}", "/sales.SalesmanService/SalesmanView", false,
+		func() proto.Message { return &sales.Id{} }, func() proto.Message { return &sales.Salesman{} }},
+	{http.MethodDelete, "/v1/salesmen/{id}", "/sales.SalesmanService/SalesmanDelete", false,
+		func() proto.Message { return &sales.Id{} }, func() proto.Message { return &sales.MyBoolean{} }},
+	{http.MethodGet, "/v1/salesmen", "/sales.SalesmanService/SalesmanList", true,
+		func() proto.Message { return &sales.ListSalesmanRequest{} }, func() proto.Message { return &sales.ListSalesmanResponse{} }},
+}
+
+// match return the route of method and path with the path parameters, allowed is set when only the method differ
+func match(method, path string) (r *route, params map[string]string, allowed []string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range routes {
+		p, ok := matchPath(routes[i].Path, segments)
+		if !ok {
+			continue
+		}
+		if routes[i].Method != method {
+			allowed = append(allowed, routes[i].Method)
+			continue
+		}
+		return &routes[i], p, nil
+	}
+	return nil, nil, allowed
+}
+
+func matchPath(pattern string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if len(segments[i]) == 0 {
+				return nil, false
+			}
+			params[part[1:len(part)-1]] = segments[i]
+			continue
+		}
+		if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Postgres is the health service name of the database, the other names are the downstream services
+const Postgres = "postgres"
+
+// Checker report the readiness of postgres and of each downstream service to the grpc health service.
+// The empty service name, used by load balancers and kubernetes probes, follow postgres only:
+// order entry can run with downstream services degraded.
+type Checker struct {
+	Db       *sql.DB
+	Conns    map[string]*grpc.ClientConn
+	Server   *grpchealth.Server
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+func NewChecker(db *sql.DB, conns map[string]*grpc.ClientConn) *Checker {
+	return &Checker{
+		Db:       db,
+		Conns:    conns,
+		Server:   grpchealth.NewServer(),
+		Interval: 10 * time.Second,
+		Timeout:  2 * time.Second,
+	}
+}
+
+// Run check every Interval until ctx is done
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) Check(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+	err := c.Db.PingContext(pingCtx)
+	cancel()
+
+	database := servingStatus(err == nil)
+	c.Server.SetServingStatus(Postgres, database)
+	c.Server.SetServingStatus("", database)
+
+	for name, conn := range c.Conns {
+		state := conn.GetState()
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+		c.Server.SetServingStatus(name, servingStatus(state == connectivity.Ready || state == connectivity.Idle))
+	}
+}
+
+// Shutdown report every service not serving, so no new request is routed here while in-flight ones drain
+func (c *Checker) Shutdown() {
+	c.Server.Shutdown()
+}
+
+func servingStatus(ok bool) healthpb.HealthCheckResponse_ServingStatus {
+	if ok {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
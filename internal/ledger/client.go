@@ -0,0 +1,66 @@
+package ledger
+
+import (
+	"context"
+
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultJournalMethod is the ledger service rpc creating a journal
+const DefaultJournalMethod = "/ledgers.JournalService/JournalCreate"
+
+type JournalLine struct {
+	AccountCode string  `json:"account_code"`
+	Debit       float64 `json:"debit"`
+	Credit      float64 `json:"credit"`
+	Memo        string  `json:"memo"`
+}
+
+type Journal struct {
+	// IdempotencyKey is the same on every retry of a posting so the ledger create the journal once
+	IdempotencyKey  string        `json:"idempotency_key"`
+	CompanyId       string        `json:"company_id"`
+	BranchId        string        `json:"branch_id"`
+	TransactionDate string        `json:"transaction_date"`
+	Reference       string        `json:"reference"`
+	Source          string        `json:"source"`
+	Lines           []JournalLine `json:"lines"`
+}
+
+type JournalResponse struct {
+	Id string `json:"id"`
+}
+
+// Client post journal to the general ledger
+type Client interface {
+	PostJournal(ctx context.Context, in *Journal) (string, error)
+}
+
+// GrpcClient call the ledger service with the json codec
+type GrpcClient struct {
+	Conn   *grpc.ClientConn
+	Method string
+	// Token authenticate the posting worker, it runs outside of any user request
+	Token string
+}
+
+func NewClient(conn *grpc.ClientConn, token string) *GrpcClient {
+	return &GrpcClient{Conn: conn, Method: DefaultJournalMethod, Token: token}
+}
+
+func (c *GrpcClient) PostJournal(ctx context.Context, in *Journal) (string, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "idempotency-key", in.IdempotencyKey)
+	if len(c.Token) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, "token", c.Token)
+	}
+
+	var out JournalResponse
+	err := c.Conn.Invoke(ctx, c.Method, in, &out, grpc.CallContentSubtype(rpc.CodecName))
+	if err != nil {
+		return "", err
+	}
+
+	return out.Id, nil
+}
@@ -0,0 +1,118 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+)
+
+// account roles mapped to account codes per company
+const (
+	RoleRevenue       = "revenue"
+	RoleReceivable    = "receivable"
+	RoleSalesDiscount = "sales_discount"
+	RoleSalesReturn   = "sales_return"
+	RoleTaxPayable    = "tax_payable"
+)
+
+// Line is a journal line with the account role, the account code is resolved when posting
+type Line struct {
+	Role   string  `json:"role"`
+	Debit  float64 `json:"debit"`
+	Credit float64 `json:"credit"`
+	Memo   string  `json:"memo"`
+}
+
+// Accounts map each role to the account code of the company ledger
+type Accounts map[string]string
+
+// SalesEntry debit receivable and discount, credit gross revenue.
+// Sales have no tax yet, tax payable is mapped but not posted.
+func SalesEntry(in *sales.Sales) []Line {
+	var gross float64
+	for _, detail := range in.GetDetails() {
+		gross += detail.GetPrice() * float64(detail.GetQuantity())
+	}
+
+	total := round(in.GetTotalPrice())
+	gross = round(gross)
+	memo := "Sales " + in.GetCode()
+
+	return compact([]Line{
+		{Role: RoleReceivable, Debit: total, Memo: memo},
+		{Role: RoleSalesDiscount, Debit: round(gross - total), Memo: memo},
+		{Role: RoleRevenue, Credit: gross, Memo: memo},
+	})
+}
+
+// SalesReturnEntry debit gross sales return, credit discount given back and receivable
+func SalesReturnEntry(in *sales.SalesReturn) []Line {
+	var gross float64
+	for _, detail := range in.GetDetails() {
+		gross += detail.GetPrice() * float64(detail.GetQuantity())
+	}
+
+	total := round(in.GetTotalPrice())
+	gross = round(gross)
+	memo := "Sales return " + in.GetCode()
+
+	return compact([]Line{
+		{Role: RoleSalesReturn, Debit: gross, Memo: memo},
+		{Role: RoleSalesDiscount, Credit: round(gross - total), Memo: memo},
+		{Role: RoleReceivable, Credit: total, Memo: memo},
+	})
+}
+
+// Reverse swap debit and credit, used to cancel the previous posting of an updated document
+func Reverse(lines []Line) []Line {
+	reversed := make([]Line, len(lines))
+	for i, l := range lines {
+		reversed[i] = Line{Role: l.Role, Debit: l.Credit, Credit: l.Debit, Memo: "Reverse " + l.Memo}
+	}
+	return reversed
+}
+
+// Resolve turn roles into account codes and check the entry is balanced
+func Resolve(lines []Line, accounts Accounts) ([]JournalLine, error) {
+	var debit, credit float64
+	var journalLines []JournalLine
+	for _, l := range lines {
+		code := accounts[l.Role]
+		if len(code) == 0 {
+			return nil, fmt.Errorf("account of %s is not mapped", l.Role)
+		}
+
+		debit += l.Debit
+		credit += l.Credit
+		journalLines = append(journalLines, JournalLine{AccountCode: code, Debit: l.Debit, Credit: l.Credit, Memo: l.Memo})
+	}
+
+	if math.Abs(debit-credit) >= 0.005 {
+		return nil, fmt.Errorf("unbalanced journal, debit %.2f credit %.2f", debit, credit)
+	}
+
+	return journalLines, nil
+}
+
+// compact drop zero lines and move negative amounts to the other side
+func compact(lines []Line) []Line {
+	var result []Line
+	for _, l := range lines {
+		if l.Debit < 0 {
+			l.Debit, l.Credit = 0, l.Credit-l.Debit
+		}
+		if l.Credit < 0 {
+			l.Debit, l.Credit = l.Debit-l.Credit, 0
+		}
+		if l.Debit == 0 && l.Credit == 0 {
+			continue
+		}
+		result = append(result, l)
+	}
+	return result
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,268 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+)
+
+var testAccounts = Accounts{
+	RoleRevenue:       "4100",
+	RoleReceivable:    "1200",
+	RoleSalesDiscount: "4200",
+	RoleSalesReturn:   "4300",
+	RoleTaxPayable:    "2100",
+}
+
+func TestSalesEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *sales.Sales
+		want []Line
+	}{
+		{
+			name: "without discount",
+			in: &sales.Sales{Code: "SO1", TotalPrice: 250, Details: []*sales.SalesDetail{
+				{Price: 100, Quantity: 2, TotalPrice: 200},
+				{Price: 50, Quantity: 1, TotalPrice: 50},
+			}},
+			want: []Line{
+				{Role: RoleReceivable, Debit: 250, Memo: "Sales SO1"},
+				{Role: RoleRevenue, Credit: 250, Memo: "Sales SO1"},
+			},
+		},
+		{
+			name: "line discount",
+			in: &sales.Sales{Code: "SO2", TotalPrice: 180, Details: []*sales.SalesDetail{
+				{Price: 100, DiscPercentage: 10, DiscAmount: 10, Quantity: 2, TotalPrice: 180},
+			}},
+			want: []Line{
+				{Role: RoleReceivable, Debit: 180, Memo: "Sales SO2"},
+				{Role: RoleSalesDiscount, Debit: 20, Memo: "Sales SO2"},
+				{Role: RoleRevenue, Credit: 200, Memo: "Sales SO2"},
+			},
+		},
+		{
+			name: "line and additional discount",
+			in: &sales.Sales{Code: "SO3", AdditionalDiscAmount: 17.5, TotalPrice: 157.5, Details: []*sales.SalesDetail{
+				{Price: 100, DiscAmount: 10, Quantity: 2, TotalPrice: 180},
+				{Price: 0.1, Quantity: 3, TotalPrice: 0.3},
+			}},
+			want: []Line{
+				{Role: RoleReceivable, Debit: 157.5, Memo: "Sales SO3"},
+				{Role: RoleSalesDiscount, Debit: 42.8, Memo: "Sales SO3"},
+				{Role: RoleRevenue, Credit: 200.3, Memo: "Sales SO3"},
+			},
+		},
+		{
+			name: "fully discounted",
+			in: &sales.Sales{Code: "SO4", AdditionalDiscAmount: 100, TotalPrice: 0, Details: []*sales.SalesDetail{
+				{Price: 100, Quantity: 1, TotalPrice: 100},
+			}},
+			want: []Line{
+				{Role: RoleSalesDiscount, Debit: 100, Memo: "Sales SO4"},
+				{Role: RoleRevenue, Credit: 100, Memo: "Sales SO4"},
+			},
+		},
+		{
+			name: "without lines",
+			in:   &sales.Sales{Code: "SO5"},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SalesEntry(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SalesEntry = %+v, want %+v", got, tt.want)
+			}
+			if _, err := Resolve(got, testAccounts); err != nil {
+				t.Errorf("Resolve error %v", err)
+			}
+		})
+	}
+}
+
+func TestSalesReturnEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *sales.SalesReturn
+		want []Line
+	}{
+		{
+			name: "without discount",
+			in: &sales.SalesReturn{Code: "SR1", TotalPrice: 100, Details: []*sales.SalesReturnDetail{
+				{Price: 50, Quantity: 2, TotalPrice: 100},
+			}},
+			want: []Line{
+				{Role: RoleSalesReturn, Debit: 100, Memo: "Sales return SR1"},
+				{Role: RoleReceivable, Credit: 100, Memo: "Sales return SR1"},
+			},
+		},
+		{
+			name: "line and additional discount given back",
+			in: &sales.SalesReturn{Code: "SR2", AdditionalDiscAmount: 9, TotalPrice: 81, Details: []*sales.SalesReturnDetail{
+				{Price: 50, DiscAmount: 5, Quantity: 2, TotalPrice: 90},
+			}},
+			want: []Line{
+				{Role: RoleSalesReturn, Debit: 100, Memo: "Sales return SR2"},
+				{Role: RoleSalesDiscount, Credit: 19, Memo: "Sales return SR2"},
+				{Role: RoleReceivable, Credit: 81, Memo: "Sales return SR2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SalesReturnEntry(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SalesReturnEntry = %+v, want %+v", got, tt.want)
+			}
+			if _, err := Resolve(got, testAccounts); err != nil {
+				t.Errorf("Resolve error %v", err)
+			}
+		})
+	}
+}
+
+func TestReverse(t *testing.T) {
+	lines := []Line{
+		{Role: RoleReceivable, Debit: 180, Memo: "Sales SO1"},
+		{Role: RoleSalesDiscount, Debit: 20, Memo: "Sales SO1"},
+		{Role: RoleRevenue, Credit: 200, Memo: "Sales SO1"},
+	}
+	want := []Line{
+		{Role: RoleReceivable, Credit: 180, Memo: "Reverse Sales SO1"},
+		{Role: RoleSalesDiscount, Credit: 20, Memo: "Reverse Sales SO1"},
+		{Role: RoleRevenue, Debit: 200, Memo: "Reverse Sales SO1"},
+	}
+
+	if got := Reverse(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("Reverse = %+v, want %+v", got, want)
+	}
+	if lines[0].Debit != 180 {
+		t.Errorf("Reverse changed its input: %+v", lines[0])
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []Line
+		accounts Accounts
+		want     []JournalLine
+		wantErr  bool
+	}{
+		{
+			name: "balanced",
+			lines: []Line{
+				{Role: RoleReceivable, Debit: 100, Memo: "m"},
+				{Role: RoleRevenue, Credit: 100, Memo: "m"},
+			},
+			accounts: testAccounts,
+			want: []JournalLine{
+				{AccountCode: "1200", Debit: 100, Memo: "m"},
+				{AccountCode: "4100", Credit: 100, Memo: "m"},
+			},
+		},
+		{
+			name: "rounding below a cent is balanced",
+			lines: []Line{
+				{Role: RoleReceivable, Debit: 0.1, Memo: "m"},
+				{Role: RoleReceivable, Debit: 0.2, Memo: "m"},
+				{Role: RoleRevenue, Credit: 0.3, Memo: "m"},
+			},
+			accounts: testAccounts,
+			want: []JournalLine{
+				{AccountCode: "1200", Debit: 0.1, Memo: "m"},
+				{AccountCode: "1200", Debit: 0.2, Memo: "m"},
+				{AccountCode: "4100", Credit: 0.3, Memo: "m"},
+			},
+		},
+		{
+			name: "unbalanced",
+			lines: []Line{
+				{Role: RoleReceivable, Debit: 100, Memo: "m"},
+				{Role: RoleRevenue, Credit: 99.99, Memo: "m"},
+			},
+			accounts: testAccounts,
+			wantErr:  true,
+		},
+		{
+			name: "unmapped role",
+			lines: []Line{
+				{Role: RoleReceivable, Debit: 100, Memo: "m"},
+				{Role: RoleSalesDiscount, Debit: 10, Memo: "m"},
+				{Role: RoleRevenue, Credit: 110, Memo: "m"},
+			},
+			accounts: Accounts{RoleRevenue: "4100", RoleReceivable: "1200", RoleSalesDiscount: ""},
+			wantErr:  true,
+		},
+		{
+			name: "unknown role",
+			lines: []Line{
+				{Role: "inventory", Debit: 100, Memo: "m"},
+				{Role: RoleRevenue, Credit: 100, Memo: "m"},
+			},
+			accounts: testAccounts,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.lines, tt.accounts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Resolve = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve error %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []Line
+		want  []Line
+	}{
+		{
+			name:  "zero line dropped",
+			lines: []Line{{Role: RoleSalesDiscount}, {Role: RoleRevenue, Credit: 10}},
+			want:  []Line{{Role: RoleRevenue, Credit: 10}},
+		},
+		{
+			name:  "negative debit moved to credit",
+			lines: []Line{{Role: RoleSalesDiscount, Debit: -5}},
+			want:  []Line{{Role: RoleSalesDiscount, Credit: 5}},
+		},
+		{
+			name:  "negative credit moved to debit",
+			lines: []Line{{Role: RoleSalesDiscount, Credit: -5}},
+			want:  []Line{{Role: RoleSalesDiscount, Debit: 5}},
+		},
+		{
+			name:  "all zero",
+			lines: []Line{{Role: RoleReceivable}, {Role: RoleRevenue}},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compact(tt.lines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compact = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
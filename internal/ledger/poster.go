@@ -0,0 +1,226 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jacky-htg/sales-service/internal/model"
+)
+
+// postTimeout bound each call to the ledger, the claim of a batch last long enough to post all of it
+const postTimeout = 30 * time.Second
+
+// Poster send queued journal postings to the general ledger.
+// Postings of a document are sent in order, an updated document post the reversal of its previous posting together with the new entry.
+// Postings are claimed in a short transaction and posted without holding locks, several posters can run at a time.
+type Poster struct {
+	Db        *sql.DB
+	Client    Client
+	Log       *slog.Logger
+	Interval  time.Duration
+	BatchSize int
+}
+
+// claim is a posting taken by this poster with the previous posting of its document
+type claim struct {
+	posting  *model.JournalPosting
+	previous *model.JournalPosting
+}
+
+// Run poll due postings until ctx is done
+func (p *Poster) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PostOnce(ctx); err != nil && ctx.Err() == nil {
+			p.Log.Error("post journals", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PostOnce send one batch of due postings and return how many were posted
+func (p *Poster) PostOnce(ctx context.Context) (int, error) {
+	claims, err := p.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	accounts := map[string]Accounts{}
+	for _, c := range claims {
+		var journalID string
+		var postErr error
+		companyAccount, ok := accounts[c.posting.CompanyID]
+		if !ok {
+			companyAccount, postErr = companyAccounts(ctx, p.Db, c.posting.CompanyID)
+			if postErr == nil {
+				accounts[c.posting.CompanyID] = companyAccount
+			}
+		}
+
+		// the result is recorded even when the accounts can not be read, so the posting does not stay in flight
+		if postErr == nil {
+			journalID, postErr = p.post(ctx, c, companyAccount)
+		}
+
+		if err := p.record(ctx, c.posting, journalID, postErr); err != nil {
+			return posted, err
+		}
+
+		if postErr == nil {
+			posted++
+		}
+	}
+
+	return posted, nil
+}
+
+// claim lock due postings skipping the ones locked by other posters, mark them in flight and commit.
+// A posting waiting for the previous posting of its document is left for a later round.
+func (p *Poster) claim(ctx context.Context) ([]claim, error) {
+	tx, err := model.BeginSystemTx(ctx, p.Db, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	batchSize := p.BatchSize
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+
+	postings, err := model.DueJournalPostings(ctx, tx, batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	until := time.Now().UTC().Add(time.Duration(len(postings))*postTimeout + time.Minute)
+	var claims []claim
+	for _, posting := range postings {
+		previous, err := posting.Previous(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		// wait until the previous posting of the document is in the ledger
+		if previous != nil && previous.Status != model.PostingPosted {
+			continue
+		}
+
+		if err := posting.Claim(ctx, tx, until); err != nil {
+			return nil, err
+		}
+		claims = append(claims, claim{posting: posting, previous: previous})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit journal postings claim: %v", err)
+	}
+
+	return claims, nil
+}
+
+// post send the journal of the claim to the ledger, an empty journal id with no error means nothing changed in the ledger
+func (p *Poster) post(ctx context.Context, c claim, accounts Accounts) (string, error) {
+	journal, err := buildJournal(c.posting, c.previous, accounts)
+	if err != nil {
+		return "", err
+	}
+
+	if len(journal.Lines) == 0 {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, postTimeout)
+	defer cancel()
+
+	return p.Client.PostJournal(ctx, journal)
+}
+
+// record save the result of the posting in its own transaction.
+// A failed commit leaves the posting in flight, it is posted again when the claim expire and the ledger ignore the resend by its idempotency key.
+func (p *Poster) record(ctx context.Context, posting *model.JournalPosting, journalID string, cause error) error {
+	tx, err := model.BeginCompanyTx(ctx, p.Db, nil, posting.CompanyID)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if cause == nil {
+		err = posting.MarkPosted(ctx, tx, journalID)
+	} else {
+		err = posting.MarkFailed(ctx, tx, cause)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit journal posting: %v", err)
+	}
+
+	return nil
+}
+
+func buildJournal(posting, previous *model.JournalPosting, accounts Accounts) (*Journal, error) {
+	var lines []Line
+	if previous != nil {
+		var previousLines []Line
+		if err := json.Unmarshal(previous.Lines, &previousLines); err != nil {
+			return nil, fmt.Errorf("unmarshal previous posting lines: %v", err)
+		}
+		lines = Reverse(previousLines)
+	}
+
+	var currentLines []Line
+	if err := json.Unmarshal(posting.Lines, &currentLines); err != nil {
+		return nil, fmt.Errorf("unmarshal posting lines: %v", err)
+	}
+	lines = append(lines, currentLines...)
+
+	journalLines, err := Resolve(lines, accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		IdempotencyKey:  posting.Id,
+		CompanyId:       posting.CompanyID,
+		BranchId:        posting.BranchID,
+		TransactionDate: posting.DocumentDate.Format("2006-01-02"),
+		Reference:       posting.DocumentCode,
+		Source:          "sales-service/" + posting.DocumentType,
+		Lines:           journalLines,
+	}, nil
+}
+
+func companyAccounts(ctx context.Context, db *sql.DB, companyID string) (Accounts, error) {
+	account := model.LedgerAccount{CompanyID: companyID}
+	if err := account.Get(ctx, db); err != nil {
+		return nil, err
+	}
+
+	return Accounts{
+		RoleRevenue:       account.Revenue,
+		RoleReceivable:    account.Receivable,
+		RoleSalesDiscount: account.SalesDiscount,
+		RoleSalesReturn:   account.SalesReturn,
+		RoleTaxPayable:    account.TaxPayable,
+	}, nil
+}
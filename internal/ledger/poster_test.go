@@ -0,0 +1,121 @@
+package ledger
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/model"
+)
+
+func testPosting(t *testing.T, id string, lines []Line) *model.JournalPosting {
+	t.Helper()
+
+	data, err := json.Marshal(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &model.JournalPosting{
+		Id:           id,
+		CompanyID:    "company",
+		BranchID:     "branch",
+		DocumentType: model.AggregateSales,
+		DocumentID:   "sales",
+		DocumentCode: "SO1",
+		DocumentDate: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		Lines:        data,
+	}
+}
+
+func TestBuildJournal(t *testing.T) {
+	created := SalesEntry(&sales.Sales{Code: "SO1", TotalPrice: 200, Details: []*sales.SalesDetail{
+		{Price: 100, Quantity: 2, TotalPrice: 200},
+	}})
+	updated := SalesEntry(&sales.Sales{Code: "SO1", AdditionalDiscAmount: 30, TotalPrice: 270, Details: []*sales.SalesDetail{
+		{Price: 100, Quantity: 3, TotalPrice: 300},
+	}})
+
+	tests := []struct {
+		name      string
+		posting   *model.JournalPosting
+		previous  *model.JournalPosting
+		accounts  Accounts
+		wantLines []JournalLine
+		wantErr   bool
+	}{
+		{
+			name:     "created document",
+			posting:  testPosting(t, "p1", created),
+			accounts: testAccounts,
+			wantLines: []JournalLine{
+				{AccountCode: "1200", Debit: 200, Memo: "Sales SO1"},
+				{AccountCode: "4100", Credit: 200, Memo: "Sales SO1"},
+			},
+		},
+		{
+			name:     "updated document reverse the previous posting",
+			posting:  testPosting(t, "p2", updated),
+			previous: testPosting(t, "p1", created),
+			accounts: testAccounts,
+			wantLines: []JournalLine{
+				{AccountCode: "1200", Credit: 200, Memo: "Reverse Sales SO1"},
+				{AccountCode: "4100", Debit: 200, Memo: "Reverse Sales SO1"},
+				{AccountCode: "1200", Debit: 270, Memo: "Sales SO1"},
+				{AccountCode: "4200", Debit: 30, Memo: "Sales SO1"},
+				{AccountCode: "4100", Credit: 300, Memo: "Sales SO1"},
+			},
+		},
+		{
+			name:     "unmapped role",
+			posting:  testPosting(t, "p2", updated),
+			accounts: Accounts{RoleRevenue: "4100", RoleReceivable: "1200"},
+			wantErr:  true,
+		},
+		{
+			name:     "unmapped role of the previous posting",
+			posting:  testPosting(t, "p2", created),
+			previous: testPosting(t, "p1", updated),
+			accounts: Accounts{RoleRevenue: "4100", RoleReceivable: "1200"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid lines",
+			posting:  &model.JournalPosting{Id: "p1", Lines: []byte("not json")},
+			accounts: testAccounts,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid lines of the previous posting",
+			posting:  testPosting(t, "p2", updated),
+			previous: &model.JournalPosting{Id: "p1", Lines: []byte("not json")},
+			accounts: testAccounts,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal, err := buildJournal(tt.posting, tt.previous, tt.accounts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("buildJournal = %+v, want error", journal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildJournal error %v", err)
+			}
+
+			if journal.IdempotencyKey != tt.posting.Id || journal.CompanyId != "company" || journal.BranchId != "branch" ||
+				journal.TransactionDate != "2024-03-04" || journal.Reference != "SO1" || journal.Source != "sales-service/"+model.AggregateSales {
+				t.Errorf("buildJournal header = %+v", journal)
+			}
+			if !reflect.DeepEqual(journal.Lines, tt.wantLines) {
+				t.Errorf("buildJournal lines = %+v, want %+v", journal.Lines, tt.wantLines)
+			}
+		})
+	}
+}
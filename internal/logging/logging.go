@@ -0,0 +1,201 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader carry the request id from the caller, back to it and to the downstream services
+const RequestIDHeader = "x-request-id"
+
+type loggerKey struct{}
+
+type requestKey struct{}
+
+// request is filled while the rpc runs, the caller is only known after authentication
+type request struct {
+	mu        sync.Mutex
+	id        string
+	companyID string
+	userID    string
+}
+
+// New return a json logger of level debug, info (default), warn or error
+func New(w io.Writer, level string) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: parseLevel(level)}))
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// WithLogger keep the logger in ctx
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext return the logger of the request of ctx, with its request id, company and user, the default logger outside of a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// RequestID return the request id of ctx, empty outside of a request
+func RequestID(ctx context.Context) string {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		return r.id
+	}
+	return ""
+}
+
+// SetCaller add the company and user of the authenticated caller to the log of the request
+func SetCaller(ctx context.Context, companyID, userID string) context.Context {
+	r, ok := ctx.Value(requestKey{}).(*request)
+	if !ok {
+		return ctx
+	}
+
+	r.mu.Lock()
+	r.companyID = companyID
+	r.userID = userID
+	r.mu.Unlock()
+
+	return WithLogger(ctx, FromContext(ctx).With("company_id", companyID, "user_id", userID))
+}
+
+// UnaryServerInterceptor give every rpc a request id and a logger, then log its method, caller, duration and status code
+func UnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, r := start(ctx, logger, info.FullMethod)
+		begin := time.Now()
+
+		resp, err := handler(ctx, req)
+		finish(logger, r, info.FullMethod, begin, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor give every stream a request id and a logger, then log it when it ends
+func StreamServerInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, r := start(ss.Context(), logger, info.FullMethod)
+		begin := time.Now()
+
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		finish(logger, r, info.FullMethod, begin, err)
+
+		return err
+	}
+}
+
+// UnaryClientInterceptor pass the request id to the downstream service and log the call at debug level
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		begin := time.Now()
+		err := invoker(outgoing(ctx), method, req, reply, cc, opts...)
+
+		FromContext(ctx).Debug("downstream call", "downstream_method", method,
+			"duration_ms", time.Since(begin).Milliseconds(), "code", status.Code(err).String())
+
+		return err
+	}
+}
+
+// StreamClientInterceptor pass the request id to the downstream service
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(outgoing(ctx), desc, cc, method, opts...)
+		if err != nil {
+			FromContext(ctx).Debug("downstream stream", "downstream_method", method, "code", status.Code(err).String())
+		}
+
+		return stream, err
+	}
+}
+
+func start(ctx context.Context, logger *slog.Logger, method string) (context.Context, *request) {
+	r := &request{id: incomingRequestID(ctx)}
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, r.id))
+
+	ctx = context.WithValue(ctx, requestKey{}, r)
+	logger = logger.With("request_id", r.id, "method", method)
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		logger = logger.With("trace_id", span.TraceID().String())
+	}
+	ctx = WithLogger(ctx, logger)
+
+	return ctx, r
+}
+
+func finish(logger *slog.Logger, r *request, method string, begin time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable, codes.DeadlineExceeded:
+		level = slog.LevelError
+	}
+
+	r.mu.Lock()
+	attrs := []slog.Attr{
+		slog.String("request_id", r.id),
+		slog.String("method", method),
+		slog.String("company_id", r.companyID),
+		slog.String("user_id", r.userID),
+		slog.Int64("duration_ms", time.Since(begin).Milliseconds()),
+		slog.String("code", code.String()),
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+
+	logger.LogAttrs(context.Background(), level, "rpc", attrs...)
+}
+
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDHeader); len(ids) > 0 && len(ids[0]) > 0 && len(ids[0]) <= 128 {
+			return ids[0]
+		}
+	}
+	return uuid.New().String()
+}
+
+func outgoing(ctx context.Context) context.Context {
+	if id := RequestID(ctx); len(id) > 0 {
+		return metadata.AppendToOutgoingContext(ctx, RequestIDHeader, id)
+	}
+	return ctx
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
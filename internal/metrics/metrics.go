@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Registry hold every metric of the service, it is served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	rpcHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server, by method and status code.",
+	}, []string{"method", "code"})
+
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Latency of RPCs on the server, until the response or the end of the stream.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	downstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_client_handling_seconds",
+		Help:    "Latency of calls to the user, inventory and ledger services, by method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	ordersCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sales_orders_created_total",
+		Help: "Sales orders created.",
+	}, []string{"company_id", "branch_id"})
+
+	orderValue = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sales_order_value_total",
+		Help: "Total price of the sales orders created.",
+	}, []string{"company_id", "branch_id"})
+
+	returnsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sales_returns_created_total",
+		Help: "Sales returns created.",
+	}, []string{"company_id", "branch_id"})
+
+	returnValue = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sales_return_value_total",
+		Help: "Total price of the sales returns created.",
+	}, []string{"company_id", "branch_id"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rpcHandled, rpcDuration, downstreamDuration,
+		ordersCreated, orderValue, returnsCreated, returnValue,
+	)
+}
+
+// RegisterDB export the connection pool stats of db
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "sales"))
+}
+
+// Register export more collectors, for example the ones of the lookup cache
+func Register(cs ...prometheus.Collector) {
+	Registry.MustRegister(cs...)
+}
+
+// Handler serve the metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// OrderCreated count a created sales order and its total price
+func OrderCreated(companyID, branchID string, value float64) {
+	ordersCreated.WithLabelValues(companyID, branchID).Inc()
+	orderValue.WithLabelValues(companyID, branchID).Add(value)
+}
+
+// ReturnCreated count a created sales return and its total price
+func ReturnCreated(companyID, branchID string, value float64) {
+	returnsCreated.WithLabelValues(companyID, branchID).Inc()
+	returnValue.WithLabelValues(companyID, branchID).Add(value)
+}
+
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		begin := time.Now()
+		resp, err := handler(ctx, req)
+		observe(info.FullMethod, begin, err)
+
+		return resp, err
+	}
+}
+
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		begin := time.Now()
+		err := handler(srv, ss)
+		observe(info.FullMethod, begin, err)
+
+		return err
+	}
+}
+
+// UnaryClientInterceptor observe the latency of each attempt of a call to another service
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		begin := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		downstreamDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(begin).Seconds())
+
+		return err
+	}
+}
+
+// StreamClientInterceptor observe the latency of opening a stream to another service
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		begin := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		downstreamDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(begin).Seconds())
+
+		return stream, err
+	}
+}
+
+func observe(method string, begin time.Time, err error) {
+	rpcHandled.WithLabelValues(method, status.Code(err).String()).Inc()
+	rpcDuration.WithLabelValues(method).Observe(time.Since(begin).Seconds())
+}
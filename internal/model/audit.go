@@ -0,0 +1,255 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	AuditInsert = "insert"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// auditEntities map the audited tables to the entity type and the column holding the document id
+var auditEntities = map[string]struct {
+	entity   string
+	document string
+}{
+	"sales":                {"sales", "id"},
+	"sales_details":        {"sales_detail", "sales_id"},
+	"sales_returns":        {"sales_return", "id"},
+	"sales_return_details": {"sales_return_detail", "sales_return_id"},
+	"customers":            {"customer", "id"},
+	"salesman":             {"salesman", "id"},
+}
+
+// auditIgnored columns are left out of changes, the audit log has its own user and time
+var auditIgnored = map[string]bool{
+	"company_id": true,
+	"created_at": true,
+	"created_by": true,
+	"updated_at": true,
+	"updated_by": true,
+	"version":    true,
+	// generated by postgres from the other columns, for the search and the duplicate matching
+	"search_vector": true,
+	"search_text":   true,
+	"match_name":    true,
+	"match_phone":   true,
+	"match_tax_id":  true,
+}
+
+type auditQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type AuditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type AuditLog struct {
+	Id         string
+	EntityType string
+	EntityID   string
+	DocumentID string
+	Action     string
+	Changes    []AuditChange
+	CreatedAt  time.Time
+	CreatedBy  string
+}
+
+type AuditFilter struct {
+	DocumentID string
+	UserID     string
+	EntityType string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// auditSnapshot read the row before it is changed and lock it until the transaction end, nil when there is no row
+func auditSnapshot(ctx context.Context, q auditQuerier, table, id string) (map[string]interface{}, error) {
+	if _, ok := auditEntities[table]; !ok {
+		return nil, status.Errorf(codes.Internal, "table %s is not audited", table)
+	}
+
+	var data []byte
+	err := q.QueryRowContext(ctx, fmt.Sprintf(`SELECT row_to_json(t) FROM %s t WHERE id = $1 FOR UPDATE`, table), id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query audit snapshot of %s: %v", table, err)
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal audit snapshot of %s: %v", table, err)
+	}
+
+	return row, nil
+}
+
+// recordAudit compare the row with the snapshot taken before the change and store the changed fields.
+// Snapshot is nil for insert.
+func recordAudit(ctx context.Context, q auditQuerier, table, id string, before map[string]interface{}) error {
+	after, err := auditSnapshot(ctx, q, table, id)
+	if err != nil {
+		return err
+	}
+
+	action := AuditUpdate
+	row := after
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		action = AuditInsert
+	case after == nil:
+		action = AuditDelete
+		row = before
+	}
+
+	documentID, _ := row[auditEntities[table].document].(string)
+
+	return insertAudit(ctx, q, table, id, documentID, action, auditChanges(before, after))
+}
+
+func auditChanges(before, after map[string]interface{}) []AuditChange {
+	fields := make(map[string]bool)
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	var changes []AuditChange
+	for field := range fields {
+		if auditIgnored[field] || field == "id" {
+			continue
+		}
+
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, AuditChange{Field: field, Before: before[field], After: after[field]})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes
+}
+
+func insertAudit(ctx context.Context, q auditQuerier, table, id, documentID, action string, changes []AuditChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal audit changes: %v", err)
+	}
+
+	query := `
+		INSERT INTO audit_logs (id, company_id, entity_type, entity_id, document_id, action, changes, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err = q.ExecContext(ctx, query,
+		uuid.New().String(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		auditEntities[table].entity,
+		id,
+		documentID,
+		action,
+		string(data),
+		time.Now().UTC(),
+		ctx.Value(app.Ctx("userID")).(string),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert audit log: %v", err)
+	}
+
+	return nil
+}
+
+// AuditQuery return the query of audit logs matching the filter, newest first
+func AuditQuery(ctx context.Context, in AuditFilter) (string, []interface{}) {
+	where := []string{"company_id = $1"}
+	params := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	if len(in.DocumentID) > 0 {
+		params = append(params, in.DocumentID)
+		where = append(where, fmt.Sprintf("document_id = $%d", len(params)))
+	}
+
+	if len(in.UserID) > 0 {
+		params = append(params, in.UserID)
+		where = append(where, fmt.Sprintf("created_by = $%d", len(params)))
+	}
+
+	if len(in.EntityType) > 0 {
+		params = append(params, in.EntityType)
+		where = append(where, fmt.Sprintf("entity_type = $%d", len(params)))
+	}
+
+	if !in.From.IsZero() {
+		params = append(params, in.From)
+		where = append(where, fmt.Sprintf("created_at >= $%d", len(params)))
+	}
+
+	if !in.To.IsZero() {
+		params = append(params, in.To)
+		where = append(where, fmt.Sprintf("created_at < $%d", len(params)))
+	}
+
+	// audit of sales and sales returns is only for the branches in scope, audit_logs has no branch so it is of the document
+	if scope, scopeParams := branchScopeFilter(ctx, nil, params); len(scope) > 0 {
+		params = scopeParams
+		where = append(where, fmt.Sprintf(`(entity_type NOT IN ('sales', 'sales_detail', 'sales_return', 'sales_return_detail')
+			OR (entity_type IN ('sales', 'sales_detail') AND EXISTS (SELECT 1 FROM sales WHERE sales.id = audit_logs.document_id AND sales.%[1]s))
+			OR (entity_type IN ('sales_return', 'sales_return_detail') AND EXISTS (SELECT 1 FROM sales_returns WHERE sales_returns.id = audit_logs.document_id AND sales_returns.%[1]s)))`, scope[0]))
+	}
+
+	query := `
+		SELECT id, entity_type, entity_id, document_id, action, changes, created_at, created_by
+		FROM audit_logs WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY created_at DESC, id`
+
+	if in.Limit > 0 {
+		params = append(params, in.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(params))
+	}
+
+	return query, params
+}
+
+func ScanAuditLog(rows *sql.Rows) (*AuditLog, error) {
+	var a AuditLog
+	var changes []byte
+	err := rows.Scan(&a.Id, &a.EntityType, &a.EntityID, &a.DocumentID, &a.Action, &changes, &a.CreatedAt, &a.CreatedBy)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "scan audit log: %v", err)
+	}
+
+	if err := json.Unmarshal(changes, &a.Changes); err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal audit changes: %v", err)
+	}
+
+	return &a, nil
+}
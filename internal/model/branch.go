@@ -2,10 +2,13 @@ package model
 
 import (
 	"context"
+	"fmt"
 	"io"
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/lib/pq"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -14,12 +17,13 @@ type Branch struct {
 	UserClient   users.UserServiceClient
 	RegionClient users.RegionServiceClient
 	BranchClient users.BranchServiceClient
+	Cache        *cache.Cache
 	Pb           *users.Branch
 	Id           string
 }
 
 func (u *Branch) IsYourBranch(ctx context.Context) error {
-	userLogin, err := getUserLogin(ctx, u.UserClient)
+	userLogin, err := getUserLogin(ctx, u.Cache, u.UserClient)
 	if err != nil {
 		return err
 	}
@@ -29,7 +33,7 @@ func (u *Branch) IsYourBranch(ctx context.Context) error {
 			return status.Error(codes.Unauthenticated, "its not your branch")
 		}
 	} else if len(userLogin.GetRegionId()) > 0 {
-		region, err := getRegion(ctx, u.RegionClient, &users.Region{Id: userLogin.GetRegionId()})
+		region, err := getRegion(ctx, u.Cache, u.RegionClient, &users.Region{Id: userLogin.GetRegionId()})
 		if err != nil {
 			return err
 		}
@@ -38,7 +42,7 @@ func (u *Branch) IsYourBranch(ctx context.Context) error {
 			return err
 		}
 	} else {
-		branches, err := getBranches(ctx, u.BranchClient)
+		branches, err := getBranches(ctx, u.Cache, u.BranchClient)
 		if err != nil {
 			return err
 		}
@@ -51,6 +55,72 @@ func (u *Branch) IsYourBranch(ctx context.Context) error {
 	return nil
 }
 
+type branchScopeKey struct{}
+
+// Scope return the branches visible to the user login, nil when the user see every branch of the company
+func (u *Branch) Scope(ctx context.Context) ([]string, error) {
+	userLogin, err := getUserLogin(ctx, u.Cache, u.UserClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 {
+		return []string{userLogin.GetBranchId()}, nil
+	}
+
+	if len(userLogin.GetRegionId()) > 0 {
+		region, err := getRegion(ctx, u.Cache, u.RegionClient, &users.Region{Id: userLogin.GetRegionId()})
+		if err != nil {
+			return nil, err
+		}
+
+		branches := []string{}
+		for _, branch := range region.GetBranches() {
+			branches = append(branches, branch.GetId())
+		}
+		return branches, nil
+	}
+
+	return nil, nil
+}
+
+// WithBranchScope keep the visible branches in ctx, get, list and export of sales and sales returns are restricted to them
+func WithBranchScope(ctx context.Context, branches []string) context.Context {
+	if branches == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, branchScopeKey{}, branches)
+}
+
+// InBranchScope check the branch against the branches of ctx, every branch is in scope when ctx has none
+func InBranchScope(ctx context.Context, branchID string) error {
+	branches, ok := ctx.Value(branchScopeKey{}).([]string)
+	if !ok {
+		return nil
+	}
+
+	for _, branch := range branches {
+		if branch == branchID {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "its not your branch")
+}
+
+// branchScopeFilter append the branch restriction of ctx to where conditions
+func branchScopeFilter(ctx context.Context, where []string, paramQueries []interface{}) ([]string, []interface{}) {
+	branches, ok := ctx.Value(branchScopeKey{}).([]string)
+	if !ok {
+		return where, paramQueries
+	}
+
+	paramQueries = append(paramQueries, pq.Array(branches))
+	where = append(where, fmt.Sprintf(`branch_id = ANY($%d)`, len(paramQueries)))
+
+	return where, paramQueries
+}
+
 func checkYourBranch(branches []*users.Branch, branchID string) error {
 	isYourBranch := false
 	for _, branch := range branches {
@@ -67,44 +137,58 @@ func checkYourBranch(branches []*users.Branch, branchID string) error {
 	return nil
 }
 
-func getUserLogin(ctx context.Context, userClient users.UserServiceClient) (*users.User, error) {
-	userLogin, err := userClient.View(app.SetMetadata(ctx), &users.Id{Id: ctx.Value(app.Ctx("userID")).(string)})
-	if s, ok := status.FromError(err); ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling user.Get service: %s", err)
+func getUserLogin(ctx context.Context, c *cache.Cache, userClient users.UserServiceClient) (*users.User, error) {
+	userID := ctx.Value(app.Ctx("userID")).(string)
+	if cached, ok := c.Get(ctx, cache.KindUser, userID); ok {
+		return cached.(*users.User), nil
+	}
+
+	userLogin, err := userClient.View(app.SetMetadata(ctx), &users.Id{Id: userID})
+	if err != nil {
+		if cached, ok := c.Fallback(ctx, cache.KindUser, userID, err); ok {
+			return cached.(*users.User), nil
 		}
 
-		return &users.User{}, err
+		return &users.User{}, downstreamError(err, "user.Get")
 	}
 
+	c.Set(ctx, cache.KindUser, userID, userLogin)
+
 	return userLogin, nil
 }
 
-func getRegion(ctx context.Context, regionClient users.RegionServiceClient, r *users.Region) (*users.Region, error) {
-	region, err := regionClient.View(app.SetMetadata(ctx), &users.Id{Id: r.GetId()})
+func getRegion(ctx context.Context, c *cache.Cache, regionClient users.RegionServiceClient, r *users.Region) (*users.Region, error) {
+	if cached, ok := c.Get(ctx, cache.KindRegion, r.GetId()); ok {
+		return cached.(*users.Region), nil
+	}
 
-	if s, ok := status.FromError(err); ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Region.Get service: %s", err)
+	region, err := regionClient.View(app.SetMetadata(ctx), &users.Id{Id: r.GetId()})
+	if err != nil {
+		if cached, ok := c.Fallback(ctx, cache.KindRegion, r.GetId(), err); ok {
+			return cached.(*users.Region), nil
 		}
 
-		return &users.Region{}, err
+		return &users.Region{}, downstreamError(err, "Region.Get")
 	}
 
+	c.Set(ctx, cache.KindRegion, r.GetId(), region)
+
 	return region, nil
 }
 
-func getBranches(ctx context.Context, branchClient users.BranchServiceClient) ([]*users.Branch, error) {
+func getBranches(ctx context.Context, c *cache.Cache, branchClient users.BranchServiceClient) ([]*users.Branch, error) {
+	if cached, ok := c.Get(ctx, cache.KindBranches, ""); ok {
+		return cached.([]*users.Branch), nil
+	}
+
 	var list []*users.Branch
-	var err error
 	stream, err := branchClient.List(app.SetMetadata(ctx), &users.ListBranchRequest{})
-
-	if s, ok := status.FromError(err); ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Branches.List service: %s", err)
+	if err != nil {
+		if cached, ok := c.Fallback(ctx, cache.KindBranches, "", err); ok {
+			return cached.([]*users.Branch), nil
 		}
 
-		return list, err
+		return list, downstreamError(err, "Branches.List")
 	}
 
 	for {
@@ -113,23 +197,37 @@ func getBranches(ctx context.Context, branchClient users.BranchServiceClient) ([
 			break
 		}
 		if err != nil {
+			if cached, ok := c.Fallback(ctx, cache.KindBranches, "", err); ok {
+				return cached.([]*users.Branch), nil
+			}
+
 			return list, status.Errorf(codes.Internal, "cannot receive %v", err)
 		}
 		list = append(list, resp.GetBranch())
 	}
-	return list, err
+
+	c.Set(ctx, cache.KindBranches, "", list)
+
+	return list, nil
 }
 
 func (u *Branch) Get(ctx context.Context) error {
+	if cached, ok := u.Cache.Get(ctx, cache.KindBranch, u.Id); ok {
+		u.Pb = cached.(*users.Branch)
+		return nil
+	}
+
 	branch, err := u.BranchClient.View(app.SetMetadata(ctx), &users.Id{Id: u.Id})
-	if s, ok := status.FromError(err); ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Branch.Get service: %s", err)
+	if err != nil {
+		if cached, ok := u.Cache.Fallback(ctx, cache.KindBranch, u.Id, err); ok {
+			u.Pb = cached.(*users.Branch)
+			return nil
 		}
 
-		return err
+		return downstreamError(err, "Branch.Get")
 	}
 	u.Pb = branch
+	u.Cache.Set(ctx, cache.KindBranch, u.Id, branch)
 
 	return nil
 }
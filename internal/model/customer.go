@@ -3,28 +3,48 @@ package model
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/filter"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type Customer struct {
-	Pb sales.Customer
+	Pb       sales.Customer
+	IsActive bool
+	TaxID    string
+	// Version increase on every update, an update with an older version is aborted
+	Version int32
 }
 
+// ActiveStatus filter for customer and salesman list
+type ActiveStatus string
+
+const (
+	StatusActive   ActiveStatus = "active"
+	StatusInactive ActiveStatus = "inactive"
+	StatusAll      ActiveStatus = "all"
+)
+
 func (u *Customer) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by 
+		SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by, is_active, tax_id, version
 		FROM customers WHERE id = $1 AND company_id = $2
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare statement Get customer: %v", err)
 	}
@@ -33,7 +53,7 @@ func (u *Customer) Get(ctx context.Context, db *sql.DB) error {
 	var companyID string
 	var createdAt, updatedAt time.Time
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.IsActive, &u.TaxID, &u.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -55,12 +75,23 @@ func (u *Customer) Get(ctx context.Context, db *sql.DB) error {
 }
 
 func (u *Customer) GetByCode(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return u.GetByCodeTx(ctx, tx)
+}
+
+// GetByCodeTx is GetByCode in the transaction of the caller
+func (u *Customer) GetByCodeTx(ctx context.Context, tx *sql.Tx) error {
 	query := `
-		SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by 
+		SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by, is_active, tax_id, version
 		FROM customers WHERE company_id = $1 AND code = $2
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare statement Get customer by code: %v", err)
 	}
@@ -69,7 +100,7 @@ func (u *Customer) GetByCode(ctx context.Context, db *sql.DB) error {
 	var companyID string
 	var createdAt, updatedAt time.Time
 	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetCode()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.IsActive, &u.TaxID, &u.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -87,16 +118,38 @@ func (u *Customer) GetByCode(ctx context.Context, db *sql.DB) error {
 }
 
 func (u *Customer) Create(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = u.CreateTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// CreateTx is Create in the transaction of the caller, it does not commit
+func (u *Customer) CreateTx(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
 	query := `
-		INSERT INTO customers (id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO customers (id, company_id, code, name, address, phone, tax_id, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare insert customer: %v", err)
 	}
@@ -109,6 +162,7 @@ func (u *Customer) Create(ctx context.Context, db *sql.DB) error {
 		u.Pb.GetName(),
 		u.Pb.GetAddress(),
 		u.Pb.GetPhone(),
+		u.TaxID,
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -120,11 +174,39 @@ func (u *Customer) Create(ctx context.Context, db *sql.DB) error {
 
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
+	u.IsActive = true
+	u.Version = 1
+
+	err = recordAudit(ctx, tx, "customers", u.Pb.GetId(), nil)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
 func (u *Customer) Update(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = u.UpdateTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// UpdateTx is Update in the transaction of the caller, it does not commit
+func (u *Customer) UpdateTx(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
@@ -133,36 +215,67 @@ func (u *Customer) Update(ctx context.Context, db *sql.DB) error {
 		name = $1,
 		address = $2,
 		phone = $3, 
-		updated_at = $4, 
-		updated_by= $5
-		WHERE id = $6 AND company_id = $7
+		tax_id = $4,
+		updated_at = $5, 
+		updated_by= $6,
+		version = version + 1
+		WHERE id = $7 AND company_id = $8 AND version = $9
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+
+	before, err := auditSnapshot(ctx, tx, "customers", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update customer: %v", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	result, err := stmt.ExecContext(ctx,
 		u.Pb.GetName(),
 		u.Pb.GetAddress(),
 		u.Pb.GetPhone(),
+		u.TaxID,
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
 		ctx.Value(app.Ctx("companyID")).(string),
+		u.Version,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update customer: %v", err)
 	}
 
+	if err := versionConflict(result, "customer"); err != nil {
+		return err
+	}
+
+	u.Version++
 	u.Pb.UpdatedAt = now.String()
 
+	err = recordAudit(ctx, tx, "customers", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (u *Customer) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM customers WHERE company_id = $1 AND id = $2`)
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := auditSnapshot(ctx, tx, "customers", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM customers WHERE company_id = $1 AND id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete customer: %v", err)
 	}
@@ -173,27 +286,168 @@ func (u *Customer) Delete(ctx context.Context, db *sql.DB) error {
 		return status.Errorf(codes.Internal, "Exec delete customer: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "customers", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
 	return nil
 }
 
-func (u *Customer) ListQuery(ctx context.Context, db *sql.DB, in *sales.Pagination) (string, []interface{}, *sales.CustomerPaginationResponse, error) {
+func (u *Customer) SetActive(ctx context.Context, db *sql.DB, active bool) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `UPDATE customers SET is_active = $1, updated_at = $2, updated_by = $3, version = version + 1 WHERE id = $4 AND company_id = $5 RETURNING version`
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := auditSnapshot(ctx, tx, "customers", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare set active customer: %v", err)
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRowContext(ctx, active, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&u.Version)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec set active customer: %v", err)
+	}
+
+	u.IsActive = active
+	u.Pb.UpdatedAt = now.String()
+
+	err = recordAudit(ctx, tx, "customers", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// Reference is the documents of one type referencing a customer or salesman, the first codes and the total
+type Reference struct {
+	Document string
+	Codes    []string
+	Total    int
+}
+
+// References return the sales and sales returns referencing the customer, types without reference are left out
+func (u *Customer) References(ctx context.Context, db *sql.DB, limit int) ([]Reference, error) {
+	return documentReferences(ctx, db, u.Pb.GetId(), limit, map[string]string{
+		"sales": `
+			SELECT code, COUNT(*) OVER() FROM sales
+			WHERE company_id = $1 AND customer_id = $2
+			ORDER BY created_at LIMIT $3`,
+		"sales return": `
+			SELECT sales_returns.code, COUNT(*) OVER() FROM sales_returns
+			JOIN sales ON sales.id = sales_returns.sales_id
+			WHERE sales_returns.company_id = $1 AND sales.customer_id = $2
+			ORDER BY sales_returns.created_at LIMIT $3`,
+		// a merge keep both customers, the code is of the other customer of the merge
+		"customer merge": `
+			SELECT customers.code, COUNT(*) OVER() FROM customer_merges
+			JOIN customers ON customers.id = CASE WHEN customer_merges.survivor_id = $2 THEN customer_merges.duplicate_id ELSE customer_merges.survivor_id END
+			WHERE customer_merges.company_id = $1 AND (customer_merges.survivor_id = $2 OR customer_merges.duplicate_id = $2)
+			ORDER BY customer_merges.created_at LIMIT $3`,
+	})
+}
+
+// documentReferences run a query per document type with the company, the id and the limit, sorted by document type
+func documentReferences(ctx context.Context, db *sql.DB, id string, limit int, queries map[string]string) ([]Reference, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var documents []string
+	for document := range queries {
+		documents = append(documents, document)
+	}
+	sort.Strings(documents)
+
+	var references []Reference
+	for _, document := range documents {
+		reference := Reference{Document: document}
+		rows, err := tx.QueryContext(ctx, queries[document], ctx.Value(app.Ctx("companyID")).(string), id, limit)
+		if err != nil {
+			return references, status.Errorf(codes.Internal, "Query %s references: %v", document, err)
+		}
+
+		for rows.Next() {
+			var code string
+			if err := rows.Scan(&code, &reference.Total); err != nil {
+				rows.Close()
+				return references, status.Errorf(codes.Internal, "scan %s references: %v", document, err)
+			}
+			reference.Codes = append(reference.Codes, strings.TrimSpace(code))
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return references, status.Errorf(codes.Internal, "rows %s references: %v", document, err)
+		}
+
+		if reference.Total > 0 {
+			references = append(references, reference)
+		}
+	}
+
+	return references, nil
+}
+
+// customerFields are the search and the order by of the customer list, other order by fall back to created_at
+var customerFields = filter.Schema{
+	"search":     filter.Field{Expr: "customers", Type: filter.FullText},
+	"created_at": filter.Field{Expr: "created_at", Type: filter.Timestamp, Sortable: true},
+	"code":       filter.Field{Expr: "code", Type: filter.Text, Sortable: true},
+	"name":       filter.Field{Expr: "name", Type: filter.Text, Sortable: true},
+}
+
+func (u *Customer) ListQuery(ctx context.Context, tx *sql.Tx, in *sales.Pagination, activeStatus ActiveStatus, page *Page) (string, []interface{}, *sales.CustomerPaginationResponse, error) {
 	var paginationResponse sales.CustomerPaginationResponse
-	query := `SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by FROM customers`
+	query := `SELECT id, company_id, code, name, address, phone, created_at, created_by, updated_at, updated_by, is_active FROM customers`
 	where := []string{"company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
 
-	if len(in.GetSearch()) > 0 {
-		paramQueries = append(paramQueries, "%"+in.GetSearch()+"%")
-		where = append(where, fmt.Sprintf(`(name ILIKE $%d OR code ILIKE $%d OR address ILIKE $%d OR phone ILIKE $%d)`, len(paramQueries), len(paramQueries), len(paramQueries), len(paramQueries)))
+	switch activeStatus {
+	case StatusActive:
+		where = append(where, "is_active = TRUE")
+	case StatusInactive:
+		where = append(where, "is_active = FALSE")
 	}
 
-	{
+	where, paramQueries, err := filter.Expression{}.Contains("search", in.GetSearch()).Where(customerFields, where, paramQueries)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
+
+	if page.count() {
 		qCount := `SELECT COUNT(*) FROM customers`
 		if len(where) > 0 {
 			qCount += " WHERE " + strings.Join(where, " AND ")
 		}
 		var count int
-		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		err := tx.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
 		if err != nil && err != sql.ErrNoRows {
 			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
 		}
@@ -201,10 +455,6 @@ func (u *Customer) ListQuery(ctx context.Context, db *sql.DB, in *sales.Paginati
 		paginationResponse.Count = uint32(count)
 	}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
-	}
-
 	if len(in.GetOrderBy()) == 0 || !(in.GetOrderBy() == "name" || in.GetOrderBy() == "code") {
 		if in == nil {
 			in = &sales.Pagination{OrderBy: "created_at"}
@@ -213,12 +463,30 @@ func (u *Customer) ListQuery(ctx context.Context, db *sql.DB, in *sales.Paginati
 		}
 	}
 
-	query += ` ORDER BY ` + in.GetOrderBy() + ` ` + in.GetSort().String()
+	where, paramQueries, err = page.keysetFilter(where, paramQueries, in.GetOrderBy(), customerFields[in.GetOrderBy()], in.GetSort())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
 
-	if in.GetLimit() > 0 {
-		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
-		paramQueries = append(paramQueries, in.GetLimit(), in.GetOffset())
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
 	}
 
+	query, paramQueries = page.orderAndLimit(query, paramQueries, customerFields[in.GetOrderBy()], in)
+
 	return query, paramQueries, &paginationResponse, nil
 }
+
+// versionConflict return Aborted when the update matched no row because the version changed since it was read
+func versionConflict(result sql.Result, entity string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected %s: %v", entity, err)
+	}
+
+	if affected == 0 {
+		return status.Errorf(codes.Aborted, "%s was changed by another user, reload and try again", entity)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultDuplicateThreshold minimum trigram similarity of the names to be reported as duplicate
+const DefaultDuplicateThreshold = 0.6
+
+type CustomerDuplicate struct {
+	Customer  *Customer
+	Candidate *Customer
+	Score     float64
+	Reasons   []string
+}
+
+// FindCustomerDuplicates compare active customers by tax id, phone and name similarity, best score first.
+// The comparison run in postgres on the match_* columns: tax id and phone are compared on their digits,
+// names are compared by pg_trgm similarity without the legal entity words (pt, cv, tbk, ...).
+// If customerID not empty, only duplicates of that customer are returned.
+func FindCustomerDuplicates(ctx context.Context, db *sql.DB, customerID string, threshold float64) ([]CustomerDuplicate, error) {
+	var duplicates []CustomerDuplicate
+	if threshold <= 0 || threshold > 1 {
+		threshold = DefaultDuplicateThreshold
+	}
+
+	tx, err := BeginTx(ctx, db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return duplicates, err
+	}
+	defer tx.Rollback()
+
+	// the % operator of the join use the gin index of match_name with this threshold
+	_, err = tx.ExecContext(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`, strconv.FormatFloat(threshold, 'f', -1, 64))
+	if err != nil {
+		return duplicates, status.Errorf(codes.Internal, "set similarity threshold: %v", err)
+	}
+
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+	pair := `a.id < b.id`
+	if len(customerID) > 0 {
+		paramQueries = append(paramQueries, customerID)
+		pair = `a.id = $2`
+	}
+
+	query := `
+		SELECT a.id, a.code, a.name, a.address, a.phone, a.tax_id,
+			b.id, b.code, b.name, b.address, b.phone, b.tax_id,
+			a.match_tax_id <> '' AND a.match_tax_id = b.match_tax_id,
+			a.match_phone <> '' AND a.match_phone = b.match_phone,
+			a.match_name % b.match_name,
+			similarity(a.match_name, b.match_name)
+		FROM customers a
+		JOIN customers b ON b.company_id = a.company_id AND b.is_active = TRUE AND b.id <> a.id AND (
+			(a.match_tax_id <> '' AND a.match_tax_id = b.match_tax_id) OR
+			(a.match_phone <> '' AND a.match_phone = b.match_phone) OR
+			a.match_name % b.match_name)
+		WHERE a.company_id = $1 AND a.is_active = TRUE AND ` + pair
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return duplicates, status.Errorf(codes.Internal, "Query customer duplicates: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		customer := &Customer{IsActive: true}
+		candidate := &Customer{IsActive: true}
+		var sameTaxID, samePhone, similarName bool
+		var similarity float64
+		err = rows.Scan(
+			&customer.Pb.Id, &customer.Pb.Code, &customer.Pb.Name, &customer.Pb.Address, &customer.Pb.Phone, &customer.TaxID,
+			&candidate.Pb.Id, &candidate.Pb.Code, &candidate.Pb.Name, &candidate.Pb.Address, &candidate.Pb.Phone, &candidate.TaxID,
+			&sameTaxID, &samePhone, &similarName, &similarity,
+		)
+		if err != nil {
+			return duplicates, status.Errorf(codes.Internal, "scan customer duplicates: %v", err)
+		}
+
+		duplicate := CustomerDuplicate{Customer: customer, Candidate: candidate}
+		if sameTaxID {
+			duplicate.Score = 1
+			duplicate.Reasons = append(duplicate.Reasons, "tax_id")
+		}
+
+		if samePhone {
+			if duplicate.Score < 0.9 {
+				duplicate.Score = 0.9
+			}
+			duplicate.Reasons = append(duplicate.Reasons, "phone")
+		}
+
+		if similarName {
+			if duplicate.Score < similarity {
+				duplicate.Score = similarity
+			}
+			duplicate.Reasons = append(duplicate.Reasons, "name")
+		}
+
+		duplicates = append(duplicates, duplicate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return duplicates, status.Errorf(codes.Internal, "rows customer duplicates: %v", err)
+	}
+
+	return duplicates, nil
+}
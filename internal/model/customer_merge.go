@@ -0,0 +1,194 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type CustomerMerge struct {
+	Id          string
+	SurvivorID  string
+	DuplicateID string
+	MovedSales  []string
+	CreatedAt   string
+	CreatedBy   string
+}
+
+// Merge repoint every sales of the duplicate customer to the survivor, deactivate the duplicate and record what moved
+func (u *CustomerMerge) Merge(ctx context.Context, tx *sql.Tx) error {
+	if u.SurvivorID == u.DuplicateID {
+		return status.Error(codes.InvalidArgument, "survivor and duplicate must be different customers")
+	}
+
+	u.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+
+	var survivor, duplicate *Customer
+	{
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, code, name, address, phone, tax_id, is_active
+			FROM customers WHERE company_id = $1 AND id IN ($2, $3)
+			FOR UPDATE`,
+			companyID, u.SurvivorID, u.DuplicateID,
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Query lock merged customers: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			c := &Customer{}
+			err = rows.Scan(&c.Pb.Id, &c.Pb.Code, &c.Pb.Name, &c.Pb.Address, &c.Pb.Phone, &c.TaxID, &c.IsActive)
+			if err != nil {
+				return status.Errorf(codes.Internal, "scan merged customers: %v", err)
+			}
+
+			if c.Pb.GetId() == u.SurvivorID {
+				survivor = c
+			} else {
+				duplicate = c
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			return status.Errorf(codes.Internal, "rows merged customers: %v", err)
+		}
+	}
+
+	if survivor == nil {
+		return status.Error(codes.NotFound, "survivor customer not found")
+	}
+
+	if duplicate == nil {
+		return status.Error(codes.NotFound, "duplicate customer not found")
+	}
+
+	if !survivor.IsActive || !duplicate.IsActive {
+		return status.Error(codes.FailedPrecondition, "only active customers can be merged")
+	}
+
+	{
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE sales SET customer_id = $1, updated_at = $2, updated_by = $3, version = version + 1
+			WHERE company_id = $4 AND customer_id = $5
+			RETURNING id`,
+			u.SurvivorID, now, u.CreatedBy, companyID, u.DuplicateID,
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec move sales of merged customer: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var salesID string
+			if err := rows.Scan(&salesID); err != nil {
+				return status.Errorf(codes.Internal, "scan moved sales: %v", err)
+			}
+			u.MovedSales = append(u.MovedSales, salesID)
+		}
+
+		if err := rows.Err(); err != nil {
+			return status.Errorf(codes.Internal, "rows moved sales: %v", err)
+		}
+	}
+
+	for _, salesID := range u.MovedSales {
+		err := insertAudit(ctx, tx, "sales", salesID, salesID, AuditUpdate, []AuditChange{
+			{Field: "customer_id", Before: u.DuplicateID, After: u.SurvivorID},
+		})
+		if err != nil {
+			return err
+		}
+
+		// subscribers of the sales see the new customer like for any other update of the sales
+		salesModel := Sales{}
+		salesModel.Pb.Id = salesID
+		err = salesModel.get(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		e, err := NewOutboxEvent(AggregateSales, salesID, EventSalesUpdated, &salesModel.Pb)
+		if err != nil {
+			return err
+		}
+
+		err = e.Create(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	before, err := auditSnapshot(ctx, tx, "customers", u.DuplicateID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE customers SET is_active = FALSE, updated_at = $1, updated_by = $2, version = version + 1 WHERE id = $3`,
+		now, u.CreatedBy, u.DuplicateID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec deactivate merged customer: %v", err)
+	}
+
+	err = recordAudit(ctx, tx, "customers", u.DuplicateID, before)
+	if err != nil {
+		return err
+	}
+
+	// survivor inherit tax id of duplicate when it has none
+	if len(survivor.TaxID) == 0 && len(duplicate.TaxID) > 0 {
+		before, err := auditSnapshot(ctx, tx, "customers", u.SurvivorID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE customers SET tax_id = $1, updated_at = $2, updated_by = $3, version = version + 1 WHERE id = $4`,
+			duplicate.TaxID, now, u.CreatedBy, u.SurvivorID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec update survivor tax id: %v", err)
+		}
+
+		err = recordAudit(ctx, tx, "customers", u.SurvivorID, before)
+		if err != nil {
+			return err
+		}
+	}
+
+	duplicateData, err := json.Marshal(map[string]interface{}{
+		"code":    duplicate.Pb.GetCode(),
+		"name":    duplicate.Pb.GetName(),
+		"address": duplicate.Pb.GetAddress(),
+		"phone":   duplicate.Pb.GetPhone(),
+		"tax_id":  duplicate.TaxID,
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal duplicate customer: %v", err)
+	}
+
+	movedSales, err := json.Marshal(u.MovedSales)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal moved sales: %v", err)
+	}
+
+	query := `
+		INSERT INTO customer_merges (id, company_id, survivor_id, duplicate_id, duplicate_data, moved_sales, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err = tx.ExecContext(ctx, query, u.Id, companyID, u.SurvivorID, u.DuplicateID, string(duplicateData), string(movedSales), now, u.CreatedBy)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert customer merge: %v", err)
+	}
+
+	u.CreatedAt = now.String()
+
+	return nil
+}
@@ -3,10 +3,10 @@ package model
 import (
 	"context"
 	"io"
-	"log"
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/sales-service/internal/logging"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -17,19 +17,15 @@ type Delivery struct {
 
 func (u *Delivery) HasTransactionBySales(ctx context.Context, salesId string) (bool, error) {
 	streamClient, err := u.Client.List(app.SetMetadata(ctx), &inventories.ListDeliveryRequest{SalesOrderId: salesId})
-	if s, ok := status.FromError(err); ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Sales.HasTreansaction service: %s", err)
-		}
-
-		return false, err
+	if err != nil {
+		return false, downstreamError(err, "Sales.HasTreansaction")
 	}
 
 	var response []*inventories.ListDeliveryResponse
 	for {
 		resp, err := streamClient.Recv()
 		if err == io.EOF {
-			log.Print("end stream")
+			logging.FromContext(ctx).Debug("end stream")
 			break
 		}
 		if err != nil {
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type DocumentTemplate struct {
+	Logo      []byte
+	Header    string
+	Footer    string
+	Terms     string
+	UpdatedAt string
+	UpdatedBy string
+}
+
+// Get load the template of the company, a company without template get an empty one
+func (u *DocumentTemplate) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT logo, header, footer, terms, updated_at, updated_by FROM document_templates WHERE company_id = $1`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get document template: %v", err)
+	}
+	defer stmt.Close()
+
+	var updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string)).Scan(
+		&u.Logo, &u.Header, &u.Footer, &u.Terms, &updatedAt, &u.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get document template: %v", err)
+	}
+
+	u.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+func (u *DocumentTemplate) Save(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO document_templates (company_id, logo, header, footer, terms, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (company_id) DO UPDATE SET
+			logo = EXCLUDED.logo, header = EXCLUDED.header, footer = EXCLUDED.footer, terms = EXCLUDED.terms,
+			updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement save document template: %v", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	u.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	_, err = stmt.ExecContext(ctx,
+		ctx.Value(app.Ctx("companyID")).(string), u.Logo, u.Header, u.Footer, u.Terms, now, u.UpdatedBy,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec save document template: %v", err)
+	}
+
+	u.UpdatedAt = now.String()
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
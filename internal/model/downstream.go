@@ -0,0 +1,14 @@
+package model
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// downstreamError keep the status of a failed call to another service, an unknown error become internal
+func downstreamError(err error, call string) error {
+	if status.Code(err) == codes.Unknown {
+		return status.Errorf(codes.Internal, "Error when calling %s service: %s", call, err)
+	}
+	return err
+}
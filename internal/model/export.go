@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/filter"
+)
+
+// ExportQuery select every sales line joined with customer and salesman, filtered like ListQuery plus sales date range
+func (u *Sales) ExportQuery(ctx context.Context, in *sales.ListSalesRequest, dateFrom, dateTo time.Time, expr filter.Expression) (string, []interface{}, error) {
+	where, paramQueries, err := u.listFilter(ctx, in, expr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	paramQueries = append(paramQueries, dateFrom)
+	where = append(where, fmt.Sprintf(`sales_date >= $%d`, len(paramQueries)))
+
+	paramQueries = append(paramQueries, dateTo)
+	where = append(where, fmt.Sprintf(`sales_date <= $%d`, len(paramQueries)))
+
+	query := `
+		SELECT sales.code, sales.sales_date, sales.branch_name, 
+			customers.code, customers.name, salesman.code, salesman.name, sales.remark, 
+			sales.price, sales.additional_disc_amount, sales.additional_disc_percentage, sales.total_price,
+			sales_details.product_id, sales_details.quantity, sales_details.price, 
+			sales_details.disc_amount, sales_details.disc_percentage, sales_details.total_price
+		FROM (SELECT * FROM sales WHERE ` + strings.Join(where, " AND ") + `) AS sales
+		JOIN customers ON sales.customer_id = customers.id
+		JOIN salesman ON sales.salesman_id = salesman.id
+		JOIN sales_details ON sales.id = sales_details.sales_id
+		ORDER BY sales.sales_date, sales.code, sales_details.id
+	`
+
+	return query, paramQueries, nil
+}
+
+// ExportQuery select every sales return line joined with its sales, customer and salesman, filtered like ListQuery plus return date range
+func (u *SalesReturn) ExportQuery(ctx context.Context, in *sales.ListSalesReturnRequest, dateFrom, dateTo time.Time, expr filter.Expression) (string, []interface{}, error) {
+	where, paramQueries, err := u.listFilter(ctx, in, expr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	paramQueries = append(paramQueries, dateFrom)
+	where = append(where, fmt.Sprintf(`return_date >= $%d`, len(paramQueries)))
+
+	paramQueries = append(paramQueries, dateTo)
+	where = append(where, fmt.Sprintf(`return_date <= $%d`, len(paramQueries)))
+
+	query := `
+		SELECT sales_returns.code, sales_returns.return_date, sales_returns.branch_name, sales.code,
+			customers.code, customers.name, salesman.code, salesman.name, sales_returns.remark,
+			sales_returns.price, sales_returns.additional_disc_amount, sales_returns.additional_disc_percentage, sales_returns.total_price,
+			sales_return_details.product_id, sales_return_details.quantity, sales_return_details.price, 
+			sales_return_details.disc_amount, sales_return_details.disc_percentage, sales_return_details.total_price
+		FROM (SELECT * FROM sales_returns WHERE ` + strings.Join(where, " AND ") + `) AS sales_returns
+		JOIN sales ON sales_returns.sales_id = sales.id
+		JOIN customers ON sales.customer_id = customers.id
+		JOIN salesman ON sales.salesman_id = salesman.id
+		JOIN sales_return_details ON sales_returns.id = sales_return_details.sales_return_id
+		ORDER BY sales_returns.return_date, sales_returns.code, sales_return_details.id
+	`
+
+	return query, paramQueries, nil
+}
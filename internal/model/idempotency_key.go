@@ -0,0 +1,131 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IdempotencyKeyTTL is how long a key replay the original response
+const IdempotencyKeyTTL = 24 * time.Hour
+
+type IdempotencyKey struct {
+	Key         string
+	Method      string
+	RequestHash string
+	DocumentID  string
+	ExpiresAt   time.Time
+}
+
+// Get load the unexpired key of the company, false when there is none
+func (u *IdempotencyKey) Get(ctx context.Context, db *sql.DB) (bool, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var documentID sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT request_hash, document_id, expires_at FROM idempotency_keys
+		WHERE company_id = $1 AND method = $2 AND key = $3 AND expires_at > $4`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Method, u.Key, time.Now().UTC(),
+	).Scan(&u.RequestHash, &documentID, &u.ExpiresAt)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Query Raw get idempotency key: %v", err)
+	}
+
+	u.DocumentID = documentID.String
+
+	return true, nil
+}
+
+// Claim insert the key in the transaction creating the document.
+// A concurrent call with the same key wait until this transaction ends, then get false with the stored request hash and document id.
+func (u *IdempotencyKey) Claim(ctx context.Context, tx *sql.Tx) (bool, error) {
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	now := time.Now().UTC()
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE company_id = $1 AND method = $2 AND key = $3 AND expires_at <= $4`,
+		companyID, u.Method, u.Key, now)
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Exec delete expired idempotency key: %v", err)
+	}
+
+	requestHash := u.RequestHash
+	u.ExpiresAt = now.Add(IdempotencyKeyTTL)
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (company_id, key, method, request_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (company_id, method, key) DO NOTHING`,
+		companyID, u.Key, u.Method, u.RequestHash, now, u.ExpiresAt)
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Exec insert idempotency key: %v", err)
+	}
+
+	if inserted, err := result.RowsAffected(); err != nil {
+		return false, status.Errorf(codes.Internal, "rows affected idempotency key: %v", err)
+	} else if inserted == 1 {
+		return true, nil
+	}
+
+	var documentID sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT request_hash, document_id, expires_at FROM idempotency_keys
+		WHERE company_id = $1 AND method = $2 AND key = $3`,
+		companyID, u.Method, u.Key,
+	).Scan(&u.RequestHash, &documentID, &u.ExpiresAt)
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Query Raw get claimed idempotency key: %v", err)
+	}
+
+	u.DocumentID = documentID.String
+	if u.RequestHash != requestHash {
+		return false, status.Error(codes.AlreadyExists, "idempotency key already used with a different request")
+	}
+
+	return false, nil
+}
+
+// Complete store the document created under the key
+func (u *IdempotencyKey) Complete(ctx context.Context, tx *sql.Tx, documentID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE idempotency_keys SET document_id = $1 WHERE company_id = $2 AND method = $3 AND key = $4`,
+		documentID, ctx.Value(app.Ctx("companyID")).(string), u.Method, u.Key)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec complete idempotency key: %v", err)
+	}
+
+	u.DocumentID = documentID
+
+	return nil
+}
+
+// PurgeIdempotencyKeys delete expired keys of every company
+func PurgeIdempotencyKeys(ctx context.Context, db *sql.DB) (int64, error) {
+	tx, err := BeginSystemTx(ctx, db, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, time.Now().UTC())
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Exec purge idempotency keys: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return result.RowsAffected()
+}
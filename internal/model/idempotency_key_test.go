@@ -0,0 +1,222 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/sales-service/internal/schema"
+	_ "github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testDB open the database of TEST_DATABASE_URL with the migrations applied, the test is skipped without it
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if len(dsn) == 0 {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := schema.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
+
+func companyCtx(companyID string) context.Context {
+	ctx := context.WithValue(context.Background(), app.Ctx("companyID"), companyID)
+	return context.WithValue(ctx, app.Ctx("userID"), uuid.New().String())
+}
+
+// claimKey claim the key in its own transaction, completed with documentID when the claim is won
+func claimKey(t *testing.T, ctx context.Context, db *sql.DB, key *IdempotencyKey, documentID string) (bool, error) {
+	t.Helper()
+
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	claimed, err := key.Claim(ctx, tx)
+	if err != nil || !claimed {
+		return claimed, err
+	}
+
+	if err := key.Complete(ctx, tx, documentID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	return true, nil
+}
+
+// expireKey move the key of the company in the past
+func expireKey(t *testing.T, ctx context.Context, db *sql.DB, key *IdempotencyKey) {
+	t.Helper()
+
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE idempotency_keys SET expires_at = $1 WHERE method = $2 AND key = $3`,
+		time.Now().UTC().Add(-time.Minute), key.Method, key.Key)
+	if err != nil {
+		t.Fatalf("expire key: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+func TestIdempotencyKeyClaim(t *testing.T) {
+	db := testDB(t)
+	hash := func(c byte) string {
+		b := make([]byte, 64)
+		for i := range b {
+			b[i] = c
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name         string
+		expired      bool
+		otherCompany bool
+		secondHash   string
+		wantClaimed  bool
+		wantDocument bool
+		wantCode     codes.Code
+	}{
+		{name: "retry with the same request", secondHash: hash('a'), wantClaimed: false, wantDocument: true},
+		{name: "retry with another request", secondHash: hash('b'), wantCode: codes.AlreadyExists},
+		{name: "expired key is claimed again", expired: true, secondHash: hash('b'), wantClaimed: true},
+		{name: "key of another company", otherCompany: true, secondHash: hash('b'), wantClaimed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := companyCtx(uuid.New().String())
+			key := uuid.New().String()
+			documentID := uuid.New().String()
+
+			first := &IdempotencyKey{Key: key, Method: "SalesCreate", RequestHash: hash('a')}
+			if claimed, err := claimKey(t, ctx, db, first, documentID); err != nil || !claimed {
+				t.Fatalf("first claim = %v, %v, want claimed", claimed, err)
+			}
+
+			if tt.expired {
+				expireKey(t, ctx, db, first)
+			}
+			if tt.otherCompany {
+				ctx = companyCtx(uuid.New().String())
+			}
+
+			second := &IdempotencyKey{Key: key, Method: "SalesCreate", RequestHash: tt.secondHash}
+			found, err := second.Get(ctx, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wantFound := !tt.expired && !tt.otherCompany; found != wantFound {
+				t.Errorf("Get found %v, want %v", found, wantFound)
+			}
+
+			// Get load the stored hash, the retry claim with the hash of its own request
+			second.RequestHash = tt.secondHash
+			claimed, err := claimKey(t, ctx, db, second, uuid.New().String())
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("second claim error %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if claimed != tt.wantClaimed {
+				t.Errorf("second claim = %v, want %v", claimed, tt.wantClaimed)
+			}
+			if tt.wantDocument && second.DocumentID != documentID {
+				t.Errorf("second claim document %q, want %q", second.DocumentID, documentID)
+			}
+		})
+	}
+}
+
+// TestIdempotencyKeyConcurrentClaim check a claim wait for the transaction holding the key, then return its document
+func TestIdempotencyKeyConcurrentClaim(t *testing.T) {
+	db := testDB(t)
+	ctx := companyCtx(uuid.New().String())
+	key := uuid.New().String()
+	documentID := uuid.New().String()
+	hash := "0000000000000000000000000000000000000000000000000000000000000000"
+
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	first := &IdempotencyKey{Key: key, Method: "SalesCreate", RequestHash: hash}
+	if claimed, err := first.Claim(ctx, tx); err != nil || !claimed {
+		t.Fatalf("first claim = %v, %v, want claimed", claimed, err)
+	}
+
+	type result struct {
+		claimed    bool
+		documentID string
+		err        error
+	}
+	done := make(chan result, 1)
+	go func() {
+		second := &IdempotencyKey{Key: key, Method: "SalesCreate", RequestHash: hash}
+		tx, err := BeginTx(ctx, db, nil)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer tx.Rollback()
+
+		claimed, err := second.Claim(ctx, tx)
+		done <- result{claimed: claimed, documentID: second.DocumentID, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		t.Fatalf("second claim returned %+v before the first transaction ended", r)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := first.Complete(ctx, tx, documentID); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil || r.claimed || r.documentID != documentID {
+			t.Errorf("second claim = %v, %q, %v, want the document of the first claim", r.claimed, r.documentID, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second claim did not return after the first transaction ended")
+	}
+}
@@ -0,0 +1,291 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	PostingPending  = "pending"
+	PostingInFlight = "posting"
+	PostingPosted   = "posted"
+	PostingFailed   = "failed"
+)
+
+// postingTables is the document table of each document type, its posting_status follow the last posting
+var postingTables = map[string]string{
+	AggregateSales:       "sales",
+	AggregateSalesReturn: "sales_returns",
+}
+
+type JournalPosting struct {
+	Id            string
+	Sequence      int64
+	CompanyID     string
+	BranchID      string
+	DocumentType  string
+	DocumentID    string
+	DocumentCode  string
+	DocumentDate  time.Time
+	Lines         []byte
+	Status        string
+	JournalID     string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	CreatedBy     string
+	PostedAt      sql.NullTime
+}
+
+// Create queue the posting in the transaction of the document
+func (u *JournalPosting) Create(ctx context.Context, tx *sql.Tx) error {
+	table, ok := postingTables[u.DocumentType]
+	if !ok {
+		return status.Errorf(codes.Internal, "unknown posting document %s", u.DocumentType)
+	}
+
+	u.Id = uuid.New().String()
+	u.CompanyID = ctx.Value(app.Ctx("companyID")).(string)
+	u.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.CreatedAt = time.Now().UTC()
+	u.NextAttemptAt = u.CreatedAt
+	u.Status = PostingPending
+
+	query := `
+		INSERT INTO journal_postings (id, company_id, branch_id, document_type, document_id, document_code, document_date, lines, status, next_attempt_at, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING sequence
+	`
+	err := tx.QueryRowContext(ctx, query,
+		u.Id, u.CompanyID, u.BranchID, u.DocumentType, u.DocumentID, u.DocumentCode, u.DocumentDate,
+		string(u.Lines), u.Status, u.NextAttemptAt, u.CreatedAt, u.CreatedBy,
+	).Scan(&u.Sequence)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert journal posting: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET posting_status = $1 WHERE id = $2`, table), u.Status, u.DocumentID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update document posting status: %v", err)
+	}
+
+	return nil
+}
+
+const journalPostingColumns = `id, sequence, company_id, branch_id, document_type, document_id, document_code, document_date, lines,
+	status, journal_id, attempts, last_error, next_attempt_at, created_at, created_by, posted_at`
+
+func scanJournalPosting(rows *sql.Rows) (*JournalPosting, error) {
+	var p JournalPosting
+	var lines string
+	err := rows.Scan(&p.Id, &p.Sequence, &p.CompanyID, &p.BranchID, &p.DocumentType, &p.DocumentID, &p.DocumentCode, &p.DocumentDate, &lines,
+		&p.Status, &p.JournalID, &p.Attempts, &p.LastError, &p.NextAttemptAt, &p.CreatedAt, &p.CreatedBy, &p.PostedAt)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "scan journal posting: %v", err)
+	}
+	p.Lines = []byte(lines)
+	return &p, nil
+}
+
+// DueJournalPostings lock unposted postings which retry time has come, in creation order.
+// Postings locked by another poster are skipped. An in flight posting is due again when its claim expire.
+func DueJournalPostings(ctx context.Context, tx *sql.Tx, limit int) ([]*JournalPosting, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT `+journalPostingColumns+`
+		FROM journal_postings WHERE status <> $1 AND next_attempt_at <= $2
+		ORDER BY sequence LIMIT $3 FOR UPDATE SKIP LOCKED`, PostingPosted, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query due journal postings: %v", err)
+	}
+	defer rows.Close()
+
+	var list []*JournalPosting
+	for rows.Next() {
+		p, err := scanJournalPosting(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "rows journal posting: %v", err)
+	}
+
+	return list, nil
+}
+
+// Previous return the posting of the same document just before this one, nil for the first posting
+func (u *JournalPosting) Previous(ctx context.Context, tx *sql.Tx) (*JournalPosting, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT `+journalPostingColumns+`
+		FROM journal_postings WHERE document_type = $1 AND document_id = $2 AND sequence < $3
+		ORDER BY sequence DESC LIMIT 1`, u.DocumentType, u.DocumentID, u.Sequence)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query previous journal posting: %v", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	return scanJournalPosting(rows)
+}
+
+// ListJournalPostings return every posting of the document of the company in creation order
+func ListJournalPostings(ctx context.Context, db *sql.DB, documentType, documentID string) ([]*JournalPosting, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+journalPostingColumns+`
+		FROM journal_postings WHERE company_id = $1 AND document_type = $2 AND document_id = $3
+		ORDER BY sequence`, ctx.Value(app.Ctx("companyID")).(string), documentType, documentID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query journal postings: %v", err)
+	}
+	defer rows.Close()
+
+	var list []*JournalPosting
+	for rows.Next() {
+		p, err := scanJournalPosting(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "rows journal posting: %v", err)
+	}
+
+	return list, nil
+}
+
+// DocumentPostingStatus return posting_status of the document of the company, the document must be in the branch scope of ctx
+func DocumentPostingStatus(ctx context.Context, db *sql.DB, documentType, documentID string) (string, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	table, ok := postingTables[documentType]
+	if !ok {
+		return "", status.Error(codes.InvalidArgument, "document type must be sales or sales_return")
+	}
+
+	var postingStatus, branchID string
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT posting_status, branch_id FROM %s WHERE id = $1 AND company_id = $2`, table),
+		documentID, ctx.Value(app.Ctx("companyID")).(string)).Scan(&postingStatus, &branchID)
+	if err == sql.ErrNoRows {
+		return "", status.Errorf(codes.NotFound, "Query Raw get posting status: %v", err)
+	}
+
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "Query Raw get posting status: %v", err)
+	}
+
+	err = InBranchScope(ctx, branchID)
+	if err != nil {
+		return "", err
+	}
+
+	return postingStatus, nil
+}
+
+// RetryJournalPostings make unposted postings of the document due now
+func RetryJournalPostings(ctx context.Context, db *sql.DB, documentType, documentID string) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE journal_postings SET next_attempt_at = $1
+		WHERE company_id = $2 AND document_type = $3 AND document_id = $4 AND status <> $5`,
+		time.Now().UTC(), ctx.Value(app.Ctx("companyID")).(string), documentType, documentID, PostingPosted)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec retry journal postings: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// Claim mark the posting in flight until the time given, other posters skip it meanwhile.
+// The status of the document is kept, a poster stopped while posting leave it to be claimed again after until.
+func (u *JournalPosting) Claim(ctx context.Context, tx *sql.Tx, until time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE journal_postings SET status = $1, next_attempt_at = $2 WHERE id = $3`,
+		PostingInFlight, until, u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec claim journal posting: %v", err)
+	}
+
+	return nil
+}
+
+func (u *JournalPosting) MarkPosted(ctx context.Context, tx *sql.Tx, journalID string) error {
+	now := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, `UPDATE journal_postings SET status = $1, journal_id = $2, attempts = attempts + 1, last_error = '', posted_at = $3 WHERE id = $4`,
+		PostingPosted, journalID, now, u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark journal posting posted: %v", err)
+	}
+
+	u.Status = PostingPosted
+	u.JournalID = journalID
+	u.PostedAt = sql.NullTime{Time: now, Valid: true}
+
+	return u.updateDocumentStatus(ctx, tx)
+}
+
+// MarkFailed record the error and retry later with exponential backoff up to one hour
+func (u *JournalPosting) MarkFailed(ctx context.Context, tx *sql.Tx, cause error) error {
+	backoff := time.Hour
+	if u.Attempts < 12 {
+		backoff = time.Duration(1<<uint(u.Attempts)) * time.Second
+		if backoff > time.Hour {
+			backoff = time.Hour
+		}
+	}
+
+	u.Attempts++
+	u.Status = PostingFailed
+	u.LastError = cause.Error()
+	u.NextAttemptAt = time.Now().UTC().Add(backoff)
+
+	_, err := tx.ExecContext(ctx, `UPDATE journal_postings SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4 WHERE id = $5`,
+		u.Status, u.Attempts, u.LastError, u.NextAttemptAt, u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark journal posting failed: %v", err)
+	}
+
+	return u.updateDocumentStatus(ctx, tx)
+}
+
+// updateDocumentStatus copy the status to the document when this is its latest posting
+func (u *JournalPosting) updateDocumentStatus(ctx context.Context, tx *sql.Tx) error {
+	table := postingTables[u.DocumentType]
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET posting_status = $1 WHERE id = $2
+		AND NOT EXISTS (SELECT 1 FROM journal_postings WHERE document_type = $3 AND document_id = $2 AND sequence > $4)`, table),
+		u.Status, u.DocumentID, u.DocumentType, u.Sequence)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update document posting status: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LedgerAccount map posting roles of a company to general ledger account codes
+type LedgerAccount struct {
+	CompanyID     string
+	Revenue       string
+	Receivable    string
+	SalesDiscount string
+	SalesReturn   string
+	TaxPayable    string
+	UpdatedAt     string
+	UpdatedBy     string
+}
+
+// Get load the mapping of CompanyID, a company without mapping get empty account codes.
+// The transaction is bound to CompanyID, not to the company of ctx, so the poster can read it outside of a request.
+func (u *LedgerAccount) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginCompanyTx(ctx, db, nil, u.CompanyID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT revenue, receivable, sales_discount, sales_return, tax_payable, updated_at, updated_by
+		FROM ledger_accounts WHERE company_id = $1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get ledger account: %v", err)
+	}
+	defer stmt.Close()
+
+	var updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, u.CompanyID).Scan(
+		&u.Revenue, &u.Receivable, &u.SalesDiscount, &u.SalesReturn, &u.TaxPayable, &updatedAt, &u.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get ledger account: %v", err)
+	}
+
+	u.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+// Save upsert the mapping of the company of ctx
+func (u *LedgerAccount) Save(ctx context.Context, db *sql.DB) error {
+	u.CompanyID = ctx.Value(app.Ctx("companyID")).(string)
+	tx, err := BeginCompanyTx(ctx, db, nil, u.CompanyID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO ledger_accounts (company_id, revenue, receivable, sales_discount, sales_return, tax_payable, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (company_id) DO UPDATE SET
+			revenue = EXCLUDED.revenue, receivable = EXCLUDED.receivable, sales_discount = EXCLUDED.sales_discount,
+			sales_return = EXCLUDED.sales_return, tax_payable = EXCLUDED.tax_payable,
+			updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement save ledger account: %v", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	u.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	_, err = stmt.ExecContext(ctx,
+		u.CompanyID, u.Revenue, u.Receivable, u.SalesDiscount, u.SalesReturn, u.TaxPayable, now, u.UpdatedBy,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec save ledger account: %v", err)
+	}
+
+	u.UpdatedAt = now.String()
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
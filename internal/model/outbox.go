@@ -0,0 +1,136 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	AggregateSales       = "sales"
+	AggregateSalesReturn = "sales_return"
+
+	EventSalesCreated       = "SalesCreated"
+	EventSalesUpdated       = "SalesUpdated"
+	EventSalesReturnCreated = "SalesReturnCreated"
+	EventSalesReturnUpdated = "SalesReturnUpdated"
+)
+
+type OutboxEvent struct {
+	Id            string
+	Sequence      int64
+	CompanyID     string
+	AggregateType string
+	AggregateID   string
+	EventType     string
+	Payload       []byte
+	CreatedAt     time.Time
+	CreatedBy     string
+	Attempts      int
+}
+
+// NewOutboxEvent build event of the document, payload is marshaled as json
+func NewOutboxEvent(aggregateType, aggregateID, eventType string, payload interface{}) (*OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "marshal event payload: %v", err)
+	}
+
+	return &OutboxEvent{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       data,
+	}, nil
+}
+
+// Create must be called in the same transaction as the document change
+func (u *OutboxEvent) Create(ctx context.Context, tx *sql.Tx) error {
+	u.Id = uuid.New().String()
+	u.CompanyID = ctx.Value(app.Ctx("companyID")).(string)
+	u.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.CreatedAt = time.Now().UTC()
+
+	query := `
+		INSERT INTO outbox_events (id, company_id, aggregate_type, aggregate_id, event_type, payload, next_attempt_at, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8)
+		RETURNING sequence
+	`
+	err := tx.QueryRowContext(ctx, query,
+		u.Id, u.CompanyID, u.AggregateType, u.AggregateID, u.EventType, string(u.Payload), u.CreatedAt, u.CreatedBy,
+	).Scan(&u.Sequence)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert outbox event: %v", err)
+	}
+
+	return nil
+}
+
+// PendingOutboxEvents return unpublished events due to be published in insertion order.
+// An event waiting for its next attempt holds back the later events of its document, a dead event does not.
+func PendingOutboxEvents(ctx context.Context, tx *sql.Tx, limit int) ([]*OutboxEvent, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT e.id, e.sequence, e.company_id, e.aggregate_type, e.aggregate_id, e.event_type, e.payload, e.created_at, e.created_by, e.attempts
+		FROM outbox_events e
+		WHERE e.published_at IS NULL AND e.dead_at IS NULL AND e.next_attempt_at <= $1
+		AND NOT EXISTS (
+			SELECT 1 FROM outbox_events p
+			WHERE p.aggregate_id = e.aggregate_id AND p.sequence < e.sequence
+			AND p.published_at IS NULL AND p.dead_at IS NULL AND p.next_attempt_at > $1)
+		ORDER BY e.sequence LIMIT $2`, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query pending outbox events: %v", err)
+	}
+	defer rows.Close()
+
+	var list []*OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		var payload string
+		err = rows.Scan(&e.Id, &e.Sequence, &e.CompanyID, &e.AggregateType, &e.AggregateID, &e.EventType,
+			&payload, &e.CreatedAt, &e.CreatedBy, &e.Attempts)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "scan outbox event: %v", err)
+		}
+		e.Payload = []byte(payload)
+		list = append(list, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "rows outbox event: %v", err)
+	}
+
+	return list, nil
+}
+
+func (u *OutboxEvent) MarkPublished(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `UPDATE outbox_events SET published_at = $1, attempts = attempts + 1, last_error = '' WHERE id = $2`,
+		time.Now().UTC(), u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark outbox event published: %v", err)
+	}
+
+	return nil
+}
+
+// MarkFailed schedule the next attempt at nextAttempt, or move the event to dead letter when dead is true
+func (u *OutboxEvent) MarkFailed(ctx context.Context, tx *sql.Tx, cause error, nextAttempt time.Time, dead bool) error {
+	var deadAt sql.NullTime
+	if dead {
+		deadAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE outbox_events SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2, dead_at = $3 WHERE id = $4`,
+		cause.Error(), nextAttempt, deadAt, u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark outbox event failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/filter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// timestampLayout keep the microseconds of postgres timestamp in the cursor
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+// Page is how a list is paged.
+// In offset mode (default) Limit and Offset of the pagination are used.
+// In keyset mode the rows after the cursor are returned, the position stay right when rows are inserted between pages.
+type Page struct {
+	Keyset bool
+	// Count run the COUNT(*) of the filter, for the count of the pagination response
+	Count bool
+	// After is the decoded page token, nil on the first page
+	After *Cursor
+
+	limit   uint32
+	orderBy string
+	sort    string
+	sent    uint32
+	last    *Cursor
+	more    bool
+}
+
+// Cursor is the sort key and id of the last row of a page, sent to the client as an opaque token
+type Cursor struct {
+	OrderBy string `json:"o"`
+	Sort    string `json:"s"`
+	Value   string `json:"v"`
+	ID      string `json:"i"`
+}
+
+// NewPage create the offset page, or the keyset page of token when keyset is set. An empty token is the first page.
+func NewPage(keyset bool, token string, count bool) (*Page, error) {
+	p := &Page{Keyset: keyset || len(token) > 0, Count: count}
+	if len(token) == 0 {
+		return p, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid page token")
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.ID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid page token")
+	}
+	p.After = &c
+
+	return p, nil
+}
+
+// Token encode the cursor
+func (c *Cursor) Token() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Next return the token of the page after this one, empty on the last page or in offset mode
+func (p *Page) Next() string {
+	if p == nil || !p.more || p.last == nil {
+		return ""
+	}
+	return p.last.Token()
+}
+
+// Scanned record a row read by the list, with its sortable columns.
+// It return false for the extra row read to know a next page exist, that row must not be sent.
+func (p *Page) Scanned(id string, columns map[string]interface{}) bool {
+	if p == nil || !p.Keyset {
+		return true
+	}
+
+	if p.limit > 0 && p.sent >= p.limit {
+		p.more = true
+		return false
+	}
+
+	p.sent++
+	p.last = &Cursor{OrderBy: p.orderBy, Sort: p.sort, Value: cursorValue(columns[p.orderBy]), ID: id}
+	return true
+}
+
+func cursorValue(v interface{}) string {
+	switch value := v.(type) {
+	case time.Time:
+		return value.Format(timestampLayout)
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// count tell whether ListQuery must run the COUNT(*), always in offset mode unless the caller opt out
+func (p *Page) count() bool {
+	return p == nil || p.Count
+}
+
+// keysetFilter add the condition of the rows after the cursor, the sort field then id in the direction of the sort
+func (p *Page) keysetFilter(where []string, paramQueries []interface{}, orderBy string, field filter.Field, sort sales.Pagination_Direction) ([]string, []interface{}, error) {
+	if p == nil || !p.Keyset {
+		return where, paramQueries, nil
+	}
+
+	p.orderBy = orderBy
+	p.sort = sort.String()
+	if p.After == nil {
+		return where, paramQueries, nil
+	}
+
+	if p.After.OrderBy != p.orderBy || p.After.Sort != p.sort {
+		return where, paramQueries, status.Error(codes.InvalidArgument, "page token is of another order, start again without page token")
+	}
+
+	op := ">"
+	if sort == sales.Pagination_DESC {
+		op = "<"
+	}
+
+	paramQueries = append(paramQueries, p.After.Value, p.After.ID)
+	where = append(where, fmt.Sprintf(`(%s, id) %s ($%d%s, $%d::uuid)`, field.Expr, op, len(paramQueries)-1, field.Cast(), len(paramQueries)))
+
+	return where, paramQueries, nil
+}
+
+// orderAndLimit end the list query with a stable order, id break the ties of the sort field, then the page size.
+// Keyset mode read one more row than the limit to know a next page exist.
+func (p *Page) orderAndLimit(query string, paramQueries []interface{}, field filter.Field, in *sales.Pagination) (string, []interface{}) {
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s`, field.Expr, in.GetSort().String(), in.GetSort().String())
+
+	if p != nil && p.Keyset {
+		p.limit = in.GetLimit()
+		if p.limit > 0 {
+			query += fmt.Sprintf(` LIMIT $%d`, len(paramQueries)+1)
+			paramQueries = append(paramQueries, p.limit+1)
+		}
+		return query, paramQueries
+	}
+
+	if in.GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetLimit(), in.GetOffset())
+	}
+
+	return query, paramQueries
+}
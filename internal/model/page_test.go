@@ -0,0 +1,222 @@
+package model
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/filter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewPage(t *testing.T) {
+	valid := (&Cursor{OrderBy: "code", Sort: "ASC", Value: "SO1", ID: "6c3c8a56-36a4-4a8e-9b0a-0a2f5a0e0d11"}).Token()
+
+	tests := []struct {
+		name       string
+		keyset     bool
+		token      string
+		wantKeyset bool
+		wantAfter  *Cursor
+		wantErr    bool
+	}{
+		{name: "offset", keyset: false, token: "", wantKeyset: false},
+		{name: "first keyset page", keyset: true, token: "", wantKeyset: true},
+		{name: "token imply keyset", keyset: false, token: valid, wantKeyset: true,
+			wantAfter: &Cursor{OrderBy: "code", Sort: "ASC", Value: "SO1", ID: "6c3c8a56-36a4-4a8e-9b0a-0a2f5a0e0d11"}},
+		{name: "not base64", token: "not a token!", wantErr: true},
+		{name: "not json", token: base64.RawURLEncoding.EncodeToString([]byte("code")), wantErr: true},
+		{name: "without id", token: base64.RawURLEncoding.EncodeToString([]byte(`{"o":"code","s":"ASC","v":"SO1"}`)), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPage(tt.keyset, tt.token, false)
+			if tt.wantErr {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("NewPage error %v, want InvalidArgument", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewPage error %v", err)
+			}
+			if p.Keyset != tt.wantKeyset || !reflect.DeepEqual(p.After, tt.wantAfter) {
+				t.Errorf("NewPage = keyset %v after %+v, want keyset %v after %+v", p.Keyset, p.After, tt.wantKeyset, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestPageQuery(t *testing.T) {
+	field := filter.Field{Expr: "created_at", Type: filter.Timestamp}
+	after := &Cursor{OrderBy: "created_at", Sort: "ASC", Value: "2024-01-02 03:04:05.123456", ID: "6c3c8a56-36a4-4a8e-9b0a-0a2f5a0e0d11"}
+
+	tests := []struct {
+		name       string
+		page       *Page
+		pagination *sales.Pagination
+		wantQuery  string
+		wantParams []interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "offset",
+			page:       &Page{},
+			pagination: &sales.Pagination{Limit: 10, Offset: 20},
+			wantQuery:  "SELECT * FROM sales WHERE company_id = $1 ORDER BY created_at ASC, id ASC LIMIT $2 OFFSET $3",
+			wantParams: []interface{}{"company", uint32(10), uint32(20)},
+		},
+		{
+			name:       "offset without limit",
+			page:       nil,
+			pagination: &sales.Pagination{},
+			wantQuery:  "SELECT * FROM sales WHERE company_id = $1 ORDER BY created_at ASC, id ASC",
+			wantParams: []interface{}{"company"},
+		},
+		{
+			name:       "first keyset page read one more row",
+			page:       &Page{Keyset: true},
+			pagination: &sales.Pagination{Limit: 10, Offset: 20},
+			wantQuery:  "SELECT * FROM sales WHERE company_id = $1 ORDER BY created_at ASC, id ASC LIMIT $2",
+			wantParams: []interface{}{"company", uint32(11)},
+		},
+		{
+			name:       "keyset page after cursor",
+			page:       &Page{Keyset: true, After: after},
+			pagination: &sales.Pagination{Limit: 10},
+			wantQuery:  "SELECT * FROM sales WHERE company_id = $1 AND (created_at, id) > ($2::timestamp, $3::uuid) ORDER BY created_at ASC, id ASC LIMIT $4",
+			wantParams: []interface{}{"company", after.Value, after.ID, uint32(11)},
+		},
+		{
+			name:       "keyset page descending",
+			page:       &Page{Keyset: true, After: &Cursor{OrderBy: "created_at", Sort: "DESC", Value: after.Value, ID: after.ID}},
+			pagination: &sales.Pagination{Limit: 10, Sort: sales.Pagination_DESC},
+			wantQuery:  "SELECT * FROM sales WHERE company_id = $1 AND (created_at, id) < ($2::timestamp, $3::uuid) ORDER BY created_at DESC, id DESC LIMIT $4",
+			wantParams: []interface{}{"company", after.Value, after.ID, uint32(11)},
+		},
+		{
+			name:       "token of another order",
+			page:       &Page{Keyset: true, After: &Cursor{OrderBy: "code", Sort: "ASC", Value: "SO1", ID: after.ID}},
+			pagination: &sales.Pagination{Limit: 10},
+			wantErr:    true,
+		},
+		{
+			name:       "token of another direction",
+			page:       &Page{Keyset: true, After: after},
+			pagination: &sales.Pagination{Limit: 10, Sort: sales.Pagination_DESC},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, params, err := tt.page.keysetFilter([]string{"company_id = $1"}, []interface{}{"company"}, "created_at", field, tt.pagination.GetSort())
+			if tt.wantErr {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("keysetFilter error %v, want InvalidArgument", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("keysetFilter error %v", err)
+			}
+
+			query := "SELECT * FROM sales WHERE " + strings.Join(where, " AND ")
+			query, params = tt.page.orderAndLimit(query, params, field, tt.pagination)
+			if query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("params = %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestPageScanned(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	rows := []struct {
+		id      string
+		created time.Time
+	}{
+		{"id-1", created},
+		{"id-2", created.Add(time.Second)},
+		{"id-3", created.Add(2 * time.Second)},
+	}
+
+	tests := []struct {
+		name      string
+		keyset    bool
+		limit     uint32
+		wantSent  int
+		wantToken *Cursor
+	}{
+		{name: "offset send every row", keyset: false, limit: 2, wantSent: 3},
+		{name: "keyset hold back the extra row", keyset: true, limit: 2, wantSent: 2,
+			wantToken: &Cursor{OrderBy: "created_at", Sort: "ASC", Value: "2024-01-02 03:04:06.123456", ID: "id-2"}},
+		{name: "keyset last page", keyset: true, limit: 3, wantSent: 3},
+		{name: "keyset without limit", keyset: true, limit: 0, wantSent: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Page{Keyset: tt.keyset}
+			field := filter.Field{Expr: "created_at", Type: filter.Timestamp}
+			if _, _, err := p.keysetFilter(nil, nil, "created_at", field, sales.Pagination_ASC); err != nil {
+				t.Fatal(err)
+			}
+			p.orderAndLimit("", nil, field, &sales.Pagination{Limit: tt.limit})
+
+			sent := 0
+			for _, row := range rows {
+				if p.Scanned(row.id, map[string]interface{}{"created_at": row.created}) {
+					sent++
+				}
+			}
+			if sent != tt.wantSent {
+				t.Errorf("sent %d rows, want %d", sent, tt.wantSent)
+			}
+
+			token := p.Next()
+			if tt.wantToken == nil {
+				if token != "" {
+					t.Errorf("Next() = %q, want no token", token)
+				}
+				return
+			}
+
+			next, err := NewPage(false, token, false)
+			if err != nil {
+				t.Fatalf("NewPage of Next() error %v", err)
+			}
+			if !reflect.DeepEqual(next.After, tt.wantToken) {
+				t.Errorf("Next() cursor = %+v, want %+v", next.After, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestCursorValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC), "2024-01-02 03:04:05.123456"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "2024-01-02 03:04:05"},
+		{"SO-001", "SO-001"},
+		{float64(1500.25), "1500.25"},
+		{float64(1e21), "1e+21"},
+		{int64(7), "7"},
+	}
+
+	for _, tt := range tests {
+		if got := cursorValue(tt.in); got != tt.want {
+			t.Errorf("cursorValue(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
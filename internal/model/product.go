@@ -3,59 +3,109 @@ package model
 import (
 	"context"
 	"io"
-	"log"
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/logging"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type Product struct {
 	Client inventories.ProductServiceClient
+	Cache  *cache.Cache
 	Pb     *inventories.Product
 	Id     string
 }
 
 func (u *Product) Get(ctx context.Context) error {
+	if cached, ok := u.Cache.Get(ctx, cache.KindProduct, u.Id); ok {
+		u.Pb = cached.(*inventories.Product)
+		return nil
+	}
+
 	product, err := u.Client.View(app.SetMetadata(ctx), &inventories.Id{Id: u.Id})
-	if s, ok := status.FromError(err); ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Product.Get service: %s", err)
+	if err != nil {
+		if cached, ok := u.Cache.Fallback(ctx, cache.KindProduct, u.Id, err); ok {
+			u.Pb = cached.(*inventories.Product)
+			return nil
 		}
 
-		return err
+		return downstreamError(err, "Product.Get")
 	}
 
 	u.Pb = product
+	u.Cache.Set(ctx, cache.KindProduct, u.Id, product)
 
 	return nil
 }
 
+// List return the products of the ids of in, cached products are not requested again
 func (u *Product) List(ctx context.Context, in *inventories.ListProductRequest) ([]*inventories.ListProductResponse, error) {
 	var response []*inventories.ListProductResponse
-	streamClient, err := u.Client.List(app.SetMetadata(ctx), in)
+	var missing []string
+	for _, id := range in.GetIds() {
+		if cached, ok := u.Cache.Get(ctx, cache.KindProduct, id); ok {
+			response = append(response, &inventories.ListProductResponse{Product: cached.(*inventories.Product)})
+		} else {
+			missing = append(missing, id)
+		}
+	}
 
-	if s, ok := status.FromError(err); ok {
-		if s.Code() == codes.Unknown {
-			err = status.Errorf(codes.Internal, "Error when calling Product.List service: %s", err)
+	if len(in.GetIds()) > 0 && len(missing) == 0 {
+		return response, nil
+	}
+
+	if len(missing) < len(in.GetIds()) {
+		in = &inventories.ListProductRequest{Ids: missing}
+	}
+
+	streamClient, err := u.Client.List(app.SetMetadata(ctx), in)
+	if err != nil {
+		if fallback, ok := u.fallback(ctx, missing, err); ok {
+			return append(response, fallback...), nil
 		}
 
-		return response, err
+		return response, downstreamError(err, "Product.List")
 	}
 
+	received := len(response)
 	for {
 		resp, err := streamClient.Recv()
 		if err == io.EOF {
-			log.Print("end stream")
+			logging.FromContext(ctx).Debug("end stream")
 			break
 		}
 		if err != nil {
+			if fallback, ok := u.fallback(ctx, missing, err); ok {
+				return append(response[:received], fallback...), nil
+			}
+
 			return response, status.Errorf(codes.Internal, "cannot receive %v", err)
 		}
 
 		response = append(response, resp)
+		u.Cache.Set(ctx, cache.KindProduct, resp.GetProduct().GetId(), resp.GetProduct())
 	}
 
 	return response, nil
 }
+
+// fallback return the stale cached products of ids when the inventory service is down, false when one is missing
+func (u *Product) fallback(ctx context.Context, ids []string, err error) ([]*inventories.ListProductResponse, bool) {
+	if len(ids) == 0 {
+		return nil, false
+	}
+
+	var response []*inventories.ListProductResponse
+	for _, id := range ids {
+		cached, ok := u.Cache.Fallback(ctx, cache.KindProduct, id, err)
+		if !ok {
+			return nil, false
+		}
+		response = append(response, &inventories.ListProductResponse{Product: cached.(*inventories.Product)})
+	}
+
+	return response, true
+}
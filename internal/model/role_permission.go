@@ -0,0 +1,95 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RolePermission is the permissions granted to a user group (role) of the user service
+type RolePermission struct {
+	GroupID     string
+	Permissions []string
+	UpdatedAt   string
+	UpdatedBy   string
+}
+
+// Get load the permissions of GroupID in the company of ctx, a group without grant get no permission
+func (u *RolePermission) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT permission, updated_at, updated_by FROM role_permissions
+		WHERE company_id = $1 AND group_id = $2
+		ORDER BY permission
+	`
+	rows, err := tx.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), u.GroupID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query role permission: %v", err)
+	}
+	defer rows.Close()
+
+	u.Permissions = nil
+	for rows.Next() {
+		var permission string
+		var updatedAt time.Time
+		err = rows.Scan(&permission, &updatedAt, &u.UpdatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan role permission: %v", err)
+		}
+		u.Permissions = append(u.Permissions, permission)
+		u.UpdatedAt = updatedAt.String()
+	}
+
+	if err := rows.Err(); err != nil {
+		return status.Errorf(codes.Internal, "rows role permission: %v", err)
+	}
+
+	return nil
+}
+
+// Save replace the permissions of GroupID
+func (u *RolePermission) Save(ctx context.Context, db *sql.DB) error {
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	u.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	now := time.Now().UTC()
+
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE company_id = $1 AND group_id = $2`, companyID, u.GroupID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete role permission: %v", err)
+	}
+
+	for _, permission := range u.Permissions {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (company_id, group_id, permission, updated_at, updated_by)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`,
+			companyID, u.GroupID, permission, now, u.UpdatedBy,
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec insert role permission: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	u.UpdatedAt = now.String()
+
+	return nil
+}
@@ -11,19 +11,33 @@ import (
 	"github.com/google/uuid"
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/filter"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type Sales struct {
 	Pb sales.Sales
+	// Version increase on every update, an update with an older version is aborted
+	Version int32
 }
 
 func (u *Sales) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return u.get(ctx, tx)
+}
+
+// get read the sales with its details in the transaction
+func (u *Sales) get(ctx context.Context, tx *sql.Tx) error {
 	query := `
-		SELECT sales.id, sales.company_id, sales.branch_id, sales.branch_name, sales.customer_id, sales.salesman_id, sales.code, 
+		SELECT sales.id, sales.branch_id, sales.branch_name, sales.customer_id, sales.salesman_id, sales.code, 
 		sales.sales_date, sales.remark, sales.price, sales.additional_disc_amount, sales.additional_disc_percentage, sales.total_price,
-		sales.created_at, sales.created_by, sales.updated_at, sales.updated_by,
+		sales.created_at, sales.created_by, sales.updated_at, sales.updated_by, sales.version,
 		json_agg(DISTINCT jsonb_build_object(
 			'id', sales_details.id,
 			'sales_id', sales_details.sales_id,
@@ -36,22 +50,31 @@ func (u *Sales) Get(ctx context.Context, db *sql.DB) error {
 		)) as details
 		FROM sales 
 		JOIN sales_details ON sales.id = sales_details.sales_id
-		WHERE sales.id = $1
+		WHERE sales.id = $1 AND sales.company_id = $2
+		GROUP BY sales.id
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare statement Get sales: %v", err)
 	}
 	defer stmt.Close()
 
+	if u.Pb.Customer == nil {
+		u.Pb.Customer = &sales.Customer{}
+	}
+
+	if u.Pb.Salesman == nil {
+		u.Pb.Salesman = &sales.Salesman{}
+	}
+
 	var dateSales, createdAt, updatedAt time.Time
-	var companyID, details string
-	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.GetCustomer().Id, &u.Pb.GetSalesman().Id,
+	var details string
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(
+		&u.Pb.Id, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.GetCustomer().Id, &u.Pb.GetSalesman().Id,
 		&u.Pb.Code, &dateSales, &u.Pb.Remark,
 		&u.Pb.Price, &u.Pb.AdditionalDiscAmount, &u.Pb.AdditionalDiscPercentage, &u.Pb.TotalPrice,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Version, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -62,8 +85,8 @@ func (u *Sales) Get(ctx context.Context, db *sql.DB) error {
 		return status.Errorf(codes.Internal, "Query Raw get by code sales: %v", err)
 	}
 
-	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
-		return status.Error(codes.Unauthenticated, "its not your company")
+	if err := InBranchScope(ctx, u.Pb.GetBranchId()); err != nil {
+		return err
 	}
 
 	u.Pb.SalesDate = dateSales.String()
@@ -71,14 +94,14 @@ func (u *Sales) Get(ctx context.Context, db *sql.DB) error {
 	u.Pb.UpdatedAt = updatedAt.String()
 
 	detailSales := []struct {
-		ID             string
-		SalesID        string
-		ProductID      string
-		Price          float64
-		DiscAmount     float64
-		DiscPercentage float32
-		Quantity       int
-		TotalPrice     float64
+		ID             string  `json:"id"`
+		SalesID        string  `json:"sales_id"`
+		ProductID      string  `json:"product_id"`
+		Price          float64 `json:"price"`
+		DiscAmount     float64 `json:"disc_amount"`
+		DiscPercentage float32 `json:"disc_percentage"`
+		Quantity       int32   `json:"quantity"`
+		TotalPrice     float64 `json:"total_price"`
 	}{}
 	err = json.Unmarshal([]byte(details), &detailSales)
 	if err != nil {
@@ -93,6 +116,7 @@ func (u *Sales) Get(ctx context.Context, db *sql.DB) error {
 			Price:          detail.Price,
 			DiscAmount:     detail.DiscAmount,
 			DiscPercentage: detail.DiscPercentage,
+			Quantity:       detail.Quantity,
 			TotalPrice:     detail.TotalPrice,
 		})
 	}
@@ -101,13 +125,19 @@ func (u *Sales) Get(ctx context.Context, db *sql.DB) error {
 }
 
 func (u *Sales) GetByCode(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		SELECT id, branch_id, branch_name, customer_id, salesman_id, code, sales_date, remark, 
-			price, additional_disc_amount, additional_disc_percentage, total_price, created_at, created_by, updated_at, updated_by 
+			price, additional_disc_amount, additional_disc_percentage, total_price, created_at, created_by, updated_at, updated_by, version
 		FROM sales WHERE sales.code = $1 AND sales.company_id = $2
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare statement Get by code sales: %v", err)
 	}
@@ -118,7 +148,7 @@ func (u *Sales) GetByCode(ctx context.Context, db *sql.DB) error {
 		&u.Pb.Id, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.GetCustomer().Id, &u.Pb.GetSalesman().Id,
 		&u.Pb.Code, &dateSales, &u.Pb.Remark,
 		&u.Pb.Price, &u.Pb.AdditionalDiscAmount, &u.Pb.AdditionalDiscPercentage, &u.Pb.TotalPrice,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -202,6 +232,12 @@ func (u *Sales) Create(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
+	u.Version = 1
+
+	err = recordAudit(ctx, tx, "sales", u.Pb.GetId(), nil)
+	if err != nil {
+		return err
+	}
 
 	for _, detail := range u.Pb.GetDetails() {
 		salesDetailModel := SalesDetail{}
@@ -244,7 +280,7 @@ func (u *Sales) Create(ctx context.Context, tx *sql.Tx) error {
 func (u *Sales) Update(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
-	dateSales, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetSalesDate())
+	dateSales, err := ParseDate(u.Pb.GetSalesDate())
 	if err != nil {
 		return status.Errorf(codes.Internal, "convert sales date: %v", err)
 	}
@@ -260,16 +296,22 @@ func (u *Sales) Update(ctx context.Context, tx *sql.Tx) error {
 		additional_disc_percentage = $7,
 		total_price = $8,
 		updated_at = $9, 
-		updated_by= $10
-		WHERE id = $11
+		updated_by= $10,
+		version = version + 1
+		WHERE id = $11 AND version = $12
 	`
+	before, err := auditSnapshot(ctx, tx, "sales", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update sales: %v", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	result, err := stmt.ExecContext(ctx,
 		u.Pb.GetCustomer().GetId(),
 		u.Pb.GetSalesman().GetId(),
 		dateSales,
@@ -281,55 +323,67 @@ func (u *Sales) Update(ctx context.Context, tx *sql.Tx) error {
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
+		u.Version,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update sales: %v", err)
 	}
 
+	if err := versionConflict(result, "sales"); err != nil {
+		return err
+	}
+
+	u.Version++
 	u.Pb.UpdatedAt = now.String()
 
+	err = recordAudit(ctx, tx, "sales", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (u *Sales) ListQuery(ctx context.Context, db *sql.DB, in *sales.ListSalesRequest) (string, []interface{}, *sales.SalesPaginationResponse, error) {
+// salesFields are the fields the sales list and export can be filtered on, and the list ordered by
+var salesFields = filter.Schema{
+	"branch_id":     {Expr: "branch_id", Type: filter.ID},
+	"customer_id":   {Expr: "customer_id", Type: filter.ID},
+	"salesman_id":   {Expr: "salesman_id", Type: filter.ID},
+	"created_by":    {Expr: "created_by", Type: filter.ID},
+	"product_id":    {Expr: "EXISTS (SELECT 1 FROM sales_details WHERE sales_details.sales_id = sales.id AND sales_details.product_id %s)", Type: filter.ID},
+	"code":          {Expr: "code", Type: filter.Text, Sortable: true},
+	"remark":        {Expr: "remark", Type: filter.Text},
+	"search":        {Expr: "sales", Type: filter.FullText},
+	"sales_date":    {Expr: "sales_date", Type: filter.Date, Sortable: true},
+	"price":         {Expr: "price", Type: filter.Number},
+	"total_price":   {Expr: "total_price", Type: filter.Number, Sortable: true},
+	"status":        {Expr: "posting_status", Type: filter.Enum, Values: []string{"none", PostingPending, PostingPosted, PostingFailed}},
+	"customer_name": {Expr: "(SELECT name FROM customers WHERE customers.id = sales.customer_id)", Type: filter.Text, Sortable: true},
+	"created_at":    {Expr: "created_at", Type: filter.Timestamp, Sortable: true},
+}
+
+// ListQuery select the sales of the request and of the filter expression, the last column is the customer name
+func (u *Sales) ListQuery(ctx context.Context, tx *sql.Tx, in *sales.ListSalesRequest, page *Page, expr filter.Expression) (string, []interface{}, *sales.SalesPaginationResponse, error) {
 	var paginationResponse sales.SalesPaginationResponse
 	query := `
 		SELECT id, company_id, branch_id, branch_name, customer_id, salesman_id, code, sales_date, remark, 
 			price, additional_disc_amount, additional_disc_percentage, total_price, 
-			created_at, created_by, updated_at, updated_by 
+			created_at, created_by, updated_at, updated_by, ` + salesFields["customer_name"].Expr + `
 		FROM sales
 	`
 
-	where := []string{"company_id = $1"}
-	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
-
-	if len(in.GetBranchId()) > 0 {
-		paramQueries = append(paramQueries, in.GetBranchId())
-		where = append(where, fmt.Sprintf(`branch_id = $%d`, len(paramQueries)))
-	}
-
-	if len(in.GetCustomerId()) > 0 {
-		paramQueries = append(paramQueries, in.GetCustomerId())
-		where = append(where, fmt.Sprintf(`customer_id = $%d`, len(paramQueries)))
-	}
-
-	if len(in.GetSalesmanId()) > 0 {
-		paramQueries = append(paramQueries, in.GetSalesmanId())
-		where = append(where, fmt.Sprintf(`salesman_id = $%d`, len(paramQueries)))
-	}
-
-	if len(in.GetPagination().GetSearch()) > 0 {
-		paramQueries = append(paramQueries, in.GetPagination().GetSearch())
-		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	where, paramQueries, err := u.listFilter(ctx, in, expr)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	{
+	if page.count() {
 		qCount := `SELECT COUNT(*) FROM sales`
 		if len(where) > 0 {
 			qCount += " WHERE " + strings.Join(where, " AND ")
 		}
 		var count int
-		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		err := tx.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
 		if err != nil && err != sql.ErrNoRows {
 			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
 		}
@@ -337,29 +391,56 @@ func (u *Sales) ListQuery(ctx context.Context, db *sql.DB, in *sales.ListSalesRe
 		paginationResponse.Count = uint32(count)
 	}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
+	if in.GetPagination() == nil {
+		in.Pagination = &sales.Pagination{}
+	}
+	if len(in.GetPagination().GetOrderBy()) == 0 {
+		in.GetPagination().OrderBy = "created_at"
 	}
 
-	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "code") {
-		if in.GetPagination() == nil {
-			in.Pagination = &sales.Pagination{OrderBy: "created_at"}
-		} else {
-			in.GetPagination().OrderBy = "created_at"
-		}
+	orderBy, err := salesFields.Sort(in.GetPagination().GetOrderBy())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+	where, paramQueries, err = page.keysetFilter(where, paramQueries, in.GetPagination().GetOrderBy(), orderBy, in.GetPagination().GetSort())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
 
-	if in.GetPagination().GetLimit() > 0 {
-		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
-		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
 	}
 
+	query, paramQueries = page.orderAndLimit(query, paramQueries, orderBy, in.GetPagination())
+
 	return query, paramQueries, &paginationResponse, nil
 }
 
+// listFilter build where conditions of sales header shared by list and export,
+// the fields of the request then the filter expression of the caller
+func (u *Sales) listFilter(ctx context.Context, in *sales.ListSalesRequest, expr filter.Expression) ([]string, []interface{}, error) {
+	where := []string{"company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	where, paramQueries = branchScopeFilter(ctx, where, paramQueries)
+
+	request := filter.Expression{}.
+		Eq("branch_id", in.GetBranchId()).
+		Eq("customer_id", in.GetCustomerId()).
+		Eq("salesman_id", in.GetSalesmanId()).
+		Contains("search", in.GetPagination().GetSearch())
+
+	return append(request, expr...).Where(salesFields, where, paramQueries)
+}
+
 func (u *Sales) OutstandingDetail(ctx context.Context, db *sql.DB, salesReturnId *string) ([]*sales.SalesDetail, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	var list []*sales.SalesDetail
 
 	queryReturn := `
@@ -395,7 +476,7 @@ func (u *Sales) OutstandingDetail(ctx context.Context, db *sql.DB, salesReturnId
 		params = append(params, *salesReturnId)
 	}
 
-	rows, err := db.QueryContext(ctx, query, params...)
+	rows, err := tx.QueryContext(ctx, query, params...)
 	if err != nil {
 		return list, status.Error(codes.Internal, err.Error())
 	}
@@ -419,6 +500,12 @@ func (u *Sales) OutstandingDetail(ctx context.Context, db *sql.DB, salesReturnId
 }
 
 func (u *Sales) GetReturnAdditionalDisc(ctx context.Context, db *sql.DB) (float64, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var returnAdditionalDisc float64
 	query := `
 		SELECT SUM(sales_returns.additional_disc_amount) return_additional_disc
@@ -427,7 +514,7 @@ func (u *Sales) GetReturnAdditionalDisc(ctx context.Context, db *sql.DB) (float6
 		WHERE sales.id = $1
 		GROUP BY sales.id
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return returnAdditionalDisc, status.Errorf(codes.Internal, "Prepare statement Get sales: %v", err)
 	}
@@ -445,3 +532,15 @@ func (u *Sales) GetReturnAdditionalDisc(ctx context.Context, db *sql.DB) (float6
 
 	return returnAdditionalDisc, nil
 }
+
+// ParseDate accept the date format of requests and the format of dates read from database
+func ParseDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range []string{"2006-01-02T15:04:05.000Z", "2006-01-02 15:04:05 -0700 MST", "2006-01-02"} {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
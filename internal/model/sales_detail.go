@@ -18,11 +18,11 @@ type SalesDetail struct {
 
 func (u *SalesDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
-		SELECT purchase_details.id, sales.company_id, purchase_details.purchase_id, purchase_details.product_id, 
-			purchase_details.price, purchase_details.disc_amount, purchase_details.disc_percentage, purchase_details.quantity, purchase_details.total_price
-		FROM purchase_details 
-		JOIN sales ON purchase_details.purchase_id = sales.id
-		WHERE purchase_details.id = $1 AND purchase_details.purchase_id = $2
+		SELECT sales_details.id, sales.company_id, sales_details.sales_id, sales_details.product_id, 
+			sales_details.price, sales_details.disc_amount, sales_details.disc_percentage, sales_details.quantity, sales_details.total_price
+		FROM sales_details 
+		JOIN sales ON sales_details.sales_id = sales.id
+		WHERE sales_details.id = $1 AND sales_details.sales_id = $2
 	`
 
 	stmt, err := tx.PrepareContext(ctx, query)
@@ -54,7 +54,7 @@ func (u *SalesDetail) Get(ctx context.Context, tx *sql.Tx) error {
 func (u *SalesDetail) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	query := `
-		INSERT INTO purchase_details (id, purchase_id, product_id, price, disc_amount, disc_percentage, quantity, total_price) 
+		INSERT INTO sales_details (id, sales_id, product_id, price, disc_amount, disc_percentage, quantity, total_price) 
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
@@ -77,12 +77,17 @@ func (u *SalesDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec insert sales detail: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "sales_details", u.Pb.GetId(), nil)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (u *SalesDetail) Update(ctx context.Context, tx *sql.Tx) error {
 	query := `
-		UPDATE purchase_details
+		UPDATE sales_details
 		SET price = $1,
 			disc_amount = $2,
 			disc_percentage = $3,
@@ -90,6 +95,11 @@ func (u *SalesDetail) Update(ctx context.Context, tx *sql.Tx) error {
 			total_price = $5
 		WHERE id = $6
 	`
+	before, err := auditSnapshot(ctx, tx, "sales_details", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update sales detail: %v", err)
@@ -108,11 +118,21 @@ func (u *SalesDetail) Update(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec insert sales detail: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "sales_details", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (u *SalesDetail) Delete(ctx context.Context, tx *sql.Tx) error {
-	stmt, err := tx.PrepareContext(ctx, `DELETE FROM purchase_details WHERE id = $1 AND purchase_id = $2`)
+	before, err := auditSnapshot(ctx, tx, "sales_details", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM sales_details WHERE id = $1 AND sales_id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete sales detail: %v", err)
 	}
@@ -123,6 +143,11 @@ func (u *SalesDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete sales detail: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "sales_details", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
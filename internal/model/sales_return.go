@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"strings"
 	"time"
 
@@ -12,49 +11,63 @@ import (
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-pkg/util"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/filter"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type SalesReturn struct {
 	Pb sales.SalesReturn
+	// Version increase on every update, an update with an older version is aborted
+	Version int32
 }
 
 func (u *SalesReturn) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		SELECT purchase_returns.id, purchase_returns.company_id, purchase_returns.branch_id, 
-			purchase_returns.branch_name, purchase_returns.purchase_id, purchase_returns.code, 
-			purchase_returns.return_date, purchase_returns.remark, 
-			purchase_returns.price, purchase_returns.additional_disc_amount, purchase_returns.additional_disc_percentage, purchase_returns.total_price,
-			purchase_returns.created_at, purchase_returns.created_by, purchase_returns.updated_at, purchase_returns.updated_by,
+		SELECT sales_returns.id, sales_returns.branch_id, 
+			sales_returns.branch_name, sales_returns.sales_id, sales_returns.code, 
+			sales_returns.return_date, sales_returns.remark, 
+			sales_returns.price, sales_returns.additional_disc_amount, sales_returns.additional_disc_percentage, sales_returns.total_price,
+			sales_returns.created_at, sales_returns.created_by, sales_returns.updated_at, sales_returns.updated_by, sales_returns.version,
 		json_agg(DISTINCT jsonb_build_object(
-			'id', purchase_return_details.id,
-			'purchase_return_id', purchase_return_details.purchase_return_id,
-			'product_id', purchase_return_details.product_id,
-			'quantity', purchase_return_details.quantity,
-			'price', purchase_return_details.price,
-			'disc_amount', purchase_return_details.disc_amount,
-			'disc_percentage', purchase_return_details.disc_percentage,
-			'total_price', purchase_return_details.total_price
+			'id', sales_return_details.id,
+			'sales_return_id', sales_return_details.sales_return_id,
+			'product_id', sales_return_details.product_id,
+			'quantity', sales_return_details.quantity,
+			'price', sales_return_details.price,
+			'disc_amount', sales_return_details.disc_amount,
+			'disc_percentage', sales_return_details.disc_percentage,
+			'total_price', sales_return_details.total_price
 		)) as details
-		FROM purchase_returns 
-		JOIN purchase_return_details ON purchase_returns.id = purchase_return_details.purchase_return_id
-		WHERE purchase_returns.id = $1
+		FROM sales_returns 
+		JOIN sales_return_details ON sales_returns.id = sales_return_details.sales_return_id
+		WHERE sales_returns.id = $1 AND sales_returns.company_id = $2
+		GROUP BY sales_returns.id
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare statement Get sales return: %v", err)
 	}
 	defer stmt.Close()
 
+	if u.Pb.Sales == nil {
+		u.Pb.Sales = &sales.Sales{}
+	}
+
 	var dateReturn, createdAt, updatedAt time.Time
-	var companyID, details string
-	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName,
+	var details string
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(
+		&u.Pb.Id, &u.Pb.BranchId, &u.Pb.BranchName,
 		&u.Pb.Sales.Id, &u.Pb.Code, &dateReturn, &u.Pb.Remark,
 		&u.Pb.Price, &u.Pb.AdditionalDiscAmount, &u.Pb.AdditionalDiscPercentage, &u.Pb.TotalPrice,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Version, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -65,8 +78,8 @@ func (u *SalesReturn) Get(ctx context.Context, db *sql.DB) error {
 		return status.Errorf(codes.Internal, "Query Raw get by code sales return: %v", err)
 	}
 
-	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
-		return status.Error(codes.Unauthenticated, "its not your company")
+	if err := InBranchScope(ctx, u.Pb.GetBranchId()); err != nil {
+		return err
 	}
 
 	u.Pb.ReturnDate = dateReturn.String()
@@ -74,14 +87,14 @@ func (u *SalesReturn) Get(ctx context.Context, db *sql.DB) error {
 	u.Pb.UpdatedAt = updatedAt.String()
 
 	detailSalesReturns := []struct {
-		ID             string
-		SalesReturnID  string
-		ProductID      string
-		Quantity       int32
-		Price          float64
-		DiscAmount     float64
-		DiscPercentage float32
-		TotalPrice     float64
+		ID             string  `json:"id"`
+		SalesReturnID  string  `json:"sales_return_id"`
+		ProductID      string  `json:"product_id"`
+		Quantity       int32   `json:"quantity"`
+		Price          float64 `json:"price"`
+		DiscAmount     float64 `json:"disc_amount"`
+		DiscPercentage float32 `json:"disc_percentage"`
+		TotalPrice     float64 `json:"total_price"`
 	}{}
 	err = json.Unmarshal([]byte(details), &detailSalesReturns)
 	if err != nil {
@@ -105,14 +118,20 @@ func (u *SalesReturn) Get(ctx context.Context, db *sql.DB) error {
 }
 
 func (u *SalesReturn) HasReturn(ctx context.Context, db *sql.DB) (bool, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		SELECT purchase_returns.id
-		FROM purchase_returns 
-		WHERE purchase_returns.purchase_id = $1 
-		LIMIT 0,1
+		SELECT sales_returns.id
+		FROM sales_returns 
+		WHERE sales_returns.sales_id = $1 
+		LIMIT 1
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return false, status.Errorf(codes.Internal, "Prepare statement 'Has Sales Return': %v", err)
 	}
@@ -142,14 +161,14 @@ func (u *SalesReturn) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "convert Date: %v", err)
 	}
 
-	u.Pb.Code, err = util.GetCode(ctx, tx, "purchase_returns", "DR")
+	u.Pb.Code, err = util.GetCode(ctx, tx, "sales_returns", "DR")
 	if err != nil {
 		return err
 	}
 
 	query := `
-		INSERT INTO purchase_returns (
-			id, company_id, branch_id, branch_name, purchase_id, code, return_date, remark, 
+		INSERT INTO sales_returns (
+			id, company_id, branch_id, branch_name, sales_id, code, return_date, remark, 
 			price, additional_disc_amount, additional_disc_percentage, total_price, 
 			created_at, created_by, updated_at, updated_by
 		) 
@@ -185,6 +204,12 @@ func (u *SalesReturn) Create(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
+	u.Version = 1
+
+	err = recordAudit(ctx, tx, "sales_returns", u.Pb.GetId(), nil)
+	if err != nil {
+		return err
+	}
 
 	for _, detail := range u.Pb.GetDetails() {
 		purchaseReturnDetailModel := SalesReturnDetail{}
@@ -226,13 +251,13 @@ func (u *SalesReturn) Create(ctx context.Context, tx *sql.Tx) error {
 func (u *SalesReturn) Update(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
-	dateReturn, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetReturnDate())
+	dateReturn, err := ParseDate(u.Pb.GetReturnDate())
 	if err != nil {
 		return status.Errorf(codes.Internal, "convert sales return date: %v", err)
 	}
 
 	query := `
-		UPDATE purchase_returns SET
+		UPDATE sales_returns SET
 		return_date = $1,
 		remark = $2,
 		price = $3,
@@ -240,16 +265,22 @@ func (u *SalesReturn) Update(ctx context.Context, tx *sql.Tx) error {
 		additional_disc_percentage = $5,
 		total_price = $6,
 		updated_at = $7, 
-		updated_by= $8
-		WHERE id = $9 AND purchase_id = $10
+		updated_by= $8,
+		version = version + 1
+		WHERE id = $9 AND sales_id = $10 AND version = $11
 	`
+	before, err := auditSnapshot(ctx, tx, "sales_returns", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update sales return: %v", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	result, err := stmt.ExecContext(ctx,
 		dateReturn,
 		u.Pb.GetRemark(),
 		u.Pb.Price,
@@ -260,46 +291,63 @@ func (u *SalesReturn) Update(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
 		u.Pb.GetSales().GetId(),
+		u.Version,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update sales return: %v", err)
 	}
 
+	if err := versionConflict(result, "sales return"); err != nil {
+		return err
+	}
+
+	u.Version++
 	u.Pb.UpdatedAt = now.String()
 
+	err = recordAudit(ctx, tx, "sales_returns", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// ListQuery builder
-func (u *SalesReturn) ListQuery(ctx context.Context, db *sql.DB, in *sales.ListSalesReturnRequest) (string, []interface{}, *sales.SalesReturnPaginationResponse, error) {
-	var paginationResponse sales.SalesReturnPaginationResponse
-	query := `SELECT id, company_id, branch_id, branch_name, sales_id, code, return_date, remark, price, additional_disc_amount, additional_disc_percentage, total_price,  created_at, created_by, updated_at, updated_by FROM purchase_returns`
-
-	where := []string{"company_id = $1"}
-	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
-
-	if len(in.GetBranchId()) > 0 {
-		paramQueries = append(paramQueries, in.GetBranchId())
-		where = append(where, fmt.Sprintf(`branch_id = $%d`, len(paramQueries)))
-	}
+// salesReturnFields are the fields the sales return list and export can be filtered on, and the list ordered by
+var salesReturnFields = filter.Schema{
+	"branch_id":     {Expr: "branch_id", Type: filter.ID},
+	"sales_id":      {Expr: "sales_id", Type: filter.ID},
+	"customer_id":   {Expr: "(SELECT customer_id FROM sales WHERE sales.id = sales_returns.sales_id)", Type: filter.ID},
+	"created_by":    {Expr: "created_by", Type: filter.ID},
+	"product_id":    {Expr: "EXISTS (SELECT 1 FROM sales_return_details WHERE sales_return_details.sales_return_id = sales_returns.id AND sales_return_details.product_id %s)", Type: filter.ID},
+	"code":          {Expr: "code", Type: filter.Text, Sortable: true},
+	"remark":        {Expr: "remark", Type: filter.Text},
+	"search":        {Expr: "sales_returns", Type: filter.FullText},
+	"return_date":   {Expr: "return_date", Type: filter.Date, Sortable: true},
+	"price":         {Expr: "price", Type: filter.Number},
+	"total_price":   {Expr: "total_price", Type: filter.Number, Sortable: true},
+	"status":        {Expr: "posting_status", Type: filter.Enum, Values: []string{"none", PostingPending, PostingPosted, PostingFailed}},
+	"customer_name": {Expr: "(SELECT customers.name FROM sales JOIN customers ON customers.id = sales.customer_id WHERE sales.id = sales_returns.sales_id)", Type: filter.Text, Sortable: true},
+	"created_at":    {Expr: "created_at", Type: filter.Timestamp, Sortable: true},
+}
 
-	if len(in.GetSalesId()) > 0 {
-		paramQueries = append(paramQueries, in.GetSalesId())
-		where = append(where, fmt.Sprintf(`sales_id = $%d`, len(paramQueries)))
-	}
+// ListQuery select the sales returns of the request and of the filter expression, the last column is the customer name
+func (u *SalesReturn) ListQuery(ctx context.Context, tx *sql.Tx, in *sales.ListSalesReturnRequest, page *Page, expr filter.Expression) (string, []interface{}, *sales.SalesReturnPaginationResponse, error) {
+	var paginationResponse sales.SalesReturnPaginationResponse
+	query := `SELECT id, company_id, branch_id, branch_name, sales_id, code, return_date, remark, price, additional_disc_amount, additional_disc_percentage, total_price,  created_at, created_by, updated_at, updated_by, ` +
+		salesReturnFields["customer_name"].Expr + ` FROM sales_returns`
 
-	if len(in.GetPagination().GetSearch()) > 0 {
-		paramQueries = append(paramQueries, in.GetPagination().GetSearch())
-		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	where, paramQueries, err := u.listFilter(ctx, in, expr)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	{
+	if page.count() {
 		qCount := `SELECT COUNT(*) FROM sales_returns`
 		if len(where) > 0 {
 			qCount += " WHERE " + strings.Join(where, " AND ")
 		}
 		var count int
-		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		err := tx.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
 		if err != nil && err != sql.ErrNoRows {
 			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
 		}
@@ -307,24 +355,44 @@ func (u *SalesReturn) ListQuery(ctx context.Context, db *sql.DB, in *sales.ListS
 		paginationResponse.Count = uint32(count)
 	}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
+	if in.GetPagination() == nil {
+		in.Pagination = &sales.Pagination{}
+	}
+	if len(in.GetPagination().GetOrderBy()) == 0 {
+		in.GetPagination().OrderBy = "created_at"
 	}
 
-	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "code") {
-		if in.GetPagination() == nil {
-			in.Pagination = &sales.Pagination{OrderBy: "created_at"}
-		} else {
-			in.GetPagination().OrderBy = "created_at"
-		}
+	orderBy, err := salesReturnFields.Sort(in.GetPagination().GetOrderBy())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
 	}
 
-	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+	where, paramQueries, err = page.keysetFilter(where, paramQueries, in.GetPagination().GetOrderBy(), orderBy, in.GetPagination().GetSort())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
 
-	if in.GetPagination().GetLimit() > 0 {
-		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
-		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
 	}
 
+	query, paramQueries = page.orderAndLimit(query, paramQueries, orderBy, in.GetPagination())
+
 	return query, paramQueries, &paginationResponse, nil
 }
+
+// listFilter build where conditions of sales return header shared by list and export,
+// the fields of the request then the filter expression of the caller
+func (u *SalesReturn) listFilter(ctx context.Context, in *sales.ListSalesReturnRequest, expr filter.Expression) ([]string, []interface{}, error) {
+	where := []string{"company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	where, paramQueries = branchScopeFilter(ctx, where, paramQueries)
+
+	request := filter.Expression{}.
+		Eq("branch_id", in.GetBranchId()).
+		Eq("sales_id", in.GetSalesId()).
+		Contains("search", in.GetPagination().GetSearch())
+
+	return append(request, expr...).Where(salesReturnFields, where, paramQueries)
+}
@@ -78,6 +78,11 @@ func (u *SalesReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec insert sales return detail: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "sales_return_details", u.Pb.GetId(), nil)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -88,6 +93,11 @@ func (u *SalesReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
 		total_price = $2
 		WHERE id = $3
 	`
+	before, err := auditSnapshot(ctx, tx, "sales_return_details", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update sales return detail: %v", err)
@@ -103,10 +113,20 @@ func (u *SalesReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec update sales return detail: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "sales_return_details", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (u *SalesReturnDetail) Delete(ctx context.Context, tx *sql.Tx) error {
+	before, err := auditSnapshot(ctx, tx, "sales_return_details", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
 	stmt, err := tx.PrepareContext(ctx, `DELETE FROM sales_return_details WHERE id = $1 AND sales_return_id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete sales return detail: %v", err)
@@ -118,5 +138,10 @@ func (u *SalesReturnDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete sales return detail: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "sales_return_details", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
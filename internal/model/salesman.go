@@ -3,28 +3,37 @@ package model
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/filter"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type Salesman struct {
-	Pb sales.Salesman
+	Pb       sales.Salesman
+	IsActive bool
+	// Version increase on every update, an update with an older version is aborted
+	Version int32
 }
 
 func (u *Salesman) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		SELECT id, company_id, code, name, email, address, phone, created_at, created_by, updated_at, updated_by 
+		SELECT id, company_id, code, name, email, address, phone, created_at, created_by, updated_at, updated_by, is_active, version
 		FROM salesman WHERE id = $1 AND company_id = $2
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare statement Get salesman: %v", err)
 	}
@@ -33,7 +42,7 @@ func (u *Salesman) Get(ctx context.Context, db *sql.DB) error {
 	var companyID string
 	var createdAt, updatedAt time.Time
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Email, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Email, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.IsActive, &u.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -55,12 +64,23 @@ func (u *Salesman) Get(ctx context.Context, db *sql.DB) error {
 }
 
 func (u *Salesman) GetByCode(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return u.GetByCodeTx(ctx, tx)
+}
+
+// GetByCodeTx is GetByCode in the transaction of the caller
+func (u *Salesman) GetByCodeTx(ctx context.Context, tx *sql.Tx) error {
 	query := `
-		SELECT id, company_id, code, name, email, address, phone, created_at, created_by, updated_at, updated_by 
+		SELECT id, company_id, code, name, email, address, phone, created_at, created_by, updated_at, updated_by, is_active, version
 		FROM salesman WHERE company_id = $1 AND code = $2
 	`
 
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare statement Get salesman by code: %v", err)
 	}
@@ -69,7 +89,7 @@ func (u *Salesman) GetByCode(ctx context.Context, db *sql.DB) error {
 	var companyID string
 	var createdAt, updatedAt time.Time
 	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetCode()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Email, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&u.Pb.Id, &companyID, &u.Pb.Code, &u.Pb.Name, &u.Pb.Email, &u.Pb.Address, &u.Pb.Phone, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.IsActive, &u.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -87,6 +107,27 @@ func (u *Salesman) GetByCode(ctx context.Context, db *sql.DB) error {
 }
 
 func (u *Salesman) Create(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = u.CreateTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// CreateTx is Create in the transaction of the caller, it does not commit
+func (u *Salesman) CreateTx(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -96,7 +137,8 @@ func (u *Salesman) Create(ctx context.Context, db *sql.DB) error {
 		INSERT INTO salesman (id, company_id, code, name, email, address, phone, created_at, created_by, updated_at, updated_by) 
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare insert salesman: %v", err)
 	}
@@ -121,11 +163,39 @@ func (u *Salesman) Create(ctx context.Context, db *sql.DB) error {
 
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
+	u.IsActive = true
+	u.Version = 1
+
+	err = recordAudit(ctx, tx, "salesman", u.Pb.GetId(), nil)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
 func (u *Salesman) Update(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = u.UpdateTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// UpdateTx is Update in the transaction of the caller, it does not commit
+func (u *Salesman) UpdateTx(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
@@ -136,16 +206,23 @@ func (u *Salesman) Update(ctx context.Context, db *sql.DB) error {
 		address = $3,
 		phone = $4, 
 		updated_at = $5, 
-		updated_by= $6
-		WHERE id = $7 AND company_id = $8
+		updated_by= $6,
+		version = version + 1
+		WHERE id = $7 AND company_id = $8 AND version = $9
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+
+	before, err := auditSnapshot(ctx, tx, "salesman", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update salesman: %v", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	result, err := stmt.ExecContext(ctx,
 		u.Pb.GetName(),
 		u.Pb.GetEmail(),
 		u.Pb.GetAddress(),
@@ -154,18 +231,40 @@ func (u *Salesman) Update(ctx context.Context, db *sql.DB) error {
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
 		ctx.Value(app.Ctx("companyID")).(string),
+		u.Version,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update salesman: %v", err)
 	}
 
+	if err := versionConflict(result, "salesman"); err != nil {
+		return err
+	}
+
+	u.Version++
 	u.Pb.UpdatedAt = now.String()
 
+	err = recordAudit(ctx, tx, "salesman", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (u *Salesman) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM salesman WHERE company_id = $1 AND id = $2`)
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := auditSnapshot(ctx, tx, "salesman", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM salesman WHERE company_id = $1 AND id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete salesman: %v", err)
 	}
@@ -176,27 +275,111 @@ func (u *Salesman) Delete(ctx context.Context, db *sql.DB) error {
 		return status.Errorf(codes.Internal, "Exec delete salesman: %v", err)
 	}
 
+	err = recordAudit(ctx, tx, "salesman", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (u *Salesman) SetActive(ctx context.Context, db *sql.DB, active bool) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `UPDATE salesman SET is_active = $1, updated_at = $2, updated_by = $3, version = version + 1 WHERE id = $4 AND company_id = $5 RETURNING version`
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	before, err := auditSnapshot(ctx, tx, "salesman", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare set active salesman: %v", err)
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRowContext(ctx, active, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string)).Scan(&u.Version)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec set active salesman: %v", err)
+	}
+
+	u.IsActive = active
+	u.Pb.UpdatedAt = now.String()
+
+	err = recordAudit(ctx, tx, "salesman", u.Pb.GetId(), before)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
 	return nil
 }
 
-func (u *Salesman) ListQuery(ctx context.Context, db *sql.DB, in *sales.Pagination) (string, []interface{}, *sales.SalesmanPaginationResponse, error) {
+// References return the sales and sales returns referencing the salesman, types without reference are left out
+func (u *Salesman) References(ctx context.Context, db *sql.DB, limit int) ([]Reference, error) {
+	return documentReferences(ctx, db, u.Pb.GetId(), limit, map[string]string{
+		"sales": `
+			SELECT code, COUNT(*) OVER() FROM sales
+			WHERE company_id = $1 AND salesman_id = $2
+			ORDER BY created_at LIMIT $3`,
+		"sales return": `
+			SELECT sales_returns.code, COUNT(*) OVER() FROM sales_returns
+			JOIN sales ON sales.id = sales_returns.sales_id
+			WHERE sales_returns.company_id = $1 AND sales.salesman_id = $2
+			ORDER BY sales_returns.created_at LIMIT $3`,
+	})
+}
+
+// salesmanFields are the search and the order by of the salesman list, other order by fall back to created_at
+var salesmanFields = filter.Schema{
+	"search":     filter.Field{Expr: "salesman", Type: filter.FullText},
+	"created_at": filter.Field{Expr: "created_at", Type: filter.Timestamp, Sortable: true},
+	"code":       filter.Field{Expr: "code", Type: filter.Text, Sortable: true},
+	"name":       filter.Field{Expr: "name", Type: filter.Text, Sortable: true},
+	"email":      filter.Field{Expr: "email", Type: filter.Text, Sortable: true},
+}
+
+func (u *Salesman) ListQuery(ctx context.Context, tx *sql.Tx, in *sales.Pagination, activeStatus ActiveStatus, page *Page) (string, []interface{}, *sales.SalesmanPaginationResponse, error) {
 	var paginationResponse sales.SalesmanPaginationResponse
-	query := `SELECT id, company_id, code, name, email, address, phone, created_at, created_by, updated_at, updated_by FROM salesman`
+	query := `SELECT id, company_id, code, name, email, address, phone, created_at, created_by, updated_at, updated_by, is_active FROM salesman`
 	where := []string{"company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
 
-	if len(in.GetSearch()) > 0 {
-		paramQueries = append(paramQueries, "%"+in.GetSearch()+"%")
-		where = append(where, fmt.Sprintf(`(name ILIKE $%d OR code ILIKE $%d OR address ILIKE $%d OR phone ILIKE $%d)`, len(paramQueries), len(paramQueries), len(paramQueries), len(paramQueries)))
+	switch activeStatus {
+	case StatusActive:
+		where = append(where, "is_active = TRUE")
+	case StatusInactive:
+		where = append(where, "is_active = FALSE")
 	}
 
-	{
+	where, paramQueries, err := filter.Expression{}.Contains("search", in.GetSearch()).Where(salesmanFields, where, paramQueries)
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
+
+	if page.count() {
 		qCount := `SELECT COUNT(*) FROM salesman`
 		if len(where) > 0 {
 			qCount += " WHERE " + strings.Join(where, " AND ")
 		}
 		var count int
-		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		err := tx.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
 		if err != nil && err != sql.ErrNoRows {
 			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
 		}
@@ -204,10 +387,6 @@ func (u *Salesman) ListQuery(ctx context.Context, db *sql.DB, in *sales.Paginati
 		paginationResponse.Count = uint32(count)
 	}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
-	}
-
 	if len(in.GetOrderBy()) == 0 || !(in.GetOrderBy() == "name" || in.GetOrderBy() == "code" || in.GetOrderBy() == "email") {
 		if in == nil {
 			in = &sales.Pagination{OrderBy: "created_at"}
@@ -216,12 +395,16 @@ func (u *Salesman) ListQuery(ctx context.Context, db *sql.DB, in *sales.Paginati
 		}
 	}
 
-	query += ` ORDER BY ` + in.GetOrderBy() + ` ` + in.GetSort().String()
+	where, paramQueries, err = page.keysetFilter(where, paramQueries, in.GetOrderBy(), salesmanFields[in.GetOrderBy()], in.GetSort())
+	if err != nil {
+		return query, paramQueries, &paginationResponse, err
+	}
 
-	if in.GetLimit() > 0 {
-		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
-		paramQueries = append(paramQueries, in.GetLimit(), in.GetOffset())
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
 	}
 
+	query, paramQueries = page.orderAndLimit(query, paramQueries, salesmanFields[in.GetOrderBy()], in)
+
 	return query, paramQueries, &paginationResponse, nil
 }
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/sales-service/internal/filter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	SearchCustomer    = "customer"
+	SearchSalesman    = "salesman"
+	SearchSales       = "sales"
+	SearchSalesReturn = "sales_return"
+)
+
+// SearchTypes are the entity types of the global search, in the order of their query
+var SearchTypes = []string{SearchCustomer, SearchSalesman, SearchSales, SearchSalesReturn}
+
+// SearchHit is a row found by the global search.
+// Title is the name of customer and salesman, and the customer name of sales and sales return.
+// Detail is phone and address of customer, email of salesman, date and remark of sales and sales return.
+type SearchHit struct {
+	Type   string
+	ID     string
+	Code   string
+	Title  string
+	Detail string
+	Rank   float64
+}
+
+// SearchQuery select the best hits of q among the types, highest rank first.
+// Sales and sales returns are restricted to the branch scope of ctx.
+func SearchQuery(ctx context.Context, q string, types []string, limit int) (string, []interface{}, error) {
+	tsquery, text, err := filter.Search(q)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// $2 and $3 are the words of q, $4 the limit of every type and of the result
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), tsquery, text, limit}
+
+	var parts []string
+	for _, t := range types {
+		var field filter.Field
+		var columns string
+		where := []string{"company_id = $1"}
+		switch t {
+		case SearchCustomer:
+			field = customerFields["search"]
+			columns = `id, code, name, phone || ' ' || address`
+		case SearchSalesman:
+			field = salesmanFields["search"]
+			columns = `id, code, name, email`
+		case SearchSales:
+			field = salesFields["search"]
+			columns = `id, code, COALESCE(` + salesFields["customer_name"].Expr + `, ''), to_char(sales_date, 'YYYY-MM-DD') || ' ' || remark`
+			where, paramQueries = branchScopeFilter(ctx, where, paramQueries)
+		case SearchSalesReturn:
+			field = salesReturnFields["search"]
+			columns = `id, code, COALESCE(` + salesReturnFields["customer_name"].Expr + `, ''), to_char(return_date, 'YYYY-MM-DD') || ' ' || remark`
+			where, paramQueries = branchScopeFilter(ctx, where, paramQueries)
+		default:
+			return "", nil, status.Errorf(codes.InvalidArgument, "can not search %s, use one of %s", t, strings.Join(SearchTypes, ", "))
+		}
+
+		where = append(where, field.Match("$2", "$3"))
+		parts = append(parts, fmt.Sprintf(`(SELECT '%s' AS type, %s, %s AS rank FROM %s WHERE %s ORDER BY rank DESC LIMIT $4)`,
+			t, columns, field.Rank("$2", "$3"), field.Expr, strings.Join(where, " AND ")))
+	}
+
+	if len(parts) == 0 {
+		return "", nil, status.Error(codes.InvalidArgument, "Please supply type to search")
+	}
+
+	query := strings.Join(parts, " UNION ALL ") + ` ORDER BY rank DESC, type, code LIMIT $4`
+
+	return query, paramQueries, nil
+}
+
+// ScanSearchHit read a row of SearchQuery
+func ScanSearchHit(rows *sql.Rows) (*SearchHit, error) {
+	var hit SearchHit
+	err := rows.Scan(&hit.Type, &hit.ID, &hit.Code, &hit.Title, &hit.Detail, &hit.Rank)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "scan search hit: %v", err)
+	}
+	hit.Code = strings.TrimSpace(hit.Code)
+
+	return &hit, nil
+}
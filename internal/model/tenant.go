@@ -0,0 +1,64 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BeginTx start a transaction bound to the company of ctx.
+// Row level security only show and accept rows of the company inside it, every model query must run in one.
+func BeginTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*sql.Tx, error) {
+	companyID, _ := ctx.Value(app.Ctx("companyID")).(string)
+	if len(companyID) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "company is required")
+	}
+
+	return BeginCompanyTx(ctx, db, opts, companyID)
+}
+
+// BeginCompanyTx start a transaction bound to companyID, for background work done on behalf of a company
+func BeginCompanyTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, companyID string) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `SELECT set_config('app.company_id', $1, true)`, companyID)
+	if err != nil {
+		tx.Rollback()
+		return nil, status.Errorf(codes.Internal, "set company of transaction: %v", err)
+	}
+
+	return tx, nil
+}
+
+// BeginSystemTx start a transaction of background workers seeing every company.
+// db must be connected as the worker role, which bypass row level security (see CheckSystemDB), nothing in the transaction can turn the policies off.
+func BeginSystemTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	return tx, nil
+}
+
+// CheckSystemDB fail when the role of db is subject to row level security, workers on it would see no company
+func CheckSystemDB(ctx context.Context, db *sql.DB) error {
+	var role string
+	var bypass bool
+	err := db.QueryRowContext(ctx, `SELECT current_user, rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&role, &bypass)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query role of workers: %v", err)
+	}
+
+	if !bypass {
+		return status.Errorf(codes.FailedPrecondition, "role %s of workers must have BYPASSRLS", role)
+	}
+
+	return nil
+}
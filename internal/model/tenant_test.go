@@ -0,0 +1,334 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/schema"
+	_ "github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tenantDB open TEST_DATABASE_URL with the migrations applied. The role must be subject to row level security
+// like the service user, the test is skipped without the database or when the role bypass the policies.
+func tenantDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if len(dsn) == 0 {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := schema.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	if err := CheckSystemDB(context.Background(), db); err == nil {
+		t.Skip("the role of TEST_DATABASE_URL bypass row level security")
+	}
+
+	return db
+}
+
+// tenantRows are the documents of a company written by the test
+type tenantRows struct {
+	customer    Customer
+	salesman    Salesman
+	sales       Sales
+	salesReturn SalesReturn
+	posting     JournalPosting
+}
+
+// writeTenantRows create a customer, a salesman, a sales with its return and the journal posting of the sales
+func writeTenantRows(t *testing.T, ctx context.Context, db *sql.DB) *tenantRows {
+	t.Helper()
+
+	unique := strings.ReplaceAll(uuid.New().String(), "-", "")
+	rows := &tenantRows{}
+	rows.customer.Pb = sales.Customer{Code: unique[:10], Name: "Customer " + unique[:20], Address: "Jl. Sudirman 1", Phone: "0211234567"}
+	if err := rows.customer.Create(ctx, db); err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	rows.salesman.Pb = sales.Salesman{Code: unique[:10], Name: "Salesman", Email: unique + "@example.com", Address: "Jl. Thamrin 2", Phone: "0217654321"}
+	if err := rows.salesman.Create(ctx, db); err != nil {
+		t.Fatalf("create salesman: %v", err)
+	}
+
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	date := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	branchID := uuid.New().String()
+	productID := uuid.New().String()
+	rows.sales.Pb = sales.Sales{
+		BranchId: branchID, BranchName: "Jakarta", Customer: &rows.customer.Pb, Salesman: &rows.salesman.Pb,
+		SalesDate: date, Remark: "tenant test", Price: 100, TotalPrice: 100,
+		Details: []*sales.SalesDetail{{ProductId: productID, Price: 100, Quantity: 1, TotalPrice: 100}},
+	}
+	if err := rows.sales.Create(ctx, tx); err != nil {
+		t.Fatalf("create sales: %v", err)
+	}
+
+	rows.salesReturn.Pb = sales.SalesReturn{
+		BranchId: branchID, BranchName: "Jakarta", Sales: &rows.sales.Pb,
+		ReturnDate: date, Remark: "tenant test", Price: 100, TotalPrice: 100,
+		Details: []*sales.SalesReturnDetail{{ProductId: productID, Price: 100, Quantity: 1, TotalPrice: 100}},
+	}
+	if err := rows.salesReturn.Create(ctx, tx); err != nil {
+		t.Fatalf("create sales return: %v", err)
+	}
+
+	rows.posting = JournalPosting{
+		BranchID: branchID, DocumentType: AggregateSales, DocumentID: rows.sales.Pb.GetId(),
+		DocumentCode: rows.sales.Pb.GetCode(), DocumentDate: time.Now().UTC(), Lines: []byte(`[]`),
+	}
+	if err := rows.posting.Create(ctx, tx); err != nil {
+		t.Fatalf("create journal posting: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	return rows
+}
+
+// tables of the rows with their id, read and updated without any company filter
+func (r *tenantRows) tables() []struct{ table, column, id string } {
+	return []struct{ table, column, id string }{
+		{"customers", "id", r.customer.Pb.GetId()},
+		{"salesman", "id", r.salesman.Pb.GetId()},
+		{"sales", "id", r.sales.Pb.GetId()},
+		{"sales_details", "sales_id", r.sales.Pb.GetId()},
+		{"sales_returns", "id", r.salesReturn.Pb.GetId()},
+		{"sales_return_details", "sales_return_id", r.salesReturn.Pb.GetId()},
+		{"journal_postings", "id", r.posting.Id},
+	}
+}
+
+func wantNotFound(t *testing.T, what string, err error) {
+	t.Helper()
+
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("%s of another company: error %v, want NotFound", what, err)
+	}
+}
+
+func TestTenantIsolationRead(t *testing.T) {
+	db := tenantDB(t)
+	ctxA := companyCtx(uuid.New().String())
+	ctxB := companyCtx(uuid.New().String())
+	rows := writeTenantRows(t, ctxA, db)
+
+	// the owner company read its rows, so a miss below is the policy and not the setup
+	customer := Customer{Pb: sales.Customer{Id: rows.customer.Pb.GetId()}}
+	if err := customer.Get(ctxA, db); err != nil {
+		t.Fatalf("get customer of own company: %v", err)
+	}
+	salesModel := Sales{Pb: sales.Sales{Id: rows.sales.Pb.GetId()}}
+	if err := salesModel.Get(ctxA, db); err != nil {
+		t.Fatalf("get sales of own company: %v", err)
+	}
+
+	customer = Customer{Pb: sales.Customer{Id: rows.customer.Pb.GetId()}}
+	wantNotFound(t, "get customer", customer.Get(ctxB, db))
+
+	salesman := Salesman{Pb: sales.Salesman{Id: rows.salesman.Pb.GetId()}}
+	wantNotFound(t, "get salesman", salesman.Get(ctxB, db))
+
+	salesModel = Sales{Pb: sales.Sales{Id: rows.sales.Pb.GetId()}}
+	wantNotFound(t, "get sales", salesModel.Get(ctxB, db))
+
+	salesReturn := SalesReturn{Pb: sales.SalesReturn{Id: rows.salesReturn.Pb.GetId()}}
+	wantNotFound(t, "get sales return", salesReturn.Get(ctxB, db))
+
+	_, err := DocumentPostingStatus(ctxB, db, AggregateSales, rows.sales.Pb.GetId())
+	wantNotFound(t, "posting status", err)
+
+	postings, err := ListJournalPostings(ctxB, db, AggregateSales, rows.sales.Pb.GetId())
+	if err != nil {
+		t.Fatalf("list journal postings: %v", err)
+	}
+	if len(postings) != 0 {
+		t.Errorf("journal postings of another company: got %d, want 0", len(postings))
+	}
+
+	// without company filter in the query, the policy alone hides the rows
+	tx, err := BeginTx(ctxB, db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	for _, r := range rows.tables() {
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM `+r.table+` WHERE `+r.column+` = $1`, r.id).Scan(&count); err != nil {
+			t.Fatalf("count %s: %v", r.table, err)
+		}
+		if count != 0 {
+			t.Errorf("%s of another company: read %d rows, want 0", r.table, count)
+		}
+	}
+}
+
+func TestTenantIsolationUpdate(t *testing.T) {
+	db := tenantDB(t)
+	ctxA := companyCtx(uuid.New().String())
+	ctxB := companyCtx(uuid.New().String())
+	rows := writeTenantRows(t, ctxA, db)
+
+	customer := Customer{Version: rows.customer.Version}
+	customer.Pb = sales.Customer{Id: rows.customer.Pb.GetId(), Code: rows.customer.Pb.GetCode(), Name: "Taken customer",
+		Address: rows.customer.Pb.GetAddress(), Phone: rows.customer.Pb.GetPhone()}
+	if err := customer.Update(ctxB, db); err == nil {
+		t.Error("update customer of another company: no error")
+	}
+
+	salesman := Salesman{Version: rows.salesman.Version}
+	salesman.Pb = sales.Salesman{Id: rows.salesman.Pb.GetId(), Code: rows.salesman.Pb.GetCode(), Name: "Taken salesman",
+		Email: rows.salesman.Pb.GetEmail(), Address: rows.salesman.Pb.GetAddress(), Phone: rows.salesman.Pb.GetPhone()}
+	if err := salesman.Update(ctxB, db); err == nil {
+		t.Error("update salesman of another company: no error")
+	}
+
+	tx, err := BeginTx(ctxB, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	for _, r := range rows.tables() {
+		result, err := tx.Exec(`UPDATE `+r.table+` SET `+r.column+` = `+r.column+` WHERE `+r.column+` = $1`, r.id)
+		if err != nil {
+			t.Fatalf("update %s: %v", r.table, err)
+		}
+		if affected, _ := result.RowsAffected(); affected != 0 {
+			t.Errorf("%s of another company: updated %d rows, want 0", r.table, affected)
+		}
+	}
+
+	// a row can not be written with the company of someone else
+	_, err = tx.Exec(`INSERT INTO customers (id, company_id, code, name, address, phone, created_by, updated_by)
+		VALUES ($1, $2, 'X', $3, 'x', 'x', $4, $4)`,
+		uuid.New().String(), ctxA.Value(app.Ctx("companyID")), uuid.New().String(), uuid.New().String())
+	if err == nil {
+		t.Error("insert customer into another company: no error")
+	}
+	tx.Rollback()
+
+	// the rows of the owner are unchanged
+	own := Customer{Pb: sales.Customer{Id: rows.customer.Pb.GetId()}}
+	if err := own.Get(ctxA, db); err != nil {
+		t.Fatalf("get customer of own company: %v", err)
+	}
+	if own.Pb.GetName() != rows.customer.Pb.GetName() || own.Version != 1 {
+		t.Errorf("customer changed by another company: name %q version %d", own.Pb.GetName(), own.Version)
+	}
+
+	ownSalesman := Salesman{Pb: sales.Salesman{Id: rows.salesman.Pb.GetId()}}
+	if err := ownSalesman.Get(ctxA, db); err != nil {
+		t.Fatalf("get salesman of own company: %v", err)
+	}
+	if ownSalesman.Pb.GetName() != rows.salesman.Pb.GetName() || ownSalesman.Version != 1 {
+		t.Errorf("salesman changed by another company: name %q version %d", ownSalesman.Pb.GetName(), ownSalesman.Version)
+	}
+}
+
+func TestTenantIsolationList(t *testing.T) {
+	db := tenantDB(t)
+	ctxA := companyCtx(uuid.New().String())
+	ctxB := companyCtx(uuid.New().String())
+	writeTenantRows(t, ctxA, db)
+
+	tests := []struct {
+		name  string
+		query func(ctx context.Context, tx *sql.Tx, page *Page) (string, []interface{}, uint32, error)
+	}{
+		{"customers", func(ctx context.Context, tx *sql.Tx, page *Page) (string, []interface{}, uint32, error) {
+			var u Customer
+			query, params, res, err := u.ListQuery(ctx, tx, &sales.Pagination{}, StatusAll, page)
+			return query, params, res.GetCount(), err
+		}},
+		{"salesman", func(ctx context.Context, tx *sql.Tx, page *Page) (string, []interface{}, uint32, error) {
+			var u Salesman
+			query, params, res, err := u.ListQuery(ctx, tx, &sales.Pagination{}, StatusAll, page)
+			return query, params, res.GetCount(), err
+		}},
+		{"sales", func(ctx context.Context, tx *sql.Tx, page *Page) (string, []interface{}, uint32, error) {
+			var u Sales
+			query, params, res, err := u.ListQuery(ctx, tx, &sales.ListSalesRequest{}, page, nil)
+			return query, params, res.GetCount(), err
+		}},
+		{"sales returns", func(ctx context.Context, tx *sql.Tx, page *Page) (string, []interface{}, uint32, error) {
+			var u SalesReturn
+			query, params, res, err := u.ListQuery(ctx, tx, &sales.ListSalesReturnRequest{}, page, nil)
+			return query, params, res.GetCount(), err
+		}},
+	}
+
+	list := func(t *testing.T, ctx context.Context, query func(context.Context, *sql.Tx, *Page) (string, []interface{}, uint32, error)) (int, uint32) {
+		t.Helper()
+
+		tx, err := BeginTx(ctx, db, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		page, err := NewPage(false, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, params, count, err := query(ctx, tx, page)
+		if err != nil {
+			t.Fatalf("list query: %v", err)
+		}
+
+		result, err := tx.Query(q, params...)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		defer result.Close()
+
+		n := 0
+		for result.Next() {
+			n++
+		}
+		if err := result.Err(); err != nil {
+			t.Fatalf("list rows: %v", err)
+		}
+
+		return n, count
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n, count := list(t, ctxA, tt.query); n != 1 || count != 1 {
+				t.Fatalf("list of own company: %d rows count %d, want 1", n, count)
+			}
+
+			if n, count := list(t, ctxB, tt.query); n != 0 || count != 0 {
+				t.Errorf("list of another company: %d rows count %d, want 0", n, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookEventTypes is the list of events a subscription can choose, "*" subscribe to all of them
+var WebhookEventTypes = []string{
+	EventSalesCreated,
+	EventSalesUpdated,
+	EventSalesReturnCreated,
+	EventSalesReturnUpdated,
+}
+
+type WebhookSubscription struct {
+	Id         string
+	CompanyID  string
+	Url        string
+	EventTypes []string
+	Secret     string
+	IsActive   bool
+	CreatedAt  string
+	CreatedBy  string
+	UpdatedAt  string
+	UpdatedBy  string
+}
+
+type WebhookDelivery struct {
+	Id             string
+	SubscriptionID string
+	CompanyID      string
+	EventID        string
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	ResponseCode   int
+	LastError      string
+	NextAttemptAt  time.Time
+	CreatedAt      time.Time
+	DeliveredAt    sql.NullTime
+	// Url and Secret of the subscription, filled by DueWebhookDeliveries
+	Url    string
+	Secret string
+}
+
+func (u *WebhookSubscription) Get(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, company_id, url, event_types, secret, is_active, created_at, created_by, updated_at, updated_by
+		FROM webhook_subscriptions WHERE id = $1 AND company_id = $2
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get webhook subscription: %v", err)
+	}
+	defer stmt.Close()
+
+	var eventTypes string
+	var createdAt, updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, u.Id, ctx.Value(app.Ctx("companyID")).(string)).Scan(
+		&u.Id, &u.CompanyID, &u.Url, &eventTypes, &u.Secret, &u.IsActive, &createdAt, &u.CreatedBy, &updatedAt, &u.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get webhook subscription: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get webhook subscription: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(eventTypes), &u.EventTypes); err != nil {
+		return status.Errorf(codes.Internal, "unmarshal webhook event types: %v", err)
+	}
+
+	u.CreatedAt = createdAt.String()
+	u.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+func (u *WebhookSubscription) Create(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	u.Id = uuid.New().String()
+	u.CompanyID = ctx.Value(app.Ctx("companyID")).(string)
+	u.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.UpdatedBy = u.CreatedBy
+	u.IsActive = true
+	now := time.Now().UTC()
+
+	eventTypes, err := json.Marshal(u.EventTypes)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal webhook event types: %v", err)
+	}
+
+	query := `
+		INSERT INTO webhook_subscriptions (id, company_id, url, event_types, secret, is_active, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert webhook subscription: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Id, u.CompanyID, u.Url, string(eventTypes), u.Secret, u.IsActive, now, u.CreatedBy, now, u.UpdatedBy)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert webhook subscription: %v", err)
+	}
+
+	u.CreatedAt = now.String()
+	u.UpdatedAt = u.CreatedAt
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (u *WebhookSubscription) Update(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	u.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	now := time.Now().UTC()
+
+	eventTypes, err := json.Marshal(u.EventTypes)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal webhook event types: %v", err)
+	}
+
+	query := `
+		UPDATE webhook_subscriptions SET url = $1, event_types = $2, secret = $3, is_active = $4, updated_at = $5, updated_by = $6
+		WHERE id = $7 AND company_id = $8
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare update webhook subscription: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Url, string(eventTypes), u.Secret, u.IsActive, now, u.UpdatedBy, u.Id, ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update webhook subscription: %v", err)
+	}
+
+	u.UpdatedAt = now.String()
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (u *WebhookSubscription) Delete(ctx context.Context, db *sql.DB) error {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1 AND company_id = $2`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete webhook subscription: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Id, ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete webhook subscription: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// ListWebhookSubscriptions return subscriptions of the company
+func ListWebhookSubscriptions(ctx context.Context, db *sql.DB) ([]*WebhookSubscription, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, company_id, url, event_types, secret, is_active, created_at, created_by, updated_at, updated_by
+		FROM webhook_subscriptions WHERE company_id = $1 ORDER BY created_at`,
+		ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query webhook subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var list []*WebhookSubscription
+	for rows.Next() {
+		var s WebhookSubscription
+		var eventTypes string
+		var createdAt, updatedAt time.Time
+		err = rows.Scan(&s.Id, &s.CompanyID, &s.Url, &eventTypes, &s.Secret, &s.IsActive, &createdAt, &s.CreatedBy, &updatedAt, &s.UpdatedBy)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "scan webhook subscription: %v", err)
+		}
+
+		if err := json.Unmarshal([]byte(eventTypes), &s.EventTypes); err != nil {
+			return nil, status.Errorf(codes.Internal, "unmarshal webhook event types: %v", err)
+		}
+
+		s.CreatedAt = createdAt.String()
+		s.UpdatedAt = updatedAt.String()
+		list = append(list, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "rows webhook subscription: %v", err)
+	}
+
+	return list, nil
+}
+
+// EnqueueWebhookDeliveries create a delivery of the event for every active subscription of the company interested in it.
+// Enqueue the same event again does nothing.
+func EnqueueWebhookDeliveries(ctx context.Context, db *sql.DB, companyID, eventID, eventType string, payload []byte) error {
+	tx, err := BeginCompanyTx(ctx, db, nil, companyID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM webhook_subscriptions
+		WHERE company_id = $1 AND is_active = TRUE
+			AND (event_types @> jsonb_build_array($2::text) OR event_types @> '["*"]'::jsonb)`,
+		companyID, eventType)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query webhook subscriptions of event: %v", err)
+	}
+	defer rows.Close()
+
+	var subscriptionIds []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return status.Errorf(codes.Internal, "scan webhook subscription id: %v", err)
+		}
+		subscriptionIds = append(subscriptionIds, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return status.Errorf(codes.Internal, "rows webhook subscription id: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for _, subscriptionID := range subscriptionIds {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (id, subscription_id, company_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+			ON CONFLICT (subscription_id, event_id) DO NOTHING`,
+			uuid.New().String(), subscriptionID, companyID, eventID, eventType, string(payload), DeliveryPending, now)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec enqueue webhook delivery: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+const webhookDeliveryColumns = `d.id, d.subscription_id, d.company_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.response_code, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at, s.url, s.secret`
+
+func scanWebhookDelivery(rows *sql.Rows) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload string
+	err := rows.Scan(&d.Id, &d.SubscriptionID, &d.CompanyID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt, &d.Url, &d.Secret)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "scan webhook delivery: %v", err)
+	}
+	d.Payload = []byte(payload)
+	return &d, nil
+}
+
+// DueWebhookDeliveries lock pending deliveries which retry time has come, other dispatchers skip them.
+// A claimed delivery is due again when its claim expire.
+func DueWebhookDeliveries(ctx context.Context, tx *sql.Tx, limit int) ([]*WebhookDelivery, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = $1 AND d.next_attempt_at <= $2
+		ORDER BY d.next_attempt_at LIMIT $3
+		FOR UPDATE OF d SKIP LOCKED`, DeliveryPending, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query due webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var list []*WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "rows webhook delivery: %v", err)
+	}
+
+	return list, nil
+}
+
+// ListDeadWebhookDeliveries return dead deliveries of the company, of one subscription when subscriptionID is not empty
+func ListDeadWebhookDeliveries(ctx context.Context, db *sql.DB, subscriptionID string) ([]*WebhookDelivery, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.company_id = $1 AND d.status = $2`
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), DeliveryDead}
+	if len(subscriptionID) > 0 {
+		query += ` AND d.subscription_id = $3`
+		paramQueries = append(paramQueries, subscriptionID)
+	}
+	query += ` ORDER BY d.created_at`
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query dead webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var list []*WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "rows webhook delivery: %v", err)
+	}
+
+	return list, nil
+}
+
+// ReplayWebhookDeliveries queue deliveries again from the first attempt.
+// Without deliveryIds every dead delivery of the subscription is replayed.
+func ReplayWebhookDeliveries(ctx context.Context, db *sql.DB, subscriptionID string, deliveryIds []string) (int64, error) {
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE webhook_deliveries SET status = $1, attempts = 0, last_error = '', next_attempt_at = $2
+		WHERE company_id = $3 AND subscription_id = $4`
+	paramQueries := []interface{}{DeliveryPending, time.Now().UTC(), ctx.Value(app.Ctx("companyID")).(string), subscriptionID}
+
+	if len(deliveryIds) > 0 {
+		ids, err := json.Marshal(deliveryIds)
+		if err != nil {
+			return 0, status.Errorf(codes.Internal, "marshal delivery ids: %v", err)
+		}
+		query += ` AND id::text IN (SELECT jsonb_array_elements_text($5::jsonb))`
+		paramQueries = append(paramQueries, string(ids))
+	} else {
+		query += ` AND status = $5`
+		paramQueries = append(paramQueries, DeliveryDead)
+	}
+
+	result, err := tx.ExecContext(ctx, query, paramQueries...)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Exec replay webhook deliveries: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Claim move the next attempt to until, so other dispatchers skip the delivery while it is sent after the commit.
+// A dispatcher stopped while sending leave it to be sent again after until.
+func (u *WebhookDelivery) Claim(ctx context.Context, tx *sql.Tx, until time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = $2`, until, u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec claim webhook delivery: %v", err)
+	}
+
+	return nil
+}
+
+func (u *WebhookDelivery) MarkDelivered(ctx context.Context, tx *sql.Tx, responseCode int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = $2, last_error = '', delivered_at = $3 WHERE id = $4`,
+		DeliveryDelivered, responseCode, time.Now().UTC(), u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark webhook delivery delivered: %v", err)
+	}
+
+	return nil
+}
+
+// MarkFailed schedule the next attempt at nextAttempt, or move the delivery to dead letter when dead is true
+func (u *WebhookDelivery) MarkFailed(ctx context.Context, tx *sql.Tx, responseCode int, cause error, nextAttempt time.Time, dead bool) error {
+	deliveryStatus := DeliveryPending
+	if dead {
+		deliveryStatus = DeliveryDead
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = $2, last_error = $3, next_attempt_at = $4 WHERE id = $5`,
+		deliveryStatus, responseCode, cause.Error(), nextAttempt, u.Id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark webhook delivery failed: %v", err)
+	}
+
+	return nil
+}
@@ -1,18 +1,26 @@
 package route
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"log/slog"
+	"os"
+	"time"
 
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/auth"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/ledger"
+	"github.com/jacky-htg/sales-service/internal/rpc"
 	"github.com/jacky-htg/sales-service/internal/service"
 	"google.golang.org/grpc"
 )
 
-// GrpcRoute func
-func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *grpc.ClientConn, inventoryConn *grpc.ClientConn) {
+// GrpcRoute func, grpcServer can be gateway.Registrars to serve the services on the http gateway too.
+// workerDb is the connection of the background poster, its role bypass row level security.
+func GrpcRoute(ctx context.Context, grpcServer grpc.ServiceRegistrar, db *sql.DB, workerDb *sql.DB, logger *slog.Logger, userConn *grpc.ClientConn, inventoryConn *grpc.ClientConn, ledgerConn *grpc.ClientConn, authorizer *auth.Authorizer, lookupCache *cache.Cache) {
 	purchaseServer := service.Sales{
 		Db:             db,
 		UserClient:     users.NewUserServiceClient((userConn)),
@@ -20,6 +28,7 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *g
 		BranchClient:   users.NewBranchServiceClient(userConn),
 		ProductClient:  inventories.NewProductServiceClient(inventoryConn),
 		DeliveryClient: inventories.NewDeliveryServiceClient(inventoryConn),
+		Cache:          lookupCache,
 	}
 	sales.RegisterSalesServiceServer(grpcServer, &purchaseServer)
 
@@ -29,6 +38,7 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *g
 		RegionClient:   users.NewRegionServiceClient(userConn),
 		BranchClient:   users.NewBranchServiceClient(userConn),
 		DeliveryClient: inventories.NewDeliveryServiceClient(inventoryConn),
+		Cache:          lookupCache,
 	}
 	sales.RegisterSalesReturnServiceServer(grpcServer, &purchaseReturnServer)
 
@@ -36,9 +46,84 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log *log.Logger, userConn *g
 		Db: db,
 	}
 	sales.RegisterCustomerServiceServer(grpcServer, &customerServer)
+	rpc.RegisterCustomerStatusServiceServer(grpcServer, &customerServer)
+	rpc.RegisterCustomerMergeServiceServer(grpcServer, &customerServer)
 
 	salesmanServer := service.Salesman{
 		Db: db,
 	}
 	sales.RegisterSalesmanServiceServer(grpcServer, &salesmanServer)
+	rpc.RegisterSalesmanStatusServiceServer(grpcServer, &salesmanServer)
+
+	importServer := service.Import{
+		Db: db,
+	}
+	rpc.RegisterImportServiceServer(grpcServer, &importServer)
+
+	exportServer := service.Export{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		Cache:        lookupCache,
+	}
+	rpc.RegisterExportServiceServer(grpcServer, &exportServer)
+
+	documentServer := service.Document{
+		Db:            db,
+		ProductClient: inventories.NewProductServiceClient(inventoryConn),
+		UserClient:    users.NewUserServiceClient(userConn),
+		RegionClient:  users.NewRegionServiceClient(userConn),
+		Cache:         lookupCache,
+	}
+	rpc.RegisterDocumentServiceServer(grpcServer, &documentServer)
+
+	webhookServer := service.Webhook{
+		Db:       db,
+		Insecure: os.Getenv("WEBHOOK_INSECURE") == "true",
+	}
+	rpc.RegisterWebhookServiceServer(grpcServer, &webhookServer)
+
+	postingServer := service.Posting{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		Cache:        lookupCache,
+	}
+	rpc.RegisterPostingServiceServer(grpcServer, &postingServer)
+
+	auditServer := service.Audit{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		Cache:        lookupCache,
+	}
+	rpc.RegisterAuditServiceServer(grpcServer, &auditServer)
+
+	searchServer := service.Search{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		Cache:        lookupCache,
+	}
+	rpc.RegisterSearchServiceServer(grpcServer, &searchServer)
+
+	cacheServer := service.Cache{
+		Cache: lookupCache,
+	}
+	rpc.RegisterCacheServiceServer(grpcServer, &cacheServer)
+
+	permissionServer := service.Permission{
+		Db:         db,
+		Authorizer: authorizer,
+	}
+	rpc.RegisterPermissionServiceServer(grpcServer, &permissionServer)
+
+	// post queued journals of sales and sales returns to the general ledger until ctx is done
+	poster := ledger.Poster{
+		Db:       workerDb,
+		Client:   ledger.NewClient(ledgerConn, os.Getenv("LEDGER_TOKEN")),
+		Log:      logger,
+		Interval: 5 * time.Second,
+	}
+	go poster.Run(ctx)
 }
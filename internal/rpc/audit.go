@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"google.golang.org/grpc"
+)
+
+type AuditListRequest struct {
+	// DocumentId is the id of sales, sales return, customer or salesman, details are listed with their document
+	DocumentId string `json:"document_id"`
+	// UserId list the changes made by the user
+	UserId string `json:"user_id"`
+	// EntityType is sales, sales_detail, sales_return, sales_return_detail, customer or salesman
+	EntityType string `json:"entity_type"`
+	// DateFrom and DateTo are inclusive dates in YYYY-MM-DD
+	DateFrom string `json:"date_from"`
+	DateTo   string `json:"date_to"`
+	Limit    int    `json:"limit"`
+}
+
+type AuditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type AuditLog struct {
+	Id         string `json:"id"`
+	EntityType string `json:"entity_type"`
+	EntityId   string `json:"entity_id"`
+	DocumentId string `json:"document_id"`
+	// Action is insert, update or delete
+	Action    string         `json:"action"`
+	Changes   []*AuditChange `json:"changes"`
+	CreatedAt string         `json:"created_at"`
+	CreatedBy string         `json:"created_by"`
+}
+
+type AuditServiceServer interface {
+	AuditList(*AuditListRequest, ServerStream[AuditLog]) error
+}
+
+const AuditServiceName = "sales.AuditService"
+
+var AuditService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: AuditServiceName,
+	HandlerType: (*AuditServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		serverStreaming("AuditList", AuditServiceServer.AuditList),
+	},
+	Metadata: "internal/rpc/audit.go",
+}
+
+func RegisterAuditServiceServer(s grpc.ServiceRegistrar, srv AuditServiceServer) {
+	s.RegisterService(&AuditService_ServiceDesc, srv)
+}
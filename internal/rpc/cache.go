@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type CacheInvalidateRequest struct {
+	// Kind is user, region, branch, branches or product
+	Kind string `json:"kind"`
+	// Id of the cached value, every value of the kind when it is empty
+	Id string `json:"id,omitempty"`
+}
+
+type CacheStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+	Entries int     `json:"entries"`
+	// Fallbacks count stale values returned while a service was down
+	Fallbacks uint64 `json:"fallbacks"`
+}
+
+type CacheServiceServer interface {
+	CacheInvalidate(context.Context, *CacheInvalidateRequest) (*Empty, error)
+	CacheStats(context.Context, *Empty) (*CacheStats, error)
+}
+
+const CacheServiceName = "sales.CacheService"
+
+var CacheService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: CacheServiceName,
+	HandlerType: (*CacheServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(CacheServiceName, "CacheInvalidate", CacheServiceServer.CacheInvalidate),
+		unary(CacheServiceName, "CacheStats", CacheServiceServer.CacheStats),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/rpc/cache.go",
+}
+
+func RegisterCacheServiceServer(s grpc.ServiceRegistrar, srv CacheServiceServer) {
+	s.RegisterService(&CacheService_ServiceDesc, srv)
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"google.golang.org/grpc"
+)
+
+type FindCustomerDuplicatesRequest struct {
+	// CustomerId limit the result to duplicates of this customer, empty means all customers of the company
+	CustomerId string `json:"customer_id"`
+	// Threshold minimum name similarity between 0 and 1
+	Threshold float64 `json:"threshold"`
+}
+
+type CustomerDuplicate struct {
+	Customer  *sales.Customer `json:"customer"`
+	Candidate *sales.Customer `json:"candidate"`
+	Score     float64         `json:"score"`
+	Reasons   []string        `json:"reasons"`
+}
+
+type MergeCustomerRequest struct {
+	SurvivorId  string `json:"survivor_id"`
+	DuplicateId string `json:"duplicate_id"`
+}
+
+type CustomerMergeResponse struct {
+	Id          string          `json:"id"`
+	Survivor    *sales.Customer `json:"survivor"`
+	DuplicateId string          `json:"duplicate_id"`
+	MovedSales  []string        `json:"moved_sales"`
+	CreatedAt   string          `json:"created_at"`
+	CreatedBy   string          `json:"created_by"`
+}
+
+type CustomerMergeServiceServer interface {
+	CustomerFindDuplicates(*FindCustomerDuplicatesRequest, ServerStream[CustomerDuplicate]) error
+	CustomerMerge(context.Context, *MergeCustomerRequest) (*CustomerMergeResponse, error)
+}
+
+const CustomerMergeServiceName = "sales.CustomerMergeService"
+
+var CustomerMergeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: CustomerMergeServiceName,
+	HandlerType: (*CustomerMergeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(CustomerMergeServiceName, "CustomerMerge", CustomerMergeServiceServer.CustomerMerge),
+	},
+	Streams: []grpc.StreamDesc{
+		serverStreaming("CustomerFindDuplicates", CustomerMergeServiceServer.CustomerFindDuplicates),
+	},
+	Metadata: "internal/rpc/customer_merge.go",
+}
+
+func RegisterCustomerMergeServiceServer(s grpc.ServiceRegistrar, srv CustomerMergeServiceServer) {
+	s.RegisterService(&CustomerMergeService_ServiceDesc, srv)
+}
@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"google.golang.org/grpc"
+)
+
+type ListByStatusRequest struct {
+	Pagination *sales.Pagination `json:"pagination"`
+	// Status is one of active, inactive or all. Default is active
+	Status string `json:"status"`
+}
+
+type CustomerStatus struct {
+	Customer *sales.Customer `json:"customer"`
+	IsActive bool            `json:"is_active"`
+	Version  int32           `json:"version"`
+}
+
+type ListCustomerStatusResponse struct {
+	Pagination *sales.CustomerPaginationResponse `json:"pagination"`
+	Customer   *sales.Customer                   `json:"customer"`
+	IsActive   bool                              `json:"is_active"`
+}
+
+type CustomerStatusServiceServer interface {
+	CustomerDeactivate(context.Context, *sales.Id) (*CustomerStatus, error)
+	CustomerReactivate(context.Context, *sales.Id) (*CustomerStatus, error)
+	CustomerListByStatus(*ListByStatusRequest, ServerStream[ListCustomerStatusResponse]) error
+}
+
+const CustomerStatusServiceName = "sales.CustomerStatusService"
+
+var CustomerStatusService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: CustomerStatusServiceName,
+	HandlerType: (*CustomerStatusServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(CustomerStatusServiceName, "CustomerDeactivate", CustomerStatusServiceServer.CustomerDeactivate),
+		unary(CustomerStatusServiceName, "CustomerReactivate", CustomerStatusServiceServer.CustomerReactivate),
+	},
+	Streams: []grpc.StreamDesc{
+		serverStreaming("CustomerListByStatus", CustomerStatusServiceServer.CustomerListByStatus),
+	},
+	Metadata: "internal/rpc/customer_status.go",
+}
+
+func RegisterCustomerStatusServiceServer(s grpc.ServiceRegistrar, srv CustomerStatusServiceServer) {
+	s.RegisterService(&CustomerStatusService_ServiceDesc, srv)
+}
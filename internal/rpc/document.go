@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type Empty struct{}
+
+type DocumentTemplate struct {
+	// Logo is a png or jpeg image
+	Logo      []byte `json:"logo"`
+	Header    string `json:"header"`
+	Footer    string `json:"footer"`
+	Terms     string `json:"terms"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty"`
+}
+
+type RenderDocumentRequest struct {
+	// Document is sales_order, delivery_note or sales_return
+	Document string `json:"document"`
+	// Id of the sales for sales_order and delivery_note, of the sales return for sales_return
+	Id string `json:"id"`
+}
+
+type RenderedDocument struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+type DocumentServiceServer interface {
+	DocumentTemplateView(context.Context, *Empty) (*DocumentTemplate, error)
+	DocumentTemplateUpdate(context.Context, *DocumentTemplate) (*DocumentTemplate, error)
+	Render(context.Context, *RenderDocumentRequest) (*RenderedDocument, error)
+}
+
+const DocumentServiceName = "sales.DocumentService"
+
+var DocumentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: DocumentServiceName,
+	HandlerType: (*DocumentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(DocumentServiceName, "DocumentTemplateView", DocumentServiceServer.DocumentTemplateView),
+		unary(DocumentServiceName, "DocumentTemplateUpdate", DocumentServiceServer.DocumentTemplateUpdate),
+		unary(DocumentServiceName, "Render", DocumentServiceServer.Render),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/rpc/document.go",
+}
+
+func RegisterDocumentServiceServer(s grpc.ServiceRegistrar, srv DocumentServiceServer) {
+	s.RegisterService(&DocumentService_ServiceDesc, srv)
+}
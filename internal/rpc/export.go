@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"google.golang.org/grpc"
+)
+
+type ExportSalesRequest struct {
+	Filter   *sales.ListSalesRequest `json:"filter"`
+	Format   string                  `json:"format"`    // csv or xlsx
+	DateFrom string                  `json:"date_from"` // YYYY-MM-DD
+	DateTo   string                  `json:"date_to"`   // YYYY-MM-DD, inclusive
+}
+
+type ExportSalesReturnRequest struct {
+	Filter   *sales.ListSalesReturnRequest `json:"filter"`
+	Format   string                        `json:"format"`
+	DateFrom string                        `json:"date_from"`
+	DateTo   string                        `json:"date_to"`
+}
+
+type ExportChunk struct {
+	// FileName and ContentType are only sent on the first chunk
+	FileName    string `json:"file_name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Chunk       []byte `json:"chunk"`
+}
+
+type ExportServiceServer interface {
+	ExportSales(*ExportSalesRequest, ServerStream[ExportChunk]) error
+	ExportSalesReturns(*ExportSalesReturnRequest, ServerStream[ExportChunk]) error
+}
+
+const ExportServiceName = "sales.ExportService"
+
+var ExportService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ExportServiceName,
+	HandlerType: (*ExportServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		serverStreaming("ExportSales", ExportServiceServer.ExportSales),
+		serverStreaming("ExportSalesReturns", ExportServiceServer.ExportSalesReturns),
+	},
+	Metadata: "internal/rpc/export.go",
+}
+
+func RegisterExportServiceServer(s grpc.ServiceRegistrar, srv ExportServiceServer) {
+	s.RegisterService(&ExportService_ServiceDesc, srv)
+}
@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"google.golang.org/grpc"
+)
+
+type ImportRequest struct {
+	// Entity, Format and DryRun are read from the first message of the stream
+	Entity string `json:"entity"` // customer or salesman
+	Format string `json:"format"` // csv or xlsx
+	DryRun bool   `json:"dry_run"`
+	Chunk  []byte `json:"chunk"`
+}
+
+type ImportRowResult struct {
+	Row    int    `json:"row"`
+	Code   string `json:"code"`
+	Action string `json:"action"` // create or update
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	Entity  string             `json:"entity"`
+	DryRun  bool               `json:"dry_run"`
+	Total   int                `json:"total"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Failed  int                `json:"failed"`
+	Rows    []*ImportRowResult `json:"rows"`
+}
+
+type ImportServiceServer interface {
+	Import(ClientStream[ImportRequest, ImportResponse]) error
+}
+
+const ImportServiceName = "sales.ImportService"
+
+var ImportService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ImportServiceName,
+	HandlerType: (*ImportServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		clientStreaming("Import", ImportServiceServer.Import),
+	},
+	Metadata: "internal/rpc/import.go",
+}
+
+func RegisterImportServiceServer(s grpc.ServiceRegistrar, srv ImportServiceServer) {
+	s.RegisterService(&ImportService_ServiceDesc, srv)
+}
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type PermissionCatalog struct {
+	Permissions []string `json:"permissions"`
+}
+
+type RoleRequest struct {
+	// GroupId is the id of the user group in the user service
+	GroupId string `json:"group_id"`
+}
+
+type RolePermission struct {
+	GroupId     string   `json:"group_id"`
+	Permissions []string `json:"permissions"`
+	UpdatedAt   string   `json:"updated_at,omitempty"`
+	UpdatedBy   string   `json:"updated_by,omitempty"`
+}
+
+type PermissionServiceServer interface {
+	PermissionList(context.Context, *Empty) (*PermissionCatalog, error)
+	RolePermissionView(context.Context, *RoleRequest) (*RolePermission, error)
+	RolePermissionUpdate(context.Context, *RolePermission) (*RolePermission, error)
+}
+
+const PermissionServiceName = "sales.PermissionService"
+
+var PermissionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: PermissionServiceName,
+	HandlerType: (*PermissionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(PermissionServiceName, "PermissionList", PermissionServiceServer.PermissionList),
+		unary(PermissionServiceName, "RolePermissionView", PermissionServiceServer.RolePermissionView),
+		unary(PermissionServiceName, "RolePermissionUpdate", PermissionServiceServer.RolePermissionUpdate),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/rpc/permission.go",
+}
+
+func RegisterPermissionServiceServer(s grpc.ServiceRegistrar, srv PermissionServiceServer) {
+	s.RegisterService(&PermissionService_ServiceDesc, srv)
+}
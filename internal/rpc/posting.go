@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// LedgerAccounts is the general ledger account code of each posting role of the company
+type LedgerAccounts struct {
+	Revenue       string `json:"revenue"`
+	Receivable    string `json:"receivable"`
+	SalesDiscount string `json:"sales_discount"`
+	SalesReturn   string `json:"sales_return"`
+	TaxPayable    string `json:"tax_payable"`
+	UpdatedAt     string `json:"updated_at,omitempty"`
+	UpdatedBy     string `json:"updated_by,omitempty"`
+}
+
+type DocumentRef struct {
+	// DocumentType is sales or sales_return
+	DocumentType string `json:"document_type"`
+	DocumentId   string `json:"document_id"`
+}
+
+type Posting struct {
+	Id            string `json:"id"`
+	Status        string `json:"status"`
+	JournalId     string `json:"journal_id"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error"`
+	NextAttemptAt string `json:"next_attempt_at"`
+	CreatedAt     string `json:"created_at"`
+	PostedAt      string `json:"posted_at"`
+}
+
+type PostingStatusResponse struct {
+	DocumentType string `json:"document_type"`
+	DocumentId   string `json:"document_id"`
+	// Status of the latest posting: none, pending, posted or failed
+	Status   string     `json:"status"`
+	Postings []*Posting `json:"postings"`
+}
+
+type PostingServiceServer interface {
+	LedgerAccountView(context.Context, *Empty) (*LedgerAccounts, error)
+	LedgerAccountUpdate(context.Context, *LedgerAccounts) (*LedgerAccounts, error)
+	PostingStatus(context.Context, *DocumentRef) (*PostingStatusResponse, error)
+	PostingRetry(context.Context, *DocumentRef) (*PostingStatusResponse, error)
+}
+
+const PostingServiceName = "sales.PostingService"
+
+var PostingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: PostingServiceName,
+	HandlerType: (*PostingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(PostingServiceName, "LedgerAccountView", PostingServiceServer.LedgerAccountView),
+		unary(PostingServiceName, "LedgerAccountUpdate", PostingServiceServer.LedgerAccountUpdate),
+		unary(PostingServiceName, "PostingStatus", PostingServiceServer.PostingStatus),
+		unary(PostingServiceName, "PostingRetry", PostingServiceServer.PostingRetry),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/rpc/posting.go",
+}
+
+func RegisterPostingServiceServer(s grpc.ServiceRegistrar, srv PostingServiceServer) {
+	s.RegisterService(&PostingService_ServiceDesc, srv)
+}
@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// CodecName is the content-subtype clients must use when calling services of this package,
+// e.g. grpc.CallContentSubtype(rpc.CodecName) or grpcurl -format json with application/grpc+json
+const CodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return CodecName
+}
+
+// ServerStream is the server side of a server streaming rpc
+type ServerStream[Res any] interface {
+	Send(*Res) error
+	grpc.ServerStream
+}
+
+// ClientStream is the server side of a client streaming rpc
+type ClientStream[Req any, Res any] interface {
+	Recv() (*Req, error)
+	SendAndClose(*Res) error
+	grpc.ServerStream
+}
+
+type serverStream[Res any] struct {
+	grpc.ServerStream
+}
+
+func (x *serverStream[Res]) Send(m *Res) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+type clientStream[Req any, Res any] struct {
+	grpc.ServerStream
+}
+
+func (x *clientStream[Req, Res]) Recv() (*Req, error) {
+	m := new(Req)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *clientStream[Req, Res]) SendAndClose(m *Res) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func unary[S any, Req any, Res any](service, method string, call func(S, context.Context, *Req) (*Res, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(S), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + service + "/" + method,
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(S), ctx, req.(*Req))
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+func serverStreaming[S any, Req any, Res any](method string, call func(S, *Req, ServerStream[Res]) error) grpc.StreamDesc {
+	return grpc.StreamDesc{
+		StreamName: method,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			in := new(Req)
+			if err := stream.RecvMsg(in); err != nil {
+				return err
+			}
+			return call(srv.(S), in, &serverStream[Res]{stream})
+		},
+		ServerStreams: true,
+	}
+}
+
+func clientStreaming[S any, Req any, Res any](method string, call func(S, ClientStream[Req, Res]) error) grpc.StreamDesc {
+	return grpc.StreamDesc{
+		StreamName: method,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return call(srv.(S), &clientStream[Req, Res]{stream})
+		},
+		ClientStreams: true,
+	}
+}
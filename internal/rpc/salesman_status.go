@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"google.golang.org/grpc"
+)
+
+type SalesmanStatus struct {
+	Salesman *sales.Salesman `json:"salesman"`
+	IsActive bool            `json:"is_active"`
+	Version  int32           `json:"version"`
+}
+
+type ListSalesmanStatusResponse struct {
+	Pagination *sales.SalesmanPaginationResponse `json:"pagination"`
+	Salesman   *sales.Salesman                   `json:"salesman"`
+	IsActive   bool                              `json:"is_active"`
+}
+
+type SalesmanStatusServiceServer interface {
+	SalesmanDeactivate(context.Context, *sales.Id) (*SalesmanStatus, error)
+	SalesmanReactivate(context.Context, *sales.Id) (*SalesmanStatus, error)
+	SalesmanListByStatus(*ListByStatusRequest, ServerStream[ListSalesmanStatusResponse]) error
+}
+
+const SalesmanStatusServiceName = "sales.SalesmanStatusService"
+
+var SalesmanStatusService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: SalesmanStatusServiceName,
+	HandlerType: (*SalesmanStatusServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(SalesmanStatusServiceName, "SalesmanDeactivate", SalesmanStatusServiceServer.SalesmanDeactivate),
+		unary(SalesmanStatusServiceName, "SalesmanReactivate", SalesmanStatusServiceServer.SalesmanReactivate),
+	},
+	Streams: []grpc.StreamDesc{
+		serverStreaming("SalesmanListByStatus", SalesmanStatusServiceServer.SalesmanListByStatus),
+	},
+	Metadata: "internal/rpc/salesman_status.go",
+}
+
+func RegisterSalesmanStatusServiceServer(s grpc.ServiceRegistrar, srv SalesmanStatusServiceServer) {
+	s.RegisterService(&SalesmanStatusService_ServiceDesc, srv)
+}
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"google.golang.org/grpc"
+)
+
+type SearchRequest struct {
+	// Query is the words to look for, a word match the beginning of a word, a misspelled word is found by similarity
+	Query string `json:"query"`
+	// Types limit the search to customer, salesman, sales or sales_return, empty means every type the caller can view
+	Types []string `json:"types"`
+	// Limit of hits, default 20 and at most 100
+	Limit int `json:"limit"`
+}
+
+type SearchHit struct {
+	// Type is customer, salesman, sales or sales_return, the entity of Id
+	Type string `json:"type"`
+	Id   string `json:"id"`
+	Code string `json:"code"`
+	// Title is the name of customer and salesman, the customer name of sales and sales return
+	Title string `json:"title"`
+	// Detail is phone and address of customer, email of salesman, date and remark of sales and sales return
+	Detail string `json:"detail"`
+	// Rank is the relevance of the hit, hits are sent highest first
+	Rank float64 `json:"rank"`
+}
+
+type SearchServiceServer interface {
+	Search(*SearchRequest, ServerStream[SearchHit]) error
+}
+
+const SearchServiceName = "sales.SearchService"
+
+var SearchService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: SearchServiceName,
+	HandlerType: (*SearchServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		serverStreaming("Search", SearchServiceServer.Search),
+	},
+	Metadata: "internal/rpc/search.go",
+}
+
+func RegisterSearchServiceServer(s grpc.ServiceRegistrar, srv SearchServiceServer) {
+	s.RegisterService(&SearchService_ServiceDesc, srv)
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"google.golang.org/grpc"
+)
+
+type WebhookSubscription struct {
+	Id  string `json:"id"`
+	Url string `json:"url"`
+	// EventTypes such as SalesCreated or SalesReturnUpdated, "*" for every event
+	EventTypes []string `json:"event_types"`
+	// Secret sign the payload, generated on create when empty and only returned by create and update
+	Secret    string `json:"secret,omitempty"`
+	IsActive  bool   `json:"is_active"`
+	CreatedAt string `json:"created_at,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty"`
+}
+
+type WebhookDelivery struct {
+	Id             string `json:"id"`
+	SubscriptionId string `json:"subscription_id"`
+	EventId        string `json:"event_id"`
+	EventType      string `json:"event_type"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	ResponseCode   int    `json:"response_code"`
+	LastError      string `json:"last_error"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type WebhookDeadLetterRequest struct {
+	// SubscriptionId limit the list to one subscription, empty means every subscription of the company
+	SubscriptionId string `json:"subscription_id"`
+}
+
+type WebhookReplayRequest struct {
+	SubscriptionId string `json:"subscription_id"`
+	// DeliveryIds to send again, empty means every dead delivery of the subscription
+	DeliveryIds []string `json:"delivery_ids"`
+}
+
+type WebhookReplayResponse struct {
+	Replayed int64 `json:"replayed"`
+}
+
+type WebhookServiceServer interface {
+	WebhookCreate(context.Context, *WebhookSubscription) (*WebhookSubscription, error)
+	WebhookUpdate(context.Context, *WebhookSubscription) (*WebhookSubscription, error)
+	WebhookView(context.Context, *sales.Id) (*WebhookSubscription, error)
+	WebhookDelete(context.Context, *sales.Id) (*sales.MyBoolean, error)
+	WebhookList(*Empty, ServerStream[WebhookSubscription]) error
+	WebhookDeadLetterList(*WebhookDeadLetterRequest, ServerStream[WebhookDelivery]) error
+	WebhookReplay(context.Context, *WebhookReplayRequest) (*WebhookReplayResponse, error)
+}
+
+const WebhookServiceName = "sales.WebhookService"
+
+var WebhookService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: WebhookServiceName,
+	HandlerType: (*WebhookServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(WebhookServiceName, "WebhookCreate", WebhookServiceServer.WebhookCreate),
+		unary(WebhookServiceName, "WebhookUpdate", WebhookServiceServer.WebhookUpdate),
+		unary(WebhookServiceName, "WebhookView", WebhookServiceServer.WebhookView),
+		unary(WebhookServiceName, "WebhookDelete", WebhookServiceServer.WebhookDelete),
+		unary(WebhookServiceName, "WebhookReplay", WebhookServiceServer.WebhookReplay),
+	},
+	Streams: []grpc.StreamDesc{
+		serverStreaming("WebhookList", WebhookServiceServer.WebhookList),
+		serverStreaming("WebhookDeadLetterList", WebhookServiceServer.WebhookDeadLetterList),
+	},
+	Metadata: "internal/rpc/webhook.go",
+}
+
+func RegisterWebhookServiceServer(s grpc.ServiceRegistrar, srv WebhookServiceServer) {
+	s.RegisterService(&WebhookService_ServiceDesc, srv)
+}
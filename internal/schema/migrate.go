@@ -130,6 +130,405 @@ var migrations = []darwin.Migration{
 			CONSTRAINT fk_sales_return_details_to_sales_returns FOREIGN KEY (sales_return_id) REFERENCES sales_returns(id) ON DELETE CASCADE ON UPDATE CASCADE
 		);`,
 	},
+	{
+		Version:     7,
+		Description: "Add Active Flag To Customers And Salesman",
+		Script: `
+		ALTER TABLE customers ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT TRUE;
+		ALTER TABLE salesman ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT TRUE;
+		CREATE INDEX idx_sales_customer_id ON sales(customer_id);
+		CREATE INDEX idx_sales_salesman_id ON sales(salesman_id);`,
+	},
+	{
+		Version:     8,
+		Description: "Add Customer Tax ID And Customer Merges",
+		Script: `
+		ALTER TABLE customers DROP CONSTRAINT customers_name_key;
+		ALTER TABLE customers ADD CONSTRAINT customers_company_id_name_key UNIQUE(company_id, name);
+		ALTER TABLE customers ADD COLUMN tax_id VARCHAR(30) NOT NULL DEFAULT '';
+		CREATE TABLE customer_merges (
+			id uuid NOT NULL PRIMARY KEY,
+			company_id uuid NOT NULL,
+			survivor_id uuid NOT NULL,
+			duplicate_id uuid NOT NULL,
+			duplicate_data JSONB NOT NULL,
+			moved_sales JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			CONSTRAINT fk_customer_merges_to_survivor FOREIGN KEY (survivor_id) REFERENCES customers(id),
+			CONSTRAINT fk_customer_merges_to_duplicate FOREIGN KEY (duplicate_id) REFERENCES customers(id)
+		);`,
+	},
+	{
+		Version:     9,
+		Description: "Add Document Templates",
+		Script: `
+		CREATE TABLE document_templates (
+			company_id uuid NOT NULL PRIMARY KEY,
+			logo BYTEA,
+			header TEXT NOT NULL DEFAULT '',
+			footer TEXT NOT NULL DEFAULT '',
+			terms TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL
+		);`,
+	},
+	{
+		Version:     10,
+		Description: "Add Outbox Events",
+		Script: `
+		CREATE TABLE outbox_events (
+			id uuid NOT NULL PRIMARY KEY,
+			sequence BIGSERIAL NOT NULL UNIQUE,
+			company_id uuid NOT NULL,
+			aggregate_type VARCHAR(30) NOT NULL,
+			aggregate_id uuid NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			published_at TIMESTAMP,
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX idx_outbox_events_unpublished ON outbox_events(sequence) WHERE published_at IS NULL;`,
+	},
+	{
+		Version:     11,
+		Description: "Add Ledger Accounts And Journal Postings",
+		Script: `
+		CREATE TABLE ledger_accounts (
+			company_id uuid NOT NULL PRIMARY KEY,
+			revenue VARCHAR(20) NOT NULL DEFAULT '',
+			receivable VARCHAR(20) NOT NULL DEFAULT '',
+			sales_discount VARCHAR(20) NOT NULL DEFAULT '',
+			sales_return VARCHAR(20) NOT NULL DEFAULT '',
+			tax_payable VARCHAR(20) NOT NULL DEFAULT '',
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL
+		);
+		CREATE TABLE journal_postings (
+			id uuid NOT NULL PRIMARY KEY,
+			sequence BIGSERIAL NOT NULL UNIQUE,
+			company_id uuid NOT NULL,
+			branch_id uuid NOT NULL,
+			document_type VARCHAR(20) NOT NULL,
+			document_id uuid NOT NULL,
+			document_code VARCHAR(20) NOT NULL,
+			document_date DATE NOT NULL,
+			lines JSONB NOT NULL,
+			status VARCHAR(10) NOT NULL DEFAULT 'pending',
+			journal_id VARCHAR(50) NOT NULL DEFAULT '',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			posted_at TIMESTAMP
+		);
+		CREATE INDEX idx_journal_postings_document ON journal_postings(document_type, document_id, sequence);
+		CREATE INDEX idx_journal_postings_due ON journal_postings(next_attempt_at) WHERE status <> 'posted';
+		ALTER TABLE sales ADD COLUMN posting_status VARCHAR(10) NOT NULL DEFAULT 'none';
+		ALTER TABLE sales_returns ADD COLUMN posting_status VARCHAR(10) NOT NULL DEFAULT 'none';`,
+	},
+	{
+		Version:     12,
+		Description: "Add Webhooks",
+		Script: `
+		CREATE TABLE webhook_subscriptions (
+			id uuid NOT NULL PRIMARY KEY,
+			company_id uuid NOT NULL,
+			url VARCHAR(500) NOT NULL,
+			event_types JSONB NOT NULL,
+			secret VARCHAR(100) NOT NULL,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL
+		);
+		CREATE TABLE webhook_deliveries (
+			id uuid NOT NULL PRIMARY KEY,
+			subscription_id uuid NOT NULL,
+			company_id uuid NOT NULL,
+			event_id uuid NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(10) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			response_code INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			delivered_at TIMESTAMP,
+			UNIQUE(subscription_id, event_id),
+			CONSTRAINT fk_webhook_deliveries_to_webhook_subscriptions FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE ON UPDATE CASCADE
+		);
+		CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';`,
+	},
+	{
+		Version:     13,
+		Description: "Add Idempotency Keys",
+		Script: `
+		CREATE TABLE idempotency_keys (
+			company_id uuid NOT NULL,
+			key VARCHAR(100) NOT NULL,
+			method VARCHAR(50) NOT NULL,
+			request_hash CHAR(64) NOT NULL,
+			document_id uuid,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (company_id, method, key)
+		);
+		CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);`,
+	},
+	{
+		Version:     14,
+		Description: "Add Version To Headers",
+		Script: `
+		ALTER TABLE sales ADD COLUMN version INT NOT NULL DEFAULT 1;
+		ALTER TABLE sales_returns ADD COLUMN version INT NOT NULL DEFAULT 1;
+		ALTER TABLE customers ADD COLUMN version INT NOT NULL DEFAULT 1;
+		ALTER TABLE salesman ADD COLUMN version INT NOT NULL DEFAULT 1;`,
+	},
+	{
+		Version:     15,
+		Description: "Add Audit Logs",
+		Script: `
+		CREATE TABLE audit_logs (
+			id uuid NOT NULL PRIMARY KEY,
+			company_id uuid NOT NULL,
+			entity_type VARCHAR(25) NOT NULL,
+			entity_id uuid NOT NULL,
+			document_id uuid NOT NULL,
+			action VARCHAR(10) NOT NULL,
+			changes JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by uuid NOT NULL
+		);
+		CREATE INDEX idx_audit_logs_document ON audit_logs(company_id, document_id, created_at);
+		CREATE INDEX idx_audit_logs_user ON audit_logs(company_id, created_by, created_at);`,
+	},
+	{
+		Version:     16,
+		Description: "Add Role Permissions",
+		Script: `
+		CREATE TABLE role_permissions (
+			company_id uuid NOT NULL,
+			group_id uuid NOT NULL,
+			permission VARCHAR(50) NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by uuid NOT NULL,
+			PRIMARY KEY (company_id, group_id, permission)
+		);`,
+	},
+	{
+		Version:     17,
+		Description: "Enable Row Level Security",
+		Script: `
+		ALTER TABLE customers ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE customers FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON customers
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE salesman ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE salesman FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON salesman
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE sales ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE sales FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON sales
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE sales_returns ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE sales_returns FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON sales_returns
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE customer_merges ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE customer_merges FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON customer_merges
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE document_templates ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE document_templates FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON document_templates
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE outbox_events ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE outbox_events FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON outbox_events
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE ledger_accounts ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE ledger_accounts FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON ledger_accounts
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE journal_postings ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE journal_postings FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON journal_postings
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE webhook_subscriptions ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE webhook_subscriptions FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON webhook_subscriptions
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON webhook_deliveries
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE idempotency_keys ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE idempotency_keys FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON idempotency_keys
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE audit_logs ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE audit_logs FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON audit_logs
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE role_permissions ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE role_permissions FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON role_permissions
+			USING (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+			WITH CHECK (company_id::text = current_setting('app.company_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+		ALTER TABLE sales_details ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE sales_details FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON sales_details
+			USING (EXISTS (SELECT 1 FROM sales WHERE sales.id = sales_details.sales_id))
+			WITH CHECK (EXISTS (SELECT 1 FROM sales WHERE sales.id = sales_details.sales_id));
+		ALTER TABLE sales_return_details ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE sales_return_details FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON sales_return_details
+			USING (EXISTS (SELECT 1 FROM sales_returns WHERE sales_returns.id = sales_return_details.sales_return_id))
+			WITH CHECK (EXISTS (SELECT 1 FROM sales_returns WHERE sales_returns.id = sales_return_details.sales_return_id));`,
+	},
+	{
+		Version:     18,
+		Description: "Add Full Text Search",
+		Script: `
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		ALTER TABLE customers
+			ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', code || ' ' || name), 'A') ||
+				setweight(to_tsvector('simple', phone), 'B') ||
+				setweight(to_tsvector('simple', address), 'C')) STORED,
+			ADD COLUMN search_text TEXT GENERATED ALWAYS AS (lower(code || ' ' || name || ' ' || phone || ' ' || address)) STORED;
+		CREATE INDEX idx_customers_search_vector ON customers USING GIN (search_vector);
+		CREATE INDEX idx_customers_search_text ON customers USING GIN (search_text gin_trgm_ops);
+		ALTER TABLE salesman
+			ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', code || ' ' || name), 'A') ||
+				setweight(to_tsvector('simple', email), 'B')) STORED,
+			ADD COLUMN search_text TEXT GENERATED ALWAYS AS (lower(code || ' ' || name || ' ' || email)) STORED;
+		CREATE INDEX idx_salesman_search_vector ON salesman USING GIN (search_vector);
+		CREATE INDEX idx_salesman_search_text ON salesman USING GIN (search_text gin_trgm_ops);
+		ALTER TABLE sales
+			ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', code), 'A') ||
+				setweight(to_tsvector('simple', remark), 'C')) STORED,
+			ADD COLUMN search_text TEXT GENERATED ALWAYS AS (lower(code || ' ' || remark)) STORED;
+		CREATE INDEX idx_sales_search_vector ON sales USING GIN (search_vector);
+		CREATE INDEX idx_sales_search_text ON sales USING GIN (search_text gin_trgm_ops);
+		ALTER TABLE sales_returns
+			ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', code), 'A') ||
+				setweight(to_tsvector('simple', remark), 'C')) STORED,
+			ADD COLUMN search_text TEXT GENERATED ALWAYS AS (lower(code || ' ' || remark)) STORED;
+		CREATE INDEX idx_sales_returns_search_vector ON sales_returns USING GIN (search_vector);
+		CREATE INDEX idx_sales_returns_search_text ON sales_returns USING GIN (search_text gin_trgm_ops);`,
+	},
+	{
+		Version:     19,
+		Description: "Add Customer Match Keys",
+		Script: `
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		ALTER TABLE customers
+			ADD COLUMN match_name TEXT GENERATED ALWAYS AS (trim(regexp_replace(
+				regexp_replace(regexp_replace(lower(name), '[^[:alnum:]]+', ' ', 'g'), '\m(pt|cv|ud|tbk|persero|pd|koperasi|yayasan)\M', '', 'g'),
+				'\s+', ' ', 'g'))) STORED,
+			ADD COLUMN match_phone TEXT GENERATED ALWAYS AS (ltrim(regexp_replace(regexp_replace(phone, '\D', '', 'g'), '^62', ''), '0')) STORED,
+			ADD COLUMN match_tax_id TEXT GENERATED ALWAYS AS (regexp_replace(tax_id, '\D', '', 'g')) STORED;
+		CREATE INDEX idx_customers_match_name ON customers USING GIN (match_name gin_trgm_ops);
+		CREATE INDEX idx_customers_match_phone ON customers(company_id, match_phone) WHERE match_phone <> '';
+		CREATE INDEX idx_customers_match_tax_id ON customers(company_id, match_tax_id) WHERE match_tax_id <> '';`,
+	},
+	{
+		Version:     20,
+		Description: "Add Outbox Events Retry",
+		Script: `
+		ALTER TABLE outbox_events
+			ADD COLUMN next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			ADD COLUMN dead_at TIMESTAMP;
+		DROP INDEX idx_outbox_events_unpublished;
+		CREATE INDEX idx_outbox_events_due ON outbox_events(sequence) WHERE published_at IS NULL AND dead_at IS NULL;
+		CREATE INDEX idx_outbox_events_aggregate ON outbox_events(aggregate_id, sequence) WHERE published_at IS NULL AND dead_at IS NULL;`,
+	},
+	{
+		Version:     21,
+		Description: "Drop Row Level Security Bypass Setting",
+		Script: `
+		DROP POLICY tenant_isolation ON customers;
+		CREATE POLICY tenant_isolation ON customers
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON salesman;
+		CREATE POLICY tenant_isolation ON salesman
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON sales;
+		CREATE POLICY tenant_isolation ON sales
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON sales_returns;
+		CREATE POLICY tenant_isolation ON sales_returns
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON customer_merges;
+		CREATE POLICY tenant_isolation ON customer_merges
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON document_templates;
+		CREATE POLICY tenant_isolation ON document_templates
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON outbox_events;
+		CREATE POLICY tenant_isolation ON outbox_events
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON ledger_accounts;
+		CREATE POLICY tenant_isolation ON ledger_accounts
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON journal_postings;
+		CREATE POLICY tenant_isolation ON journal_postings
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON webhook_subscriptions;
+		CREATE POLICY tenant_isolation ON webhook_subscriptions
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON webhook_deliveries;
+		CREATE POLICY tenant_isolation ON webhook_deliveries
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON idempotency_keys;
+		CREATE POLICY tenant_isolation ON idempotency_keys
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON audit_logs;
+		CREATE POLICY tenant_isolation ON audit_logs
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));
+		DROP POLICY tenant_isolation ON role_permissions;
+		CREATE POLICY tenant_isolation ON role_permissions
+			USING (company_id::text = current_setting('app.company_id', true))
+			WITH CHECK (company_id::text = current_setting('app.company_id', true));`,
+	},
 }
 
 func Migrate(db *sql.DB) error {
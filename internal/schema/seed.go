@@ -5,6 +5,7 @@ import (
 	"fmt"
 )
 
+// Seed write the seeds of every company, db must bypass row level security like the worker role
 func Seed(db *sql.DB) error {
 	seeds := []string{}
 
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxAuditList is the limit of audit logs when the request has none or a bigger one
+const maxAuditList = 1000
+
+type Audit struct {
+	Db           *sql.DB
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	Cache        *cache.Cache
+}
+
+// AuditList stream the history of a document or of a user, newest first
+func (u *Audit) AuditList(in *rpc.AuditListRequest, stream rpc.ServerStream[rpc.AuditLog]) error {
+	ctx, err := app.GetMetadata(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return err
+	}
+
+	if len(in.DocumentId) == 0 && len(in.UserId) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply document id or user id")
+	}
+
+	filter := model.AuditFilter{
+		DocumentID: in.DocumentId,
+		UserID:     in.UserId,
+		EntityType: in.EntityType,
+		Limit:      in.Limit,
+	}
+	if filter.Limit <= 0 || filter.Limit > maxAuditList {
+		filter.Limit = maxAuditList
+	}
+
+	if len(in.DateFrom) > 0 {
+		filter.From, err = time.Parse("2006-01-02", in.DateFrom)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "date_from must be YYYY-MM-DD")
+		}
+	}
+
+	if len(in.DateTo) > 0 {
+		filter.To, err = time.Parse("2006-01-02", in.DateTo)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "date_to must be YYYY-MM-DD")
+		}
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	query, paramQueries := model.AuditQuery(ctx, filter)
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query audit logs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		auditLog, err := model.ScanAuditLog(rows)
+		if err != nil {
+			return err
+		}
+
+		response := rpc.AuditLog{
+			Id:         auditLog.Id,
+			EntityType: auditLog.EntityType,
+			EntityId:   auditLog.EntityID,
+			DocumentId: auditLog.DocumentID,
+			Action:     auditLog.Action,
+			CreatedAt:  auditLog.CreatedAt.String(),
+			CreatedBy:  auditLog.CreatedBy,
+		}
+		for _, change := range auditLog.Changes {
+			response.Changes = append(response.Changes, &rpc.AuditChange{
+				Field:  change.Field,
+				Before: change.Before,
+				After:  change.After,
+			})
+		}
+
+		err = stream.Send(&response)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return status.Errorf(codes.Internal, "rows audit logs: %v", err)
+	}
+
+	return nil
+}
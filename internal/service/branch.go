@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/model"
+)
+
+// branchScope restrict ctx to the branches visible to the caller, get, list and export of sales and sales returns honour it
+func branchScope(ctx context.Context, c *cache.Cache, userClient users.UserServiceClient, regionClient users.RegionServiceClient) (context.Context, error) {
+	mBranch := model.Branch{
+		UserClient:   userClient,
+		RegionClient: regionClient,
+		Cache:        c,
+	}
+	branches, err := mBranch.Scope(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	return model.WithBranchScope(ctx, branches), nil
+}
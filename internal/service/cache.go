@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Cache struct {
+	Cache *cache.Cache
+}
+
+// CacheInvalidate drop cached lookups of the company, after a user, region, branch or product changed in its service
+func (u *Cache) CacheInvalidate(ctx context.Context, in *rpc.CacheInvalidateRequest) (*rpc.Empty, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cache.IsKind(in.Kind) {
+		return nil, status.Errorf(codes.InvalidArgument, "kind must be one of %v", cache.Kinds)
+	}
+
+	u.Cache.Invalidate(ctx, in.Kind, in.Id)
+
+	return &rpc.Empty{}, nil
+}
+
+func (u *Cache) CacheStats(ctx context.Context, in *rpc.Empty) (*rpc.CacheStats, error) {
+	stats := u.Cache.Stats()
+
+	return &rpc.CacheStats{
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		HitRate:   stats.HitRate,
+		Entries:   stats.Entries,
+		Fallbacks: stats.Fallbacks,
+	}, nil
+}
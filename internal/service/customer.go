@@ -3,11 +3,15 @@ package service
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -21,16 +25,9 @@ func (u *Customer) CustomerCreate(ctx context.Context, in *sales.Customer) (*sal
 	var customerModel model.Customer
 	var err error
 
-	if len(in.GetName()) == 0 {
-		return &customerModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid name")
-	}
-
-	if len(in.GetAddress()) == 0 {
-		return &customerModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid address")
-	}
-
-	if len(in.GetPhone()) == 0 {
-		return &customerModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid phone")
+	err = customerValidation(in)
+	if err != nil {
+		return &customerModel.Pb, err
 	}
 
 	ctx, err = app.GetMetadata(ctx)
@@ -40,10 +37,6 @@ func (u *Customer) CustomerCreate(ctx context.Context, in *sales.Customer) (*sal
 
 	// code validation
 	{
-		if len(in.GetCode()) == 0 {
-			return &customerModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid code")
-		}
-
 		customerModel = model.Customer{}
 		customerModel.Pb.Code = in.GetCode()
 		err = customerModel.GetByCode(ctx, u.Db)
@@ -58,6 +51,11 @@ func (u *Customer) CustomerCreate(ctx context.Context, in *sales.Customer) (*sal
 		}
 	}
 
+	customerModel.TaxID, _, err = taxID(ctx)
+	if err != nil {
+		return &customerModel.Pb, err
+	}
+
 	customerModel.Pb = sales.Customer{
 		Code:    in.GetCode(),
 		Name:    in.GetName(),
@@ -69,6 +67,8 @@ func (u *Customer) CustomerCreate(ctx context.Context, in *sales.Customer) (*sal
 		return &customerModel.Pb, err
 	}
 
+	sendVersion(ctx, customerModel.Version)
+	sendTaxID(ctx, customerModel.TaxID)
 	return &customerModel.Pb, nil
 }
 
@@ -91,6 +91,11 @@ func (u *Customer) CustomerUpdate(ctx context.Context, in *sales.Customer) (*sal
 		return &customerModel.Pb, err
 	}
 
+	err = checkVersion(ctx, "customer", customerModel.Version)
+	if err != nil {
+		return &customerModel.Pb, err
+	}
+
 	if len(in.GetName()) > 0 {
 		customerModel.Pb.Name = in.GetName()
 	}
@@ -103,11 +108,19 @@ func (u *Customer) CustomerUpdate(ctx context.Context, in *sales.Customer) (*sal
 		customerModel.Pb.Phone = in.GetPhone()
 	}
 
+	if value, ok, err := taxID(ctx); err != nil {
+		return &customerModel.Pb, err
+	} else if ok {
+		customerModel.TaxID = value
+	}
+
 	err = customerModel.Update(ctx, u.Db)
 	if err != nil {
 		return &customerModel.Pb, err
 	}
 
+	sendVersion(ctx, customerModel.Version)
+	sendTaxID(ctx, customerModel.TaxID)
 	return &customerModel.Pb, nil
 }
 
@@ -130,6 +143,8 @@ func (u *Customer) CustomerView(ctx context.Context, in *sales.Id) (*sales.Custo
 		return &customerModel.Pb, err
 	}
 
+	sendVersion(ctx, customerModel.Version)
+	sendTaxID(ctx, customerModel.TaxID)
 	return &customerModel.Pb, nil
 }
 
@@ -155,6 +170,18 @@ func (u *Customer) CustomerDelete(ctx context.Context, in *sales.Id) (*sales.MyB
 		return &output, err
 	}
 
+	// customer referenced by any document can only be deactivated
+	{
+		references, err := customerModel.References(ctx, u.Db, 5)
+		if err != nil {
+			return &output, err
+		}
+
+		if len(references) > 0 {
+			return &output, status.Error(codes.FailedPrecondition, referencedMessage("customer", customerModel.Pb.GetCode(), references))
+		}
+	}
+
 	err = customerModel.Delete(ctx, u.Db)
 	if err != nil {
 		return &output, err
@@ -165,24 +192,100 @@ func (u *Customer) CustomerDelete(ctx context.Context, in *sales.Id) (*sales.MyB
 }
 
 func (u *Customer) CustomerList(in *sales.ListCustomerRequest, stream sales.CustomerService_CustomerListServer) error {
-	ctx := stream.Context()
+	return u.listCustomer(stream.Context(), in.GetPagination(), model.StatusAll, func(res *sales.ListCustomerResponse, isActive bool) error {
+		return stream.Send(res)
+	})
+}
+
+func (u *Customer) CustomerDeactivate(ctx context.Context, in *sales.Id) (*rpc.CustomerStatus, error) {
+	return u.setCustomerActive(ctx, in, false)
+}
+
+func (u *Customer) CustomerReactivate(ctx context.Context, in *sales.Id) (*rpc.CustomerStatus, error) {
+	return u.setCustomerActive(ctx, in, true)
+}
+
+func (u *Customer) CustomerListByStatus(in *rpc.ListByStatusRequest, stream rpc.ServerStream[rpc.ListCustomerStatusResponse]) error {
+	activeStatus := model.ActiveStatus(in.Status)
+	switch activeStatus {
+	case "":
+		activeStatus = model.StatusActive
+	case model.StatusActive, model.StatusInactive, model.StatusAll:
+	default:
+		return status.Error(codes.InvalidArgument, "Please supply valid status")
+	}
+
+	return u.listCustomer(stream.Context(), in.Pagination, activeStatus, func(res *sales.ListCustomerResponse, isActive bool) error {
+		return stream.Send(&rpc.ListCustomerStatusResponse{
+			Pagination: res.GetPagination(),
+			Customer:   res.GetCustomer(),
+			IsActive:   isActive,
+		})
+	})
+}
+
+func (u *Customer) setCustomerActive(ctx context.Context, in *sales.Id, active bool) (*rpc.CustomerStatus, error) {
+	var customerModel model.Customer
+	var err error
+
+	if len(in.GetId()) == 0 {
+		return &rpc.CustomerStatus{Customer: &customerModel.Pb}, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	customerModel.Pb.Id = in.GetId()
+
+	ctx, err = app.GetMetadata(ctx)
+	if err != nil {
+		return &rpc.CustomerStatus{Customer: &customerModel.Pb}, err
+	}
+
+	err = customerModel.Get(ctx, u.Db)
+	if err != nil {
+		return &rpc.CustomerStatus{Customer: &customerModel.Pb}, err
+	}
+
+	if customerModel.IsActive != active {
+		err = customerModel.SetActive(ctx, u.Db, active)
+		if err != nil {
+			return &rpc.CustomerStatus{Customer: &customerModel.Pb}, err
+		}
+	}
+
+	return &rpc.CustomerStatus{Customer: &customerModel.Pb, IsActive: customerModel.IsActive, Version: customerModel.Version}, nil
+}
+
+func (u *Customer) listCustomer(ctx context.Context, pagination *sales.Pagination, activeStatus model.ActiveStatus, send func(*sales.ListCustomerResponse, bool) error) error {
 	ctx, err := app.GetMetadata(ctx)
 	if err != nil {
 		return err
 	}
 
+	if pagination == nil {
+		pagination = &sales.Pagination{}
+	}
+
+	page, err := listPage(ctx)
+	if err != nil {
+		return err
+	}
+
 	var customerModel model.Customer
-	query, paramQueries, paginationResponse, err := customerModel.ListQuery(ctx, u.Db, in.Pagination)
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	query, paramQueries, paginationResponse, err := customerModel.ListQuery(ctx, tx, pagination, activeStatus, page)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
 	if err != nil {
 		return status.Error(codes.Internal, err.Error())
 	}
 	defer rows.Close()
-	paginationResponse.Pagination = in.Pagination
+	paginationResponse.Pagination = pagination
 
 	for rows.Next() {
 		err := app.ContextError(ctx)
@@ -192,12 +295,17 @@ func (u *Customer) CustomerList(in *sales.ListCustomerRequest, stream sales.Cust
 
 		var pbCustomer sales.Customer
 		var companyID string
+		var isActive bool
 		var createdAt, updatedAt time.Time
-		err = rows.Scan(&pbCustomer.Id, &companyID, &pbCustomer.Code, &pbCustomer.Name, &pbCustomer.Address, &pbCustomer.Phone, &createdAt, &pbCustomer.CreatedBy, &updatedAt, &pbCustomer.UpdatedBy)
+		err = rows.Scan(&pbCustomer.Id, &companyID, &pbCustomer.Code, &pbCustomer.Name, &pbCustomer.Address, &pbCustomer.Phone, &createdAt, &pbCustomer.CreatedBy, &updatedAt, &pbCustomer.UpdatedBy, &isActive)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
 
+		if !page.Scanned(pbCustomer.Id, map[string]interface{}{"created_at": createdAt, "code": pbCustomer.Code, "name": pbCustomer.Name}) {
+			break
+		}
+
 		pbCustomer.CreatedAt = createdAt.String()
 		pbCustomer.UpdatedAt = updatedAt.String()
 
@@ -206,10 +314,44 @@ func (u *Customer) CustomerList(in *sales.ListCustomerRequest, stream sales.Cust
 			Customer:   &pbCustomer,
 		}
 
-		err = stream.Send(res)
+		err = send(res, isActive)
 		if err != nil {
 			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
 		}
 	}
+	sendNextPage(ctx, page)
 	return nil
 }
+
+// customerValidation rules of a new customer, shared with bulk import
+func customerValidation(in *sales.Customer) error {
+	if len(in.GetName()) == 0 || utf8.RuneCountInString(in.GetName()) > 45 {
+		return status.Error(codes.InvalidArgument, "Please supply valid name")
+	}
+
+	if len(in.GetAddress()) == 0 || utf8.RuneCountInString(in.GetAddress()) > 255 {
+		return status.Error(codes.InvalidArgument, "Please supply valid address")
+	}
+
+	if len(in.GetPhone()) == 0 || utf8.RuneCountInString(in.GetPhone()) > 20 {
+		return status.Error(codes.InvalidArgument, "Please supply valid phone")
+	}
+
+	if len(in.GetCode()) == 0 || utf8.RuneCountInString(in.GetCode()) > 10 {
+		return status.Error(codes.InvalidArgument, "Please supply valid code")
+	}
+
+	return nil
+}
+
+func referencedMessage(entity, code string, references []model.Reference) string {
+	var documents []string
+	for _, reference := range references {
+		document := fmt.Sprintf("%d %s (%s", reference.Total, reference.Document, strings.Join(reference.Codes, ", "))
+		if reference.Total > len(reference.Codes) {
+			document += ", ..."
+		}
+		documents = append(documents, document+")")
+	}
+	return fmt.Sprintf("%s %s is referenced by %s, deactivate it instead", entity, strings.TrimSpace(code), strings.Join(documents, " and "))
+}
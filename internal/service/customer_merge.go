@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u *Customer) CustomerFindDuplicates(in *rpc.FindCustomerDuplicatesRequest, stream rpc.ServerStream[rpc.CustomerDuplicate]) error {
+	ctx := stream.Context()
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	if in.Threshold < 0 || in.Threshold > 1 {
+		return status.Error(codes.InvalidArgument, "Please supply valid threshold")
+	}
+
+	duplicates, err := model.FindCustomerDuplicates(ctx, u.Db, in.CustomerId, in.Threshold)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Score > duplicates[j].Score
+	})
+
+	for _, duplicate := range duplicates {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&rpc.CustomerDuplicate{
+			Customer:  &duplicate.Customer.Pb,
+			Candidate: &duplicate.Candidate.Pb,
+			Score:     duplicate.Score,
+			Reasons:   duplicate.Reasons,
+		})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (u *Customer) CustomerMerge(ctx context.Context, in *rpc.MergeCustomerRequest) (*rpc.CustomerMergeResponse, error) {
+	var output rpc.CustomerMergeResponse
+	var err error
+
+	if len(in.SurvivorId) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid survivor id")
+	}
+
+	if len(in.DuplicateId) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid duplicate id")
+	}
+
+	ctx, err = app.GetMetadata(ctx)
+	if err != nil {
+		return &output, err
+	}
+
+	mergeModel := model.CustomerMerge{
+		SurvivorID:  in.SurvivorId,
+		DuplicateID: in.DuplicateId,
+	}
+
+	tx, err := model.BeginTx(ctx, u.Db, nil)
+	if err != nil {
+		return &output, err
+	}
+
+	err = mergeModel.Merge(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &output, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	customerModel := model.Customer{}
+	customerModel.Pb.Id = in.SurvivorId
+	err = customerModel.Get(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	output = rpc.CustomerMergeResponse{
+		Id:          mergeModel.Id,
+		Survivor:    &customerModel.Pb,
+		DuplicateId: mergeModel.DuplicateID,
+		MovedSales:  mergeModel.MovedSales,
+		CreatedAt:   mergeModel.CreatedAt,
+		CreatedBy:   mergeModel.CreatedBy,
+	}
+
+	return &output, nil
+}
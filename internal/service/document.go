@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/document"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxLogoSize = 1 << 20
+
+type Document struct {
+	Db            *sql.DB
+	ProductClient inventories.ProductServiceClient
+	UserClient    users.UserServiceClient
+	RegionClient  users.RegionServiceClient
+	Cache         *cache.Cache
+}
+
+func (u *Document) DocumentTemplateView(ctx context.Context, in *rpc.Empty) (*rpc.DocumentTemplate, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var templateModel model.DocumentTemplate
+	err = templateModel.Get(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return templateResponse(&templateModel), nil
+}
+
+func (u *Document) DocumentTemplateUpdate(ctx context.Context, in *rpc.DocumentTemplate) (*rpc.DocumentTemplate, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.Logo) > maxLogoSize {
+		return nil, status.Errorf(codes.InvalidArgument, "logo exceeds %d bytes", maxLogoSize)
+	}
+
+	if err := document.ValidateLogo(in.Logo); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "logo must be a png or jpeg image: %v", err)
+	}
+
+	templateModel := model.DocumentTemplate{
+		Logo:   in.Logo,
+		Header: in.Header,
+		Footer: in.Footer,
+		Terms:  in.Terms,
+	}
+	err = templateModel.Save(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return templateResponse(&templateModel), nil
+}
+
+func (u *Document) Render(ctx context.Context, in *rpc.RenderDocumentRequest) (*rpc.RenderedDocument, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.Id) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	var data document.Data
+	switch in.Document {
+	case "sales_order", "delivery_note":
+		data, err = u.salesData(ctx, in.Id, in.Document == "sales_order")
+	case "sales_return":
+		data, err = u.salesReturnData(ctx, in.Id)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "document must be sales_order, delivery_note or sales_return")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var templateModel model.DocumentTemplate
+	err = templateModel.Get(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := document.Render(document.Template{
+		Logo:   templateModel.Logo,
+		Header: templateModel.Header,
+		Footer: templateModel.Footer,
+		Terms:  templateModel.Terms,
+	}, data)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "render document: %v", err)
+	}
+
+	return &rpc.RenderedDocument{
+		FileName:    fmt.Sprintf("%s_%s.pdf", in.Document, data.Code),
+		ContentType: "application/pdf",
+		Content:     content,
+	}, nil
+}
+
+func (u *Document) salesData(ctx context.Context, id string, showPrices bool) (document.Data, error) {
+	var salesModel model.Sales
+	salesModel.Pb.Id = id
+	err := salesModel.Get(ctx, u.Db)
+	if err != nil {
+		return document.Data{}, err
+	}
+
+	data := document.Data{
+		Title:                "SALES ORDER",
+		Code:                 salesModel.Pb.GetCode(),
+		Date:                 documentDate(salesModel.Pb.GetSalesDate()),
+		BranchName:           salesModel.Pb.GetBranchName(),
+		Remark:               salesModel.Pb.GetRemark(),
+		ShowPrices:           showPrices,
+		Price:                salesModel.Pb.GetPrice(),
+		AdditionalDiscAmount: salesModel.Pb.GetAdditionalDiscAmount(),
+		TotalPrice:           salesModel.Pb.GetTotalPrice(),
+		Signatures:           []string{"Prepared By", "Approved By", "Customer"},
+	}
+	if !showPrices {
+		data.Title = "DELIVERY NOTE"
+		data.Reference = salesModel.Pb.GetCode()
+		data.Signatures = []string{"Picked By", "Delivered By", "Received By"}
+	}
+
+	err = u.partyData(ctx, &data, salesModel.Pb.GetCustomer().GetId(), salesModel.Pb.GetSalesman().GetId())
+	if err != nil {
+		return data, err
+	}
+
+	var productIds []string
+	for _, detail := range salesModel.Pb.GetDetails() {
+		productIds = append(productIds, detail.GetProductId())
+		data.Lines = append(data.Lines, document.Line{
+			ProductCode: detail.GetProductId(),
+			Quantity:    detail.GetQuantity(),
+			Price:       detail.GetPrice(),
+			DiscAmount:  detail.GetDiscAmount(),
+			TotalPrice:  detail.GetTotalPrice(),
+		})
+	}
+
+	return data, u.productData(ctx, data.Lines, productIds)
+}
+
+func (u *Document) salesReturnData(ctx context.Context, id string) (document.Data, error) {
+	var salesReturnModel model.SalesReturn
+	salesReturnModel.Pb.Id = id
+	err := salesReturnModel.Get(ctx, u.Db)
+	if err != nil {
+		return document.Data{}, err
+	}
+
+	var salesModel model.Sales
+	salesModel.Pb.Id = salesReturnModel.Pb.GetSales().GetId()
+	err = salesModel.Get(ctx, u.Db)
+	if err != nil {
+		return document.Data{}, err
+	}
+
+	data := document.Data{
+		Title:                "SALES RETURN",
+		Code:                 salesReturnModel.Pb.GetCode(),
+		Date:                 documentDate(salesReturnModel.Pb.GetReturnDate()),
+		Reference:            salesModel.Pb.GetCode(),
+		BranchName:           salesReturnModel.Pb.GetBranchName(),
+		Remark:               salesReturnModel.Pb.GetRemark(),
+		ShowPrices:           true,
+		Price:                salesReturnModel.Pb.GetPrice(),
+		AdditionalDiscAmount: salesReturnModel.Pb.GetAdditionalDiscAmount(),
+		TotalPrice:           salesReturnModel.Pb.GetTotalPrice(),
+		Signatures:           []string{"Received By", "Approved By", "Customer"},
+	}
+
+	err = u.partyData(ctx, &data, salesModel.Pb.GetCustomer().GetId(), salesModel.Pb.GetSalesman().GetId())
+	if err != nil {
+		return data, err
+	}
+
+	var productIds []string
+	for _, detail := range salesReturnModel.Pb.GetDetails() {
+		productIds = append(productIds, detail.GetProductId())
+		data.Lines = append(data.Lines, document.Line{
+			ProductCode: detail.GetProductId(),
+			Quantity:    detail.GetQuantity(),
+			Price:       detail.GetPrice(),
+			DiscAmount:  detail.GetDiscAmount(),
+			TotalPrice:  detail.GetTotalPrice(),
+		})
+	}
+
+	return data, u.productData(ctx, data.Lines, productIds)
+}
+
+func (u *Document) partyData(ctx context.Context, data *document.Data, customerID, salesmanID string) error {
+	var customerModel model.Customer
+	customerModel.Pb.Id = customerID
+	err := customerModel.Get(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	var salesmanModel model.Salesman
+	salesmanModel.Pb.Id = salesmanID
+	err = salesmanModel.Get(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	data.CustomerName = customerModel.Pb.GetName()
+	data.CustomerAddr = customerModel.Pb.GetAddress()
+	data.CustomerPhone = customerModel.Pb.GetPhone()
+	data.SalesmanName = salesmanModel.Pb.GetName()
+
+	return nil
+}
+
+// productData replace product ids in lines with code and name from inventory service
+func (u *Document) productData(ctx context.Context, lines []document.Line, productIds []string) error {
+	if len(productIds) == 0 {
+		return nil
+	}
+
+	mProduct := model.Product{
+		Client: u.ProductClient,
+		Cache:  u.Cache,
+		Pb:     &inventories.Product{},
+	}
+
+	products, err := mProduct.List(ctx, &inventories.ListProductRequest{Ids: productIds})
+	if err != nil {
+		return err
+	}
+
+	for i := range lines {
+		for _, p := range products {
+			if lines[i].ProductCode == p.GetProduct().GetId() {
+				lines[i].ProductCode = p.GetProduct().GetCode()
+				lines[i].ProductName = p.GetProduct().GetName()
+			}
+		}
+	}
+
+	return nil
+}
+
+func templateResponse(templateModel *model.DocumentTemplate) *rpc.DocumentTemplate {
+	return &rpc.DocumentTemplate{
+		Logo:      templateModel.Logo,
+		Header:    templateModel.Header,
+		Footer:    templateModel.Footer,
+		Terms:     templateModel.Terms,
+		UpdatedAt: templateModel.UpdatedAt,
+		UpdatedBy: templateModel.UpdatedBy,
+	}
+}
+
+// documentDate keep the date part of a time string
+func documentDate(s string) string {
+	if len(s) >= 10 {
+		return s[:10]
+	}
+	return s
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"github.com/jacky-htg/sales-service/internal/xlsx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const exportChunkSize = 64 << 10
+
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+type Export struct {
+	Db           *sql.DB
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	Cache        *cache.Cache
+}
+
+func (u *Export) ExportSales(in *rpc.ExportSalesRequest, stream rpc.ServerStream[rpc.ExportChunk]) error {
+	ctx := stream.Context()
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return err
+	}
+
+	w := newChunkWriter(stream, fmt.Sprintf("sales_%s_%s.%s", in.DateFrom, in.DateTo, in.Format), exportContentTypes[in.Format])
+	err = u.WriteSales(ctx, in, w)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func (u *Export) ExportSalesReturns(in *rpc.ExportSalesReturnRequest, stream rpc.ServerStream[rpc.ExportChunk]) error {
+	ctx := stream.Context()
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return err
+	}
+
+	w := newChunkWriter(stream, fmt.Sprintf("sales_returns_%s_%s.%s", in.DateFrom, in.DateTo, in.Format), exportContentTypes[in.Format])
+	err = u.WriteSalesReturns(ctx, in, w)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// WriteSales stream sales lines from database into w, used by ExportSales rpc and cli
+func (u *Export) WriteSales(ctx context.Context, in *rpc.ExportSalesRequest, w io.Writer) error {
+	dateFrom, dateTo, err := exportDateRange(in.Format, in.DateFrom, in.DateTo)
+	if err != nil {
+		return err
+	}
+
+	expr, err := filterExpression(ctx)
+	if err != nil {
+		return err
+	}
+
+	var salesModel model.Sales
+	query, paramQueries, err := salesModel.ExportQuery(ctx, in.Filter, dateFrom, dateTo, expr)
+	if err != nil {
+		return err
+	}
+
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	tw, err := newTableWriter(in.Format, w, "Sales")
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteRow([]interface{}{
+		"code", "sales_date", "branch", "customer_code", "customer_name", "salesman_code", "salesman_name", "remark",
+		"price", "additional_disc_amount", "additional_disc_percentage", "total_price",
+		"product_id", "quantity", "line_price", "line_disc_amount", "line_disc_percentage", "line_total_price",
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "write export: %v", err)
+	}
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var code, branchName, customerCode, customerName, salesmanCode, salesmanName, remark, productID string
+		var salesDate time.Time
+		var price, additionalDiscAmount, totalPrice, linePrice, lineDiscAmount, lineTotalPrice float64
+		var additionalDiscPercentage, lineDiscPercentage float32
+		var quantity int32
+		err = rows.Scan(&code, &salesDate, &branchName, &customerCode, &customerName, &salesmanCode, &salesmanName, &remark,
+			&price, &additionalDiscAmount, &additionalDiscPercentage, &totalPrice,
+			&productID, &quantity, &linePrice, &lineDiscAmount, &lineDiscPercentage, &lineTotalPrice)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		err = tw.WriteRow([]interface{}{
+			strings.TrimSpace(code), salesDate, branchName, strings.TrimSpace(customerCode), customerName, strings.TrimSpace(salesmanCode), salesmanName, remark,
+			price, additionalDiscAmount, additionalDiscPercentage, totalPrice,
+			productID, quantity, linePrice, lineDiscAmount, lineDiscPercentage, lineTotalPrice,
+		})
+		if err != nil {
+			return status.Errorf(codes.Internal, "write export: %v", err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return status.Errorf(codes.Internal, "close export: %v", err)
+	}
+
+	return nil
+}
+
+// WriteSalesReturns stream sales return lines from database into w, used by ExportSalesReturns rpc and cli
+func (u *Export) WriteSalesReturns(ctx context.Context, in *rpc.ExportSalesReturnRequest, w io.Writer) error {
+	dateFrom, dateTo, err := exportDateRange(in.Format, in.DateFrom, in.DateTo)
+	if err != nil {
+		return err
+	}
+
+	expr, err := filterExpression(ctx)
+	if err != nil {
+		return err
+	}
+
+	var salesReturnModel model.SalesReturn
+	query, paramQueries, err := salesReturnModel.ExportQuery(ctx, in.Filter, dateFrom, dateTo, expr)
+	if err != nil {
+		return err
+	}
+
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	tw, err := newTableWriter(in.Format, w, "Sales Returns")
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteRow([]interface{}{
+		"code", "return_date", "branch", "sales_code", "customer_code", "customer_name", "salesman_code", "salesman_name", "remark",
+		"price", "additional_disc_amount", "additional_disc_percentage", "total_price",
+		"product_id", "quantity", "line_price", "line_disc_amount", "line_disc_percentage", "line_total_price",
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "write export: %v", err)
+	}
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var code, branchName, salesCode, customerCode, customerName, salesmanCode, salesmanName, remark, productID string
+		var returnDate time.Time
+		var price, additionalDiscAmount, totalPrice, linePrice, lineDiscAmount, lineTotalPrice float64
+		var additionalDiscPercentage, lineDiscPercentage float32
+		var quantity int32
+		err = rows.Scan(&code, &returnDate, &branchName, &salesCode, &customerCode, &customerName, &salesmanCode, &salesmanName, &remark,
+			&price, &additionalDiscAmount, &additionalDiscPercentage, &totalPrice,
+			&productID, &quantity, &linePrice, &lineDiscAmount, &lineDiscPercentage, &lineTotalPrice)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		err = tw.WriteRow([]interface{}{
+			strings.TrimSpace(code), returnDate, branchName, strings.TrimSpace(salesCode), strings.TrimSpace(customerCode), customerName, strings.TrimSpace(salesmanCode), salesmanName, remark,
+			price, additionalDiscAmount, additionalDiscPercentage, totalPrice,
+			productID, quantity, linePrice, lineDiscAmount, lineDiscPercentage, lineTotalPrice,
+		})
+		if err != nil {
+			return status.Errorf(codes.Internal, "write export: %v", err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return status.Errorf(codes.Internal, "close export: %v", err)
+	}
+
+	return nil
+}
+
+func exportDateRange(format, from, to string) (time.Time, time.Time, error) {
+	if _, ok := exportContentTypes[format]; !ok {
+		return time.Time{}, time.Time{}, status.Error(codes.InvalidArgument, "Please supply valid format")
+	}
+
+	dateFrom, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return time.Time{}, time.Time{}, status.Error(codes.InvalidArgument, "Please supply valid date from")
+	}
+
+	dateTo, err := time.Parse("2006-01-02", to)
+	if err != nil || dateTo.Before(dateFrom) {
+		return time.Time{}, time.Time{}, status.Error(codes.InvalidArgument, "Please supply valid date to")
+	}
+
+	return dateFrom, dateTo, nil
+}
+
+type tableWriter interface {
+	WriteRow([]interface{}) error
+	Close() error
+}
+
+func newTableWriter(format string, w io.Writer, sheetName string) (tableWriter, error) {
+	if format == "xlsx" {
+		xw, err := xlsx.NewWriter(w, sheetName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "create xlsx: %v", err)
+		}
+		return xw, nil
+	}
+
+	return &csvWriter{w: csv.NewWriter(w)}, nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			record[i] = v
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case float32:
+			record[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+		case time.Time:
+			record[i] = v.Format("2006-01-02")
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// chunkWriter send everything written as stream chunks of exportChunkSize
+type chunkWriter struct {
+	stream      rpc.ServerStream[rpc.ExportChunk]
+	fileName    string
+	contentType string
+	buf         []byte
+	sent        bool
+}
+
+func newChunkWriter(stream rpc.ServerStream[rpc.ExportChunk], fileName, contentType string) *chunkWriter {
+	return &chunkWriter{stream: stream, fileName: fileName, contentType: contentType, buf: make([]byte, 0, exportChunkSize)}
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		space := exportChunkSize - len(c.buf)
+		if space > len(p) {
+			space = len(p)
+		}
+		c.buf = append(c.buf, p[:space]...)
+		p = p[space:]
+
+		if len(c.buf) == exportChunkSize {
+			if err := c.send(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (c *chunkWriter) Flush() error {
+	if len(c.buf) == 0 && c.sent {
+		return nil
+	}
+	return c.send()
+}
+
+func (c *chunkWriter) send() error {
+	chunk := &rpc.ExportChunk{Chunk: c.buf}
+	if !c.sent {
+		chunk.FileName = c.fileName
+		chunk.ContentType = c.contentType
+	}
+
+	if err := c.stream.Send(chunk); err != nil {
+		return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+	}
+
+	c.sent = true
+	c.buf = make([]byte, 0, exportChunkSize)
+	return nil
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jacky-htg/sales-service/internal/filter"
+	"google.golang.org/grpc/metadata"
+)
+
+// filterHeader is the grpc metadata of the filter expression of sales and sales return lists and exports,
+// e.g. sales_date >= 2024-01-01 AND total_price > 1000
+const filterHeader = "filter"
+
+// filterExpression parse the filter expression of the call, nil without one
+func filterExpression(ctx context.Context) (filter.Expression, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(filterHeader)
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil, nil
+	}
+
+	return filter.Parse(values[0])
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/jacky-htg/sales-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// idempotencyKeyHeader is the grpc metadata of the client supplied key
+const idempotencyKeyHeader = "idempotency-key"
+
+// idempotencyKey read the key of the call with the hash of the request, nil when the client sent no key.
+// Call it before the request is modified.
+func idempotencyKey(ctx context.Context, method string, in interface{}) (*model.IdempotencyKey, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(idempotencyKeyHeader)
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil, nil
+	}
+
+	if len(values[0]) > 100 {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key must be at most 100 characters")
+	}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "marshal request: %v", err)
+	}
+	sum := sha256.Sum256(data)
+
+	return &model.IdempotencyKey{Key: values[0], Method: method, RequestHash: hex.EncodeToString(sum[:])}, nil
+}
+
+// previousDocument return the document created by an earlier call with the same key, empty when there is none
+func previousDocument(ctx context.Context, db *sql.DB, key *model.IdempotencyKey) (string, error) {
+	if key == nil {
+		return "", nil
+	}
+
+	requestHash := key.RequestHash
+	found, err := key.Get(ctx, db)
+	if err != nil || !found {
+		return "", err
+	}
+
+	if key.RequestHash != requestHash {
+		return "", status.Error(codes.AlreadyExists, "idempotency key already used with a different request")
+	}
+
+	return key.DocumentID, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	request := map[string]interface{}{"customer_id": "c1", "details": []string{"p1", "p2"}}
+	same := map[string]interface{}{"details": []string{"p1", "p2"}, "customer_id": "c1"}
+	other := map[string]interface{}{"customer_id": "c2", "details": []string{"p1", "p2"}}
+
+	withKey := func(key ...string) context.Context {
+		md := metadata.MD{}
+		for _, k := range key {
+			md.Append(idempotencyKeyHeader, k)
+		}
+		return metadata.NewIncomingContext(context.Background(), md)
+	}
+
+	first, err := idempotencyKey(withKey("key-1"), "SalesCreate", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		in       interface{}
+		wantNil  bool
+		wantKey  string
+		sameHash bool
+		wantCode codes.Code
+	}{
+		{name: "without metadata", ctx: context.Background(), in: request, wantNil: true},
+		{name: "without key", ctx: withKey(), in: request, wantNil: true},
+		{name: "empty key", ctx: withKey(""), in: request, wantNil: true},
+		{name: "key too long", ctx: withKey(strings.Repeat("k", 101)), in: request, wantCode: codes.InvalidArgument},
+		{name: "longest key", ctx: withKey(strings.Repeat("k", 100)), in: request, wantKey: strings.Repeat("k", 100), sameHash: true},
+		{name: "first key of many", ctx: withKey("key-1", "key-2"), in: request, wantKey: "key-1", sameHash: true},
+		{name: "same request", ctx: withKey("key-1"), in: same, wantKey: "key-1", sameHash: true},
+		{name: "other request", ctx: withKey("key-1"), in: other, wantKey: "key-1", sameHash: false},
+		{name: "request can not be marshaled", ctx: withKey("key-1"), in: make(chan int), wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := idempotencyKey(tt.ctx, "SalesCreate", tt.in)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("idempotencyKey error %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if tt.wantNil {
+				if key != nil {
+					t.Errorf("idempotencyKey = %+v, want nil", key)
+				}
+				return
+			}
+
+			if key.Key != tt.wantKey || key.Method != "SalesCreate" || len(key.RequestHash) != 64 {
+				t.Errorf("idempotencyKey = %+v, want key %q of SalesCreate", key, tt.wantKey)
+			}
+			if (key.RequestHash == first.RequestHash) != tt.sameHash {
+				t.Errorf("request hash %s, first %s, want same %v", key.RequestHash, first.RequestHash, tt.sameHash)
+			}
+		})
+	}
+}
+
+func TestPreviousDocumentWithoutKey(t *testing.T) {
+	documentID, err := previousDocument(context.Background(), nil, nil)
+	if err != nil || len(documentID) > 0 {
+		t.Errorf("previousDocument = %q, %v, want no document", documentID, err)
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"github.com/jacky-htg/sales-service/internal/xlsx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxImportSize = 20 << 20
+
+var importColumns = map[string][]string{
+	"customer": {"code", "name", "address", "phone"},
+	"salesman": {"code", "name", "email", "address", "phone"},
+}
+
+type Import struct {
+	Db *sql.DB
+}
+
+func (u *Import) Import(stream rpc.ClientStream[rpc.ImportRequest, rpc.ImportResponse]) error {
+	ctx := stream.Context()
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	var first *rpc.ImportRequest
+	var data bytes.Buffer
+	for {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot receive stream request: %v", err)
+		}
+
+		if first == nil {
+			first = req
+		}
+
+		if data.Len()+len(req.Chunk) > maxImportSize {
+			return status.Error(codes.ResourceExhausted, "import file is too large")
+		}
+		data.Write(req.Chunk)
+	}
+
+	if first == nil {
+		return status.Error(codes.InvalidArgument, "Please supply import file")
+	}
+
+	res, err := u.Run(ctx, first.Entity, first.Format, data.Bytes(), first.DryRun)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(res)
+}
+
+// Run validate and upsert by code every row of the file in one transaction, used by Import rpc and cli.
+// A failed row is rolled back to its savepoint and reported, the other rows are committed.
+// Dry run write the rows the same way then roll back the transaction, so it report the errors of the database constraints too.
+func (u *Import) Run(ctx context.Context, entity, format string, data []byte, dryRun bool) (*rpc.ImportResponse, error) {
+	columns, ok := importColumns[entity]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid entity")
+	}
+
+	rows, err := readImportRows(format, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "import file has no header")
+	}
+
+	header := map[string]int{}
+	for i, name := range rows[0] {
+		header[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, column := range columns {
+		if _, ok := header[column]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "import file has no %s column", column)
+		}
+	}
+
+	tx, err := model.BeginTx(ctx, u.Db, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res := &rpc.ImportResponse{Entity: entity, DryRun: dryRun}
+	seen := map[string]int{}
+	for i, row := range rows[1:] {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return res, err
+		}
+
+		record := map[string]string{}
+		blank := true
+		for name, idx := range header {
+			if idx < len(row) {
+				record[name] = strings.TrimSpace(row[idx])
+				if len(record[name]) > 0 {
+					blank = false
+				}
+			}
+		}
+
+		if blank {
+			continue
+		}
+
+		rowResult := &rpc.ImportRowResult{Row: i + 2, Code: record["code"]}
+		res.Total++
+
+		if prev, ok := seen[record["code"]]; ok && len(record["code"]) > 0 {
+			err = status.Errorf(codes.InvalidArgument, "duplicate code with row %d", prev)
+		} else {
+			seen[record["code"]] = rowResult.Row
+			rowResult.Action, err = u.importRow(ctx, tx, entity, record)
+		}
+
+		switch {
+		case err != nil:
+			rowResult.Error = status.Convert(err).Message()
+			res.Failed++
+		case rowResult.Action == "create":
+			res.Created++
+		default:
+			res.Updated++
+		}
+
+		res.Rows = append(res.Rows, rowResult)
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return res, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
+	}
+
+	return res, nil
+}
+
+// importRow upsert a row inside a savepoint, an error roll back the row only and keep the transaction usable
+func (u *Import) importRow(ctx context.Context, tx *sql.Tx, entity string, record map[string]string) (string, error) {
+	_, err := tx.ExecContext(ctx, `SAVEPOINT import_row`)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "savepoint import row: %v", err)
+	}
+
+	var action string
+	if entity == "customer" {
+		action, err = u.importCustomer(ctx, tx, record)
+	} else {
+		action, err = u.importSalesman(ctx, tx, record)
+	}
+
+	if err != nil {
+		if _, errRollback := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`); errRollback != nil {
+			return action, status.Errorf(codes.Internal, "rollback import row: %v", errRollback)
+		}
+		return action, err
+	}
+
+	_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row`)
+	if err != nil {
+		return action, status.Errorf(codes.Internal, "release import row: %v", err)
+	}
+
+	return action, nil
+}
+
+func (u *Import) importCustomer(ctx context.Context, tx *sql.Tx, record map[string]string) (string, error) {
+	in := &sales.Customer{
+		Code:    record["code"],
+		Name:    record["name"],
+		Address: record["address"],
+		Phone:   record["phone"],
+	}
+
+	err := customerValidation(in)
+	if err != nil {
+		return "", err
+	}
+
+	var customerModel model.Customer
+	customerModel.Pb.Code = in.GetCode()
+	err = customerModel.GetByCodeTx(ctx, tx)
+	if err != nil {
+		if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+			return "", err
+		}
+
+		customerModel = model.Customer{TaxID: record["tax_id"]}
+		customerModel.Pb = sales.Customer{
+			Code:    in.GetCode(),
+			Name:    in.GetName(),
+			Address: in.GetAddress(),
+			Phone:   in.GetPhone(),
+		}
+		return "create", customerModel.CreateTx(ctx, tx)
+	}
+
+	customerModel.Pb.Name = in.GetName()
+	customerModel.Pb.Address = in.GetAddress()
+	customerModel.Pb.Phone = in.GetPhone()
+	if len(record["tax_id"]) > 0 {
+		customerModel.TaxID = record["tax_id"]
+	}
+
+	return "update", customerModel.UpdateTx(ctx, tx)
+}
+
+func (u *Import) importSalesman(ctx context.Context, tx *sql.Tx, record map[string]string) (string, error) {
+	in := &sales.Salesman{
+		Code:    record["code"],
+		Name:    record["name"],
+		Email:   record["email"],
+		Address: record["address"],
+		Phone:   record["phone"],
+	}
+
+	err := salesmanValidation(in)
+	if err != nil {
+		return "", err
+	}
+
+	var salesmanModel model.Salesman
+	salesmanModel.Pb.Code = in.GetCode()
+	err = salesmanModel.GetByCodeTx(ctx, tx)
+	if err != nil {
+		if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+			return "", err
+		}
+
+		salesmanModel = model.Salesman{}
+		salesmanModel.Pb = sales.Salesman{
+			Code:    in.GetCode(),
+			Name:    in.GetName(),
+			Email:   in.GetEmail(),
+			Address: in.GetAddress(),
+			Phone:   in.GetPhone(),
+		}
+		return "create", salesmanModel.CreateTx(ctx, tx)
+	}
+
+	salesmanModel.Pb.Name = in.GetName()
+	salesmanModel.Pb.Email = in.GetEmail()
+	salesmanModel.Pb.Address = in.GetAddress()
+	salesmanModel.Pb.Phone = in.GetPhone()
+
+	return "update", salesmanModel.UpdateTx(ctx, tx)
+}
+
+func readImportRows(format string, data []byte) ([][]string, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		r.FieldsPerRecord = -1
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "read csv: %v", err)
+		}
+		return rows, nil
+
+	case "xlsx":
+		rows, err := xlsx.ReadFirstSheet(data)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "read xlsx: %v", err)
+		}
+		return rows, nil
+	}
+
+	return nil, status.Error(codes.InvalidArgument, "Please supply valid format")
+}
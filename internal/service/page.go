@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jacky-htg/sales-service/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// pageTokenHeader is the grpc metadata of the cursor of the next page, sent back by the client to read it.
+	// The list answer it as trailer, absent on the last page.
+	pageTokenHeader = "page-token"
+	// pageModeHeader set to keyset read the first page in keyset mode, a page token imply it
+	pageModeHeader = "page-mode"
+	// totalCountHeader is true or false, the count of the pagination response is computed by default in offset mode only
+	totalCountHeader = "total-count"
+)
+
+// listPage read how the list is paged from the metadata of the call
+func listPage(ctx context.Context) (*model.Page, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	keyset := false
+	if values := md.Get(pageModeHeader); len(values) > 0 {
+		switch values[0] {
+		case "keyset":
+			keyset = true
+		case "", "offset":
+		default:
+			return nil, status.Error(codes.InvalidArgument, "page mode must be offset or keyset")
+		}
+	}
+
+	var token string
+	if values := md.Get(pageTokenHeader); len(values) > 0 {
+		token = values[0]
+	}
+
+	count := !keyset && len(token) == 0
+	if values := md.Get(totalCountHeader); len(values) > 0 && len(values[0]) > 0 {
+		var err error
+		count, err = strconv.ParseBool(values[0])
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Please supply valid total count")
+		}
+	}
+
+	return model.NewPage(keyset, token, count)
+}
+
+// sendNextPage return the token of the next page as trailer, none on the last page
+func sendNextPage(ctx context.Context, page *model.Page) {
+	if next := page.Next(); len(next) > 0 {
+		grpc.SetTrailer(ctx, metadata.Pairs(pageTokenHeader, next))
+	}
+}
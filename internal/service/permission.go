@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/sales-service/internal/auth"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Permission struct {
+	Db         *sql.DB
+	Authorizer *auth.Authorizer
+}
+
+func (u *Permission) PermissionList(ctx context.Context, in *rpc.Empty) (*rpc.PermissionCatalog, error) {
+	return &rpc.PermissionCatalog{Permissions: auth.Permissions()}, nil
+}
+
+func (u *Permission) RolePermissionView(ctx context.Context, in *rpc.RoleRequest) (*rpc.RolePermission, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.GroupId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid group id")
+	}
+
+	roleModel := model.RolePermission{GroupID: in.GroupId}
+	err = roleModel.Get(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return roleResponse(&roleModel), nil
+}
+
+// RolePermissionUpdate replace the permissions of the group, cached permissions are dropped
+func (u *Permission) RolePermissionUpdate(ctx context.Context, in *rpc.RolePermission) (*rpc.RolePermission, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.GroupId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid group id")
+	}
+
+	for _, permission := range in.Permissions {
+		if !auth.IsPermission(permission) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown permission %s", permission)
+		}
+	}
+
+	roleModel := model.RolePermission{GroupID: in.GroupId, Permissions: in.Permissions}
+	err = roleModel.Save(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Authorizer.Invalidate()
+
+	return roleResponse(&roleModel), nil
+}
+
+func roleResponse(roleModel *model.RolePermission) *rpc.RolePermission {
+	return &rpc.RolePermission{
+		GroupId:     roleModel.GroupID,
+		Permissions: roleModel.Permissions,
+		UpdatedAt:   roleModel.UpdatedAt,
+		UpdatedBy:   roleModel.UpdatedBy,
+	}
+}
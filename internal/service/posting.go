@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Posting struct {
+	Db           *sql.DB
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	Cache        *cache.Cache
+}
+
+func (u *Posting) LedgerAccountView(ctx context.Context, in *rpc.Empty) (*rpc.LedgerAccounts, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accountModel := model.LedgerAccount{CompanyID: ctx.Value(app.Ctx("companyID")).(string)}
+	err = accountModel.Get(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return ledgerAccountResponse(&accountModel), nil
+}
+
+func (u *Posting) LedgerAccountUpdate(ctx context.Context, in *rpc.LedgerAccounts) (*rpc.LedgerAccounts, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range []string{in.Revenue, in.Receivable, in.SalesDiscount, in.SalesReturn, in.TaxPayable} {
+		if len(code) > 20 {
+			return nil, status.Error(codes.InvalidArgument, "account code must be at most 20 characters")
+		}
+	}
+
+	accountModel := model.LedgerAccount{
+		Revenue:       in.Revenue,
+		Receivable:    in.Receivable,
+		SalesDiscount: in.SalesDiscount,
+		SalesReturn:   in.SalesReturn,
+		TaxPayable:    in.TaxPayable,
+	}
+	err = accountModel.Save(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return ledgerAccountResponse(&accountModel), nil
+}
+
+func (u *Posting) PostingStatus(ctx context.Context, in *rpc.DocumentRef) (*rpc.PostingStatusResponse, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.postingStatus(ctx, in)
+}
+
+// PostingRetry make failed postings of the document due now instead of waiting for the backoff
+func (u *Posting) PostingRetry(ctx context.Context, in *rpc.DocumentRef) (*rpc.PostingStatusResponse, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := u.postingStatus(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	err = model.RetryJournalPostings(ctx, u.Db, in.DocumentType, in.DocumentId)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (u *Posting) postingStatus(ctx context.Context, in *rpc.DocumentRef) (*rpc.PostingStatusResponse, error) {
+	if len(in.DocumentId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid document id")
+	}
+
+	postingStatus, err := model.DocumentPostingStatus(ctx, u.Db, in.DocumentType, in.DocumentId)
+	if err != nil {
+		return nil, err
+	}
+
+	postings, err := model.ListJournalPostings(ctx, u.Db, in.DocumentType, in.DocumentId)
+	if err != nil {
+		return nil, err
+	}
+
+	response := rpc.PostingStatusResponse{
+		DocumentType: in.DocumentType,
+		DocumentId:   in.DocumentId,
+		Status:       postingStatus,
+	}
+	for _, p := range postings {
+		posting := rpc.Posting{
+			Id:            p.Id,
+			Status:        p.Status,
+			JournalId:     p.JournalID,
+			Attempts:      p.Attempts,
+			LastError:     p.LastError,
+			NextAttemptAt: p.NextAttemptAt.String(),
+			CreatedAt:     p.CreatedAt.String(),
+		}
+		if p.PostedAt.Valid {
+			posting.PostedAt = p.PostedAt.Time.String()
+		}
+		response.Postings = append(response.Postings, &posting)
+	}
+
+	return &response, nil
+}
+
+func ledgerAccountResponse(accountModel *model.LedgerAccount) *rpc.LedgerAccounts {
+	return &rpc.LedgerAccounts{
+		Revenue:       accountModel.Revenue,
+		Receivable:    accountModel.Receivable,
+		SalesDiscount: accountModel.SalesDiscount,
+		SalesReturn:   accountModel.SalesReturn,
+		TaxPayable:    accountModel.TaxPayable,
+		UpdatedAt:     accountModel.UpdatedAt,
+		UpdatedBy:     accountModel.UpdatedBy,
+	}
+}
@@ -3,12 +3,20 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/auth"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/ledger"
+	"github.com/jacky-htg/sales-service/internal/metrics"
 	"github.com/jacky-htg/sales-service/internal/model"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -21,6 +29,7 @@ type Sales struct {
 	BranchClient   users.BranchServiceClient
 	ProductClient  inventories.ProductServiceClient
 	DeliveryClient inventories.DeliveryServiceClient
+	Cache          *cache.Cache
 	sales.UnimplementedSalesServiceServer
 }
 
@@ -35,6 +44,18 @@ func (u *Sales) Create(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		return &salesModel.Pb, err
 	}
 
+	idempotency, err := idempotencyKey(ctx, "SalesCreate", in)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
+	// a retried call return the sales created by the first call
+	if salesID, err := previousDocument(ctx, u.Db, idempotency); err != nil {
+		return &salesModel.Pb, err
+	} else if len(salesID) > 0 {
+		return u.createdSales(ctx, salesID)
+	}
+
 	products, err := u.createValidation(ctx, in)
 	if err != nil {
 		return &salesModel.Pb, err
@@ -52,7 +73,7 @@ func (u *Sales) Create(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		if detail.DiscPercentage > 0 {
 			detail.DiscAmount = detail.GetPrice() * float64(detail.DiscPercentage) / 100
 		}
-		detail.TotalPrice = (detail.GetPrice() + detail.DiscAmount) * float64(detail.Quantity)
+		detail.TotalPrice = (detail.GetPrice() - detail.DiscAmount) * float64(detail.Quantity)
 		sumPrice += detail.TotalPrice
 	}
 
@@ -60,6 +81,7 @@ func (u *Sales) Create(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		UserClient:   u.UserClient,
 		RegionClient: u.RegionClient,
 		BranchClient: u.BranchClient,
+		Cache:        u.Cache,
 		Id:           in.GetBranchId(),
 	}
 	err = mBranch.IsYourBranch(ctx)
@@ -90,9 +112,28 @@ func (u *Sales) Create(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		Details:                  in.GetDetails(),
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
+	err = approveDiscount(ctx, sumPrice, in.GetAdditionalDiscAmount(), in.GetDetails())
 	if err != nil {
-		return &salesModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		return &salesModel.Pb, err
+	}
+
+	tx, err := model.BeginTx(ctx, u.Db, nil)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
+	if idempotency != nil {
+		claimed, err := idempotency.Claim(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			return &salesModel.Pb, err
+		}
+
+		// a concurrent call with the same key has created the sales
+		if !claimed {
+			tx.Rollback()
+			return u.createdSales(ctx, idempotency.DocumentID)
+		}
 	}
 
 	err = salesModel.Create(ctx, tx)
@@ -101,11 +142,47 @@ func (u *Sales) Create(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		return &salesModel.Pb, err
 	}
 
+	if idempotency != nil {
+		err = idempotency.Complete(ctx, tx, salesModel.Pb.GetId())
+		if err != nil {
+			tx.Rollback()
+			return &salesModel.Pb, err
+		}
+	}
+
+	err = addEvent(ctx, tx, model.AggregateSales, salesModel.Pb.GetId(), model.EventSalesCreated, &salesModel.Pb)
+	if err != nil {
+		tx.Rollback()
+		return &salesModel.Pb, err
+	}
+
+	err = addPosting(ctx, tx, model.AggregateSales, salesModel.Pb.GetId(), salesModel.Pb.GetCode(), salesModel.Pb.GetBranchId(),
+		salesModel.Pb.GetSalesDate(), ledger.SalesEntry(&salesModel.Pb))
+	if err != nil {
+		tx.Rollback()
+		return &salesModel.Pb, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return &salesModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
 	}
 
+	metrics.OrderCreated(ctx.Value(app.Ctx("companyID")).(string), salesModel.Pb.GetBranchId(), salesModel.Pb.GetTotalPrice())
+
+	sendVersion(ctx, salesModel.Version)
+	return &salesModel.Pb, nil
+}
+
+func (u *Sales) createdSales(ctx context.Context, salesID string) (*sales.Sales, error) {
+	var salesModel model.Sales
+	salesModel.Pb.Id = salesID
+	err := salesModel.Get(ctx, u.Db)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
+	sendVersion(ctx, salesModel.Version)
 	return &salesModel.Pb, nil
 }
 
@@ -120,6 +197,26 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 	}
 	salesModel.Pb.Id = in.GetId()
 
+	ctx, err = app.GetMetadata(ctx)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
+	err = salesModel.Get(ctx, u.Db)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
+	err = checkVersion(ctx, "sales", salesModel.Version)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
 	// if any return, do update will be blocked
 	{
 		purchaseReturnModel := model.SalesReturn{
@@ -142,14 +239,21 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		return &salesModel.Pb, status.Error(codes.PermissionDenied, "Can not updated because the sales has delivery transaction")
 	}
 
-	ctx, err = app.GetMetadata(ctx)
-	if err != nil {
-		return &salesModel.Pb, err
-	}
+	// new customer or salesman of the sales must be active
+	{
+		var customerID, salesmanID string
+		if len(in.GetCustomer().GetId()) > 0 && in.GetCustomer().GetId() != salesModel.Pb.GetCustomer().GetId() {
+			customerID = in.GetCustomer().GetId()
+		}
 
-	err = salesModel.Get(ctx, u.Db)
-	if err != nil {
-		return &salesModel.Pb, err
+		if len(in.GetSalesman().GetId()) > 0 && in.GetSalesman().GetId() != salesModel.Pb.GetSalesman().GetId() {
+			salesmanID = in.GetSalesman().GetId()
+		}
+
+		err = u.validateParties(ctx, customerID, salesmanID)
+		if err != nil {
+			return &salesModel.Pb, err
+		}
 	}
 
 	// update field of sales header
@@ -175,16 +279,10 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		}
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
-	if err != nil {
-		return &salesModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
-	}
-
-	var newDetails []*sales.SalesDetail
+	// validate bulk product by call product grpc before the transaction, like create
 	var productIds []string
 	for _, detail := range in.GetDetails() {
 		if len(detail.GetProductId()) == 0 {
-			tx.Rollback()
 			return &salesModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid product")
 		}
 
@@ -193,6 +291,7 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 
 	mProduct := model.Product{
 		Client: u.ProductClient,
+		Cache:  u.Cache,
 		Pb:     &inventories.Product{},
 	}
 
@@ -200,11 +299,20 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 		Ids: productIds,
 	}
 	products, err := mProduct.List(ctx, &inProductList)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
 
 	if len(products) != len(productIds) {
 		return &salesModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid product")
 	}
 
+	tx, err := model.BeginTx(ctx, u.Db, nil)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
+	var details []*sales.SalesDetail
 	var sumPrice float64
 	for _, detail := range in.GetDetails() {
 		for _, p := range products {
@@ -249,6 +357,7 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 						tx.Rollback()
 						return &salesModel.Pb, err
 					}
+					details = append(details, &purchaseDetailModel.Pb)
 					break
 				}
 			}
@@ -258,11 +367,12 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 				Pb: sales.SalesDetail{
 					SalesId:        salesModel.Pb.GetId(),
 					ProductId:      detail.ProductId,
-					ProductCode:    mProduct.Pb.GetCode(),
-					ProductName:    mProduct.Pb.GetName(),
+					ProductCode:    detail.GetProductCode(),
+					ProductName:    detail.GetProductName(),
 					Price:          detail.GetPrice(),
 					DiscAmount:     detail.GetDiscAmount(),
 					DiscPercentage: detail.GetDiscPercentage(),
+					Quantity:       detail.GetQuantity(),
 					TotalPrice:     detail.GetTotalPrice(),
 				},
 			}
@@ -273,7 +383,7 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 				return &salesModel.Pb, err
 			}
 
-			newDetails = append(newDetails, &purchaseDetailModel.Pb)
+			details = append(details, &purchaseDetailModel.Pb)
 		}
 	}
 
@@ -296,17 +406,38 @@ func (u *Sales) Update(ctx context.Context, in *sales.Sales) (*sales.Sales, erro
 	}
 	salesModel.Pb.TotalPrice = sumPrice - salesModel.Pb.AdditionalDiscAmount
 
+	err = approveDiscount(ctx, sumPrice, salesModel.Pb.AdditionalDiscAmount, details)
+	if err != nil {
+		tx.Rollback()
+		return &salesModel.Pb, err
+	}
+
 	err = salesModel.Update(ctx, tx)
 	if err != nil {
 		tx.Rollback()
 		return &salesModel.Pb, err
 	}
 
+	salesModel.Pb.Details = details
+	err = addEvent(ctx, tx, model.AggregateSales, salesModel.Pb.GetId(), model.EventSalesUpdated, &salesModel.Pb)
+	if err != nil {
+		tx.Rollback()
+		return &salesModel.Pb, err
+	}
+
+	err = addPosting(ctx, tx, model.AggregateSales, salesModel.Pb.GetId(), salesModel.Pb.GetCode(), salesModel.Pb.GetBranchId(),
+		salesModel.Pb.GetSalesDate(), ledger.SalesEntry(&salesModel.Pb))
+	if err != nil {
+		tx.Rollback()
+		return &salesModel.Pb, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return &salesModel.Pb, status.Errorf(codes.Internal, "failed commit transaction: %v", err)
 	}
 
+	sendVersion(ctx, salesModel.Version)
 	return &salesModel.Pb, nil
 }
 
@@ -324,11 +455,17 @@ func (u *Sales) View(ctx context.Context, in *sales.Id) (*sales.Sales, error) {
 		return &salesModel.Pb, err
 	}
 
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return &salesModel.Pb, err
+	}
+
 	err = salesModel.Get(ctx, u.Db)
 	if err != nil {
 		return &salesModel.Pb, err
 	}
 
+	sendVersion(ctx, salesModel.Version)
 	return &salesModel.Pb, nil
 }
 
@@ -339,10 +476,34 @@ func (u *Sales) List(in *sales.ListSalesRequest, stream sales.SalesService_Sales
 		return err
 	}
 
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return err
+	}
+
+	page, err := listPage(ctx)
+	if err != nil {
+		return err
+	}
+
+	expr, err := filterExpression(ctx)
+	if err != nil {
+		return err
+	}
+
 	var salesModel model.Sales
-	query, paramQueries, paginationResponse, err := salesModel.ListQuery(ctx, u.Db, in)
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, paramQueries, paginationResponse, err := salesModel.ListQuery(ctx, tx, in, page, expr)
+	if err != nil {
+		return err
+	}
 
-	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
 	if err != nil {
 		return status.Error(codes.Internal, err.Error())
 	}
@@ -355,18 +516,25 @@ func (u *Sales) List(in *sales.ListSalesRequest, stream sales.SalesService_Sales
 			return err
 		}
 
-		var pbSales sales.Sales
+		pbSales := sales.Sales{Customer: &sales.Customer{}, Salesman: &sales.Salesman{}}
 		var companyID string
 		var createdAt, updatedAt time.Time
 		err = rows.Scan(&pbSales.Id, &companyID, &pbSales.BranchId, &pbSales.BranchName,
 			&pbSales.Customer.Id, &pbSales.Salesman.Id,
 			&pbSales.Code, &pbSales.SalesDate, &pbSales.Remark,
 			&pbSales.Price, &pbSales.AdditionalDiscAmount, &pbSales.AdditionalDiscPercentage, &pbSales.TotalPrice,
-			&createdAt, &pbSales.CreatedBy, &updatedAt, &pbSales.UpdatedBy)
+			&createdAt, &pbSales.CreatedBy, &updatedAt, &pbSales.UpdatedBy, &pbSales.Customer.Name)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
 
+		if !page.Scanned(pbSales.Id, map[string]interface{}{
+			"created_at": createdAt, "code": pbSales.Code, "sales_date": pbSales.SalesDate,
+			"total_price": pbSales.TotalPrice, "customer_name": pbSales.Customer.Name,
+		}) {
+			break
+		}
+
 		pbSales.CreatedAt = createdAt.String()
 		pbSales.UpdatedAt = updatedAt.String()
 
@@ -380,6 +548,7 @@ func (u *Sales) List(in *sales.ListSalesRequest, stream sales.SalesService_Sales
 			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
 		}
 	}
+	sendNextPage(ctx, page)
 	return nil
 }
 
@@ -400,6 +569,10 @@ func (u *Sales) createValidation(ctx context.Context, in *sales.Sales) ([]*inven
 		return []*inventories.ListProductResponse{}, status.Error(codes.InvalidArgument, "Please supply valid date")
 	}
 
+	if err := u.validateParties(ctx, in.GetCustomer().GetId(), in.GetSalesman().GetId()); err != nil {
+		return []*inventories.ListProductResponse{}, err
+	}
+
 	// validate bulk product by call product grpc
 	var productIds []string
 	for _, detail := range in.GetDetails() {
@@ -412,6 +585,7 @@ func (u *Sales) createValidation(ctx context.Context, in *sales.Sales) ([]*inven
 
 	mProduct := model.Product{
 		Client: u.ProductClient,
+		Cache:  u.Cache,
 		Pb:     &inventories.Product{},
 	}
 
@@ -429,3 +603,92 @@ func (u *Sales) createValidation(ctx context.Context, in *sales.Sales) ([]*inven
 
 	return products, nil
 }
+
+func (u *Sales) validateParties(ctx context.Context, customerID, salesmanID string) error {
+	if len(customerID) > 0 {
+		mCustomer := model.Customer{Pb: sales.Customer{Id: customerID}}
+		if err := mCustomer.Get(ctx, u.Db); err != nil {
+			return err
+		}
+
+		if !mCustomer.IsActive {
+			return status.Errorf(codes.FailedPrecondition, "customer %s is inactive", strings.TrimSpace(mCustomer.Pb.GetCode()))
+		}
+	}
+
+	if len(salesmanID) > 0 {
+		mSalesman := model.Salesman{Pb: sales.Salesman{Id: salesmanID}}
+		if err := mSalesman.Get(ctx, u.Db); err != nil {
+			return err
+		}
+
+		if !mSalesman.IsActive {
+			return status.Errorf(codes.FailedPrecondition, "salesman %s is inactive", strings.TrimSpace(mSalesman.Pb.GetCode()))
+		}
+	}
+
+	return nil
+}
+
+// addEvent write the domain event to the outbox in the transaction of the document
+func addEvent(ctx context.Context, tx *sql.Tx, aggregateType, aggregateID, eventType string, payload interface{}) error {
+	e, err := model.NewOutboxEvent(aggregateType, aggregateID, eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	return e.Create(ctx, tx)
+}
+
+// addPosting queue the journal entry of the document for the general ledger in the transaction of the document
+func addPosting(ctx context.Context, tx *sql.Tx, documentType, documentID, documentCode, branchID, documentDate string, lines []ledger.Line) error {
+	data, err := json.Marshal(lines)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal posting lines: %v", err)
+	}
+
+	posting := model.JournalPosting{
+		BranchID:     branchID,
+		DocumentType: documentType,
+		DocumentID:   documentID,
+		DocumentCode: documentCode,
+		DocumentDate: parseDocumentDate(documentDate),
+		Lines:        data,
+	}
+
+	return posting.Create(ctx, tx)
+}
+
+// parseDocumentDate fallback to now when the date can not be parsed
+func parseDocumentDate(s string) time.Time {
+	t, err := model.ParseDate(s)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return t
+}
+
+// approveDiscount require sales:approve-discount when a line or the additional discount exceed MAX_DISCOUNT_PERCENTAGE (default 10)
+func approveDiscount(ctx context.Context, price, additionalDisc float64, details []*sales.SalesDetail) error {
+	if auth.Can(ctx, auth.SalesApproveDiscount) {
+		return nil
+	}
+
+	maxDiscount := 10.0
+	if max, err := strconv.ParseFloat(os.Getenv("MAX_DISCOUNT_PERCENTAGE"), 64); err == nil {
+		maxDiscount = max
+	}
+
+	exceed := price > 0 && additionalDisc*100/price > maxDiscount
+	for _, detail := range details {
+		if detail.GetPrice() > 0 && detail.GetDiscAmount()*100/detail.GetPrice() > maxDiscount {
+			exceed = true
+		}
+	}
+
+	if exceed {
+		return status.Errorf(codes.PermissionDenied, "discount above %v%% require permission %s", maxDiscount, auth.SalesApproveDiscount)
+	}
+
+	return nil
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/ledger"
+	"github.com/jacky-htg/sales-service/internal/metrics"
 	"github.com/jacky-htg/sales-service/internal/model"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -20,6 +23,7 @@ type SalesReturn struct {
 	RegionClient   users.RegionServiceClient
 	BranchClient   users.BranchServiceClient
 	DeliveryClient inventories.DeliveryServiceClient
+	Cache          *cache.Cache
 	sales.UnimplementedSalesReturnServiceServer
 }
 
@@ -46,6 +50,23 @@ func (u *SalesReturn) Create(ctx context.Context, in *sales.SalesReturn) (*sales
 		return &salesReturnModel.Pb, err
 	}
 
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return &salesReturnModel.Pb, err
+	}
+
+	idempotency, err := idempotencyKey(ctx, "SalesReturnCreate", in)
+	if err != nil {
+		return &salesReturnModel.Pb, err
+	}
+
+	// a retried call return the sales return created by the first call, before outstanding validation rejects it
+	if salesReturnID, err := previousDocument(ctx, u.Db, idempotency); err != nil {
+		return &salesReturnModel.Pb, err
+	} else if len(salesReturnID) > 0 {
+		return u.createdSalesReturn(ctx, salesReturnID)
+	}
+
 	// validate not any delivery order yet
 	mDelivery := model.Delivery{Client: u.DeliveryClient}
 	hasDelivery, err := mDelivery.HasTransactionBySales(ctx, in.Sales.Id)
@@ -103,6 +124,7 @@ func (u *SalesReturn) Create(ctx context.Context, in *sales.SalesReturn) (*sales
 		UserClient:   u.UserClient,
 		RegionClient: u.RegionClient,
 		BranchClient: u.BranchClient,
+		Cache:        u.Cache,
 		Id:           in.GetBranchId(),
 	}
 	err = mBranch.IsYourBranch(ctx)
@@ -146,22 +168,72 @@ func (u *SalesReturn) Create(ctx context.Context, in *sales.SalesReturn) (*sales
 		Details:                  in.GetDetails(),
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
+	tx, err := model.BeginTx(ctx, u.Db, nil)
 	if err != nil {
 		return &salesReturnModel.Pb, err
 	}
 
+	if idempotency != nil {
+		claimed, err := idempotency.Claim(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			return &salesReturnModel.Pb, err
+		}
+
+		// a concurrent call with the same key has created the sales return
+		if !claimed {
+			tx.Rollback()
+			return u.createdSalesReturn(ctx, idempotency.DocumentID)
+		}
+	}
+
 	err = salesReturnModel.Create(ctx, tx)
 	if err != nil {
 		tx.Rollback()
 		return &salesReturnModel.Pb, err
 	}
 
+	if idempotency != nil {
+		err = idempotency.Complete(ctx, tx, salesReturnModel.Pb.GetId())
+		if err != nil {
+			tx.Rollback()
+			return &salesReturnModel.Pb, err
+		}
+	}
+
+	err = addEvent(ctx, tx, model.AggregateSalesReturn, salesReturnModel.Pb.GetId(), model.EventSalesReturnCreated, &salesReturnModel.Pb)
+	if err != nil {
+		tx.Rollback()
+		return &salesReturnModel.Pb, err
+	}
+
+	err = addPosting(ctx, tx, model.AggregateSalesReturn, salesReturnModel.Pb.GetId(), salesReturnModel.Pb.GetCode(), salesReturnModel.Pb.GetBranchId(),
+		salesReturnModel.Pb.GetReturnDate(), ledger.SalesReturnEntry(&salesReturnModel.Pb))
+	if err != nil {
+		tx.Rollback()
+		return &salesReturnModel.Pb, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return &salesReturnModel.Pb, status.Error(codes.Internal, "Error when commit transaction")
 	}
 
+	metrics.ReturnCreated(ctx.Value(app.Ctx("companyID")).(string), salesReturnModel.Pb.GetBranchId(), salesReturnModel.Pb.GetTotalPrice())
+
+	sendVersion(ctx, salesReturnModel.Version)
+	return &salesReturnModel.Pb, nil
+}
+
+func (u *SalesReturn) createdSalesReturn(ctx context.Context, salesReturnID string) (*sales.SalesReturn, error) {
+	var salesReturnModel model.SalesReturn
+	salesReturnModel.Pb.Id = salesReturnID
+	err := salesReturnModel.Get(ctx, u.Db)
+	if err != nil {
+		return &salesReturnModel.Pb, err
+	}
+
+	sendVersion(ctx, salesReturnModel.Version)
 	return &salesReturnModel.Pb, nil
 }
 
@@ -179,11 +251,17 @@ func (u *SalesReturn) View(ctx context.Context, in *sales.Id) (*sales.SalesRetur
 		return &salesReturnModel.Pb, err
 	}
 
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return &salesReturnModel.Pb, err
+	}
+
 	err = salesReturnModel.Get(ctx, u.Db)
 	if err != nil {
 		return &salesReturnModel.Pb, err
 	}
 
+	sendVersion(ctx, salesReturnModel.Version)
 	return &salesReturnModel.Pb, nil
 }
 
@@ -203,6 +281,11 @@ func (u *SalesReturn) Update(ctx context.Context, in *sales.SalesReturn) (*sales
 		return &salesReturnModel.Pb, err
 	}
 
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return &salesReturnModel.Pb, err
+	}
+
 	// validate not any delivery order yet
 	mDelivery := model.Delivery{Client: u.DeliveryClient}
 	hasDelivery, err := mDelivery.HasTransactionBySales(ctx, in.Sales.Id)
@@ -228,13 +311,18 @@ func (u *SalesReturn) Update(ctx context.Context, in *sales.SalesReturn) (*sales
 		return &salesReturnModel.Pb, err
 	}
 
+	err = checkVersion(ctx, "sales return", salesReturnModel.Version)
+	if err != nil {
+		return &salesReturnModel.Pb, err
+	}
+
 	if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetReturnDate()); err == nil {
 		salesReturnModel.Pb.ReturnDate = in.GetReturnDate()
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
+	tx, err := model.BeginTx(ctx, u.Db, nil)
 	if err != nil {
-		return &salesReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		return &salesReturnModel.Pb, err
 	}
 
 	var sumPrice float64
@@ -258,6 +346,15 @@ func (u *SalesReturn) Update(ctx context.Context, in *sales.SalesReturn) (*sales
 				}
 			}
 
+			// price and discount of existing detail come from the sales, not from request
+			for _, data := range salesReturnModel.Pb.GetDetails() {
+				if data.GetId() == detail.GetId() {
+					detail.Price = data.GetPrice()
+					detail.DiscAmount = data.GetDiscAmount()
+					break
+				}
+			}
+
 			returnQty += detail.Quantity
 			detail.TotalPrice = (detail.Price - detail.DiscAmount) * float64(detail.Quantity)
 			sumPrice += detail.TotalPrice
@@ -278,10 +375,12 @@ func (u *SalesReturn) Update(ctx context.Context, in *sales.SalesReturn) (*sales
 				return &salesReturnModel.Pb, err
 			}
 
-			newDetails = append(newDetails, &salesReturnDetailModel.Pb)
 			for index, data := range salesReturnModel.Pb.GetDetails() {
 				if data.GetId() == detail.GetId() {
 					salesReturnModel.Pb.Details = append(salesReturnModel.Pb.Details[:index], salesReturnModel.Pb.Details[index+1:]...)
+					data.Quantity = detail.Quantity
+					data.TotalPrice = detail.TotalPrice
+					newDetails = append(newDetails, data)
 					break
 				}
 			}
@@ -352,17 +451,38 @@ func (u *SalesReturn) Update(ctx context.Context, in *sales.SalesReturn) (*sales
 		}
 	}
 
+	salesReturnModel.Pb.Price = sumPrice
+	if salesReturnModel.Pb.AdditionalDiscPercentage > 0 {
+		salesReturnModel.Pb.AdditionalDiscAmount = sumPrice * float64(salesReturnModel.Pb.AdditionalDiscPercentage) / 100
+	}
+	salesReturnModel.Pb.TotalPrice = sumPrice - salesReturnModel.Pb.AdditionalDiscAmount
+
 	err = salesReturnModel.Update(ctx, tx)
 	if err != nil {
 		tx.Rollback()
 		return &salesReturnModel.Pb, err
 	}
 
+	salesReturnModel.Pb.Details = newDetails
+	err = addEvent(ctx, tx, model.AggregateSalesReturn, salesReturnModel.Pb.GetId(), model.EventSalesReturnUpdated, &salesReturnModel.Pb)
+	if err != nil {
+		tx.Rollback()
+		return &salesReturnModel.Pb, err
+	}
+
+	err = addPosting(ctx, tx, model.AggregateSalesReturn, salesReturnModel.Pb.GetId(), salesReturnModel.Pb.GetCode(), salesReturnModel.Pb.GetBranchId(),
+		salesReturnModel.Pb.GetReturnDate(), ledger.SalesReturnEntry(&salesReturnModel.Pb))
+	if err != nil {
+		tx.Rollback()
+		return &salesReturnModel.Pb, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return &salesReturnModel.Pb, status.Error(codes.Internal, "failed commit transaction")
 	}
 
+	sendVersion(ctx, salesReturnModel.Version)
 	return &salesReturnModel.Pb, nil
 }
 
@@ -373,10 +493,34 @@ func (u *SalesReturn) List(in *sales.ListSalesReturnRequest, stream sales.SalesR
 		return err
 	}
 
+	ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+	if err != nil {
+		return err
+	}
+
+	page, err := listPage(ctx)
+	if err != nil {
+		return err
+	}
+
+	expr, err := filterExpression(ctx)
+	if err != nil {
+		return err
+	}
+
 	var salesReturnModel model.SalesReturn
-	query, paramQueries, paginationResponse, err := salesReturnModel.ListQuery(ctx, u.Db, in)
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, paramQueries, paginationResponse, err := salesReturnModel.ListQuery(ctx, tx, in, page, expr)
+	if err != nil {
+		return err
+	}
 
-	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
 	if err != nil {
 		return status.Error(codes.Internal, err.Error())
 	}
@@ -389,17 +533,24 @@ func (u *SalesReturn) List(in *sales.ListSalesReturnRequest, stream sales.SalesR
 			return err
 		}
 
-		var pbSalesReturn sales.SalesReturn
+		pbSalesReturn := sales.SalesReturn{Sales: &sales.Sales{Customer: &sales.Customer{}}}
 		var companyID string
 		var createdAt, updatedAt time.Time
 		err = rows.Scan(&pbSalesReturn.Id, &companyID, &pbSalesReturn.BranchId, &pbSalesReturn.BranchName, &pbSalesReturn.GetSales().Id,
 			&pbSalesReturn.Code, &pbSalesReturn.ReturnDate, &pbSalesReturn.Remark,
 			&pbSalesReturn.Price, &pbSalesReturn.AdditionalDiscAmount, &pbSalesReturn.AdditionalDiscPercentage, &pbSalesReturn.TotalPrice,
-			&createdAt, &pbSalesReturn.CreatedBy, &updatedAt, &pbSalesReturn.UpdatedBy)
+			&createdAt, &pbSalesReturn.CreatedBy, &updatedAt, &pbSalesReturn.UpdatedBy, &pbSalesReturn.Sales.Customer.Name)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
 
+		if !page.Scanned(pbSalesReturn.Id, map[string]interface{}{
+			"created_at": createdAt, "code": pbSalesReturn.Code, "return_date": pbSalesReturn.ReturnDate,
+			"total_price": pbSalesReturn.TotalPrice, "customer_name": pbSalesReturn.Sales.Customer.Name,
+		}) {
+			break
+		}
+
 		pbSalesReturn.CreatedAt = createdAt.String()
 		pbSalesReturn.UpdatedAt = updatedAt.String()
 
@@ -413,6 +564,7 @@ func (u *SalesReturn) List(in *sales.ListSalesReturnRequest, stream sales.SalesR
 			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
 		}
 	}
+	sendNextPage(ctx, page)
 	return nil
 }
 
@@ -3,11 +3,14 @@ package service
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -21,20 +24,9 @@ func (u *Salesman) SalesmanCreate(ctx context.Context, in *sales.Salesman) (*sal
 	var salesmanModel model.Salesman
 	var err error
 
-	if len(in.GetName()) == 0 {
-		return &salesmanModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid name")
-	}
-
-	if len(in.GetEmail()) == 0 {
-		return &salesmanModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid email")
-	}
-
-	if len(in.GetAddress()) == 0 {
-		return &salesmanModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid address")
-	}
-
-	if len(in.GetPhone()) == 0 {
-		return &salesmanModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid phone")
+	err = salesmanValidation(in)
+	if err != nil {
+		return &salesmanModel.Pb, err
 	}
 
 	ctx, err = app.GetMetadata(ctx)
@@ -44,10 +36,6 @@ func (u *Salesman) SalesmanCreate(ctx context.Context, in *sales.Salesman) (*sal
 
 	// code validation
 	{
-		if len(in.GetCode()) == 0 {
-			return &salesmanModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid code")
-		}
-
 		salesmanModel = model.Salesman{}
 		salesmanModel.Pb.Code = in.GetCode()
 		err = salesmanModel.GetByCode(ctx, u.Db)
@@ -74,6 +62,7 @@ func (u *Salesman) SalesmanCreate(ctx context.Context, in *sales.Salesman) (*sal
 		return &salesmanModel.Pb, err
 	}
 
+	sendVersion(ctx, salesmanModel.Version)
 	return &salesmanModel.Pb, nil
 }
 
@@ -96,6 +85,11 @@ func (u *Salesman) SalesmanUpdate(ctx context.Context, in *sales.Salesman) (*sal
 		return &salesmanModel.Pb, err
 	}
 
+	err = checkVersion(ctx, "salesman", salesmanModel.Version)
+	if err != nil {
+		return &salesmanModel.Pb, err
+	}
+
 	if len(in.GetName()) > 0 {
 		salesmanModel.Pb.Name = in.GetName()
 	}
@@ -117,6 +111,7 @@ func (u *Salesman) SalesmanUpdate(ctx context.Context, in *sales.Salesman) (*sal
 		return &salesmanModel.Pb, err
 	}
 
+	sendVersion(ctx, salesmanModel.Version)
 	return &salesmanModel.Pb, nil
 }
 
@@ -139,6 +134,7 @@ func (u *Salesman) SalesmanView(ctx context.Context, in *sales.Id) (*sales.Sales
 		return &salesmanModel.Pb, err
 	}
 
+	sendVersion(ctx, salesmanModel.Version)
 	return &salesmanModel.Pb, nil
 }
 
@@ -164,6 +160,18 @@ func (u *Salesman) SalesmanDelete(ctx context.Context, in *sales.Id) (*sales.MyB
 		return &output, err
 	}
 
+	// salesman referenced by any document can only be deactivated
+	{
+		references, err := salesmanModel.References(ctx, u.Db, 5)
+		if err != nil {
+			return &output, err
+		}
+
+		if len(references) > 0 {
+			return &output, status.Error(codes.FailedPrecondition, referencedMessage("salesman", salesmanModel.Pb.GetCode(), references))
+		}
+	}
+
 	err = salesmanModel.Delete(ctx, u.Db)
 	if err != nil {
 		return &output, err
@@ -174,24 +182,100 @@ func (u *Salesman) SalesmanDelete(ctx context.Context, in *sales.Id) (*sales.MyB
 }
 
 func (u *Salesman) SalesmanList(in *sales.ListSalesmanRequest, stream sales.SalesmanService_SalesmanListServer) error {
-	ctx := stream.Context()
+	return u.listSalesman(stream.Context(), in.GetPagination(), model.StatusAll, func(res *sales.ListSalesmanResponse, isActive bool) error {
+		return stream.Send(res)
+	})
+}
+
+func (u *Salesman) SalesmanDeactivate(ctx context.Context, in *sales.Id) (*rpc.SalesmanStatus, error) {
+	return u.setSalesmanActive(ctx, in, false)
+}
+
+func (u *Salesman) SalesmanReactivate(ctx context.Context, in *sales.Id) (*rpc.SalesmanStatus, error) {
+	return u.setSalesmanActive(ctx, in, true)
+}
+
+func (u *Salesman) SalesmanListByStatus(in *rpc.ListByStatusRequest, stream rpc.ServerStream[rpc.ListSalesmanStatusResponse]) error {
+	activeStatus := model.ActiveStatus(in.Status)
+	switch activeStatus {
+	case "":
+		activeStatus = model.StatusActive
+	case model.StatusActive, model.StatusInactive, model.StatusAll:
+	default:
+		return status.Error(codes.InvalidArgument, "Please supply valid status")
+	}
+
+	return u.listSalesman(stream.Context(), in.Pagination, activeStatus, func(res *sales.ListSalesmanResponse, isActive bool) error {
+		return stream.Send(&rpc.ListSalesmanStatusResponse{
+			Pagination: res.GetPagination(),
+			Salesman:   res.GetSalesman(),
+			IsActive:   isActive,
+		})
+	})
+}
+
+func (u *Salesman) setSalesmanActive(ctx context.Context, in *sales.Id, active bool) (*rpc.SalesmanStatus, error) {
+	var salesmanModel model.Salesman
+	var err error
+
+	if len(in.GetId()) == 0 {
+		return &rpc.SalesmanStatus{Salesman: &salesmanModel.Pb}, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+	salesmanModel.Pb.Id = in.GetId()
+
+	ctx, err = app.GetMetadata(ctx)
+	if err != nil {
+		return &rpc.SalesmanStatus{Salesman: &salesmanModel.Pb}, err
+	}
+
+	err = salesmanModel.Get(ctx, u.Db)
+	if err != nil {
+		return &rpc.SalesmanStatus{Salesman: &salesmanModel.Pb}, err
+	}
+
+	if salesmanModel.IsActive != active {
+		err = salesmanModel.SetActive(ctx, u.Db, active)
+		if err != nil {
+			return &rpc.SalesmanStatus{Salesman: &salesmanModel.Pb}, err
+		}
+	}
+
+	return &rpc.SalesmanStatus{Salesman: &salesmanModel.Pb, IsActive: salesmanModel.IsActive, Version: salesmanModel.Version}, nil
+}
+
+func (u *Salesman) listSalesman(ctx context.Context, pagination *sales.Pagination, activeStatus model.ActiveStatus, send func(*sales.ListSalesmanResponse, bool) error) error {
 	ctx, err := app.GetMetadata(ctx)
 	if err != nil {
 		return err
 	}
 
+	if pagination == nil {
+		pagination = &sales.Pagination{}
+	}
+
+	page, err := listPage(ctx)
+	if err != nil {
+		return err
+	}
+
 	var salesmanModel model.Salesman
-	query, paramQueries, paginationResponse, err := salesmanModel.ListQuery(ctx, u.Db, in.Pagination)
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	query, paramQueries, paginationResponse, err := salesmanModel.ListQuery(ctx, tx, pagination, activeStatus, page)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
 	if err != nil {
 		return status.Error(codes.Internal, err.Error())
 	}
 	defer rows.Close()
-	paginationResponse.Pagination = in.Pagination
+	paginationResponse.Pagination = pagination
 
 	for rows.Next() {
 		err := app.ContextError(ctx)
@@ -201,12 +285,17 @@ func (u *Salesman) SalesmanList(in *sales.ListSalesmanRequest, stream sales.Sale
 
 		var pbSalesman sales.Salesman
 		var companyID string
+		var isActive bool
 		var createdAt, updatedAt time.Time
-		err = rows.Scan(&pbSalesman.Id, &companyID, &pbSalesman.Code, &pbSalesman.Name, &pbSalesman.Email, &pbSalesman.Address, &pbSalesman.Phone, &createdAt, &pbSalesman.CreatedBy, &updatedAt, &pbSalesman.UpdatedBy)
+		err = rows.Scan(&pbSalesman.Id, &companyID, &pbSalesman.Code, &pbSalesman.Name, &pbSalesman.Email, &pbSalesman.Address, &pbSalesman.Phone, &createdAt, &pbSalesman.CreatedBy, &updatedAt, &pbSalesman.UpdatedBy, &isActive)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
 
+		if !page.Scanned(pbSalesman.Id, map[string]interface{}{"created_at": createdAt, "code": pbSalesman.Code, "name": pbSalesman.Name, "email": pbSalesman.Email}) {
+			break
+		}
+
 		pbSalesman.CreatedAt = createdAt.String()
 		pbSalesman.UpdatedAt = updatedAt.String()
 
@@ -215,10 +304,36 @@ func (u *Salesman) SalesmanList(in *sales.ListSalesmanRequest, stream sales.Sale
 			Salesman:   &pbSalesman,
 		}
 
-		err = stream.Send(res)
+		err = send(res, isActive)
 		if err != nil {
 			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
 		}
 	}
+	sendNextPage(ctx, page)
+	return nil
+}
+
+// salesmanValidation rules of a new salesman, shared with bulk import
+func salesmanValidation(in *sales.Salesman) error {
+	if len(in.GetName()) == 0 || utf8.RuneCountInString(in.GetName()) > 45 {
+		return status.Error(codes.InvalidArgument, "Please supply valid name")
+	}
+
+	if len(in.GetEmail()) == 0 || utf8.RuneCountInString(in.GetEmail()) > 50 || !strings.Contains(in.GetEmail(), "@") {
+		return status.Error(codes.InvalidArgument, "Please supply valid email")
+	}
+
+	if len(in.GetAddress()) == 0 || utf8.RuneCountInString(in.GetAddress()) > 255 {
+		return status.Error(codes.InvalidArgument, "Please supply valid address")
+	}
+
+	if len(in.GetPhone()) == 0 || utf8.RuneCountInString(in.GetPhone()) > 20 {
+		return status.Error(codes.InvalidArgument, "Please supply valid phone")
+	}
+
+	if len(in.GetCode()) == 0 || utf8.RuneCountInString(in.GetCode()) > 10 {
+		return status.Error(codes.InvalidArgument, "Please supply valid code")
+	}
+
 	return nil
 }
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"database/sql"
+	"unicode/utf8"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/auth"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchQuery     = 200
+)
+
+// searchPermissions is the permission to view each type of the global search, types the caller can not view are not searched
+var searchPermissions = map[string]string{
+	model.SearchCustomer:    auth.CustomerView,
+	model.SearchSalesman:    auth.SalesmanView,
+	model.SearchSales:       auth.SalesView,
+	model.SearchSalesReturn: auth.SalesReturnView,
+}
+
+type Search struct {
+	Db           *sql.DB
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	Cache        *cache.Cache
+}
+
+// Search stream the customers, salesmen, sales and sales returns matching the query, most relevant first
+func (u *Search) Search(in *rpc.SearchRequest, stream rpc.ServerStream[rpc.SearchHit]) error {
+	ctx, err := app.GetMetadata(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	if len(in.Query) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid query")
+	}
+
+	if utf8.RuneCountInString(in.Query) > maxSearchQuery {
+		return status.Errorf(codes.InvalidArgument, "query is longer than %d characters", maxSearchQuery)
+	}
+
+	limit := in.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	requested := in.Types
+	if len(requested) == 0 {
+		requested = model.SearchTypes
+	}
+
+	var types []string
+	scoped := false
+	for _, t := range requested {
+		permission, ok := searchPermissions[t]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "can not search %s", t)
+		}
+
+		if !auth.Can(ctx, permission) {
+			if len(in.Types) > 0 {
+				return status.Errorf(codes.PermissionDenied, "permission %s is required", permission)
+			}
+			continue
+		}
+
+		types = append(types, t)
+		if t == model.SearchSales || t == model.SearchSalesReturn {
+			scoped = true
+		}
+	}
+
+	if len(types) == 0 {
+		return status.Error(codes.PermissionDenied, "you can not view any type of the search")
+	}
+
+	if scoped {
+		ctx, err = branchScope(ctx, u.Cache, u.UserClient, u.RegionClient)
+		if err != nil {
+			return err
+		}
+	}
+
+	query, paramQueries, err := model.SearchQuery(ctx, in.Query, types, limit)
+	if err != nil {
+		return err
+	}
+
+	tx, err := model.BeginTx(ctx, u.Db, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query search: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		hit, err := model.ScanSearchHit(rows)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&rpc.SearchHit{
+			Type:   hit.Type,
+			Id:     hit.ID,
+			Code:   hit.Code,
+			Title:  hit.Title,
+			Detail: hit.Detail,
+			Rank:   hit.Rank,
+		})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return status.Errorf(codes.Internal, "rows search: %v", err)
+	}
+
+	return nil
+}
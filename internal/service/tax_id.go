@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// taxIDHeader is the grpc metadata of the customer tax id (npwp), the Customer message has no field for it.
+// CustomerCreate and CustomerUpdate read it, an empty value clear it on update.
+const taxIDHeader = "tax-id"
+
+// maxTaxID is the size of customers.tax_id
+const maxTaxID = 30
+
+// taxID return the tax id of the metadata, ok is false when the caller did not send it
+func taxID(ctx context.Context) (string, bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(taxIDHeader)
+	if len(values) == 0 {
+		return "", false, nil
+	}
+
+	if utf8.RuneCountInString(values[0]) > maxTaxID {
+		return "", false, status.Errorf(codes.InvalidArgument, "tax id must be at most %d characters", maxTaxID)
+	}
+
+	return values[0], true, nil
+}
+
+// sendTaxID return the tax id of the customer as response header
+func sendTaxID(ctx context.Context, taxID string) {
+	grpc.SetHeader(ctx, metadata.Pairs(taxIDHeader, taxID))
+}
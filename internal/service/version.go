@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// versionHeader is the grpc metadata of the document version, the client send it back on update
+const versionHeader = "version"
+
+// checkVersion abort the update when the client supplied version is not the current version.
+// Update without version metadata is not checked.
+func checkVersion(ctx context.Context, entity string, current int32) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(versionHeader)
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil
+	}
+
+	expected, err := strconv.ParseInt(values[0], 10, 32)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Please supply valid version")
+	}
+
+	if int32(expected) != current {
+		return status.Errorf(codes.Aborted, "%s has been changed by another request, current version is %d", entity, current)
+	}
+
+	return nil
+}
+
+// sendVersion return the version of the document as response header
+func sendVersion(ctx context.Context, version int32) {
+	grpc.SetHeader(ctx, metadata.Pairs(versionHeader, strconv.Itoa(int(version))))
+}
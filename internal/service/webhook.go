@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"github.com/jacky-htg/sales-service/internal/model"
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"github.com/jacky-htg/sales-service/internal/webhook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Webhook struct {
+	Db *sql.DB
+	// Insecure accept http urls and urls on loopback and private addresses, only for development
+	Insecure bool
+}
+
+func (u *Webhook) WebhookCreate(ctx context.Context, in *rpc.WebhookSubscription) (*rpc.WebhookSubscription, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = webhookValidation(in, u.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.Secret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, status.Errorf(codes.Internal, "generate secret: %v", err)
+		}
+		in.Secret = hex.EncodeToString(secret)
+	}
+
+	subscriptionModel := model.WebhookSubscription{
+		Url:        in.Url,
+		EventTypes: in.EventTypes,
+		Secret:     in.Secret,
+	}
+	err = subscriptionModel.Create(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhookResponse(&subscriptionModel, true), nil
+}
+
+// WebhookUpdate replace url, event types and active flag, the secret is kept when empty
+func (u *Webhook) WebhookUpdate(ctx context.Context, in *rpc.WebhookSubscription) (*rpc.WebhookSubscription, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.Id) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	err = webhookValidation(in, u.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionModel := model.WebhookSubscription{Id: in.Id}
+	err = subscriptionModel.Get(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionModel.Url = in.Url
+	subscriptionModel.EventTypes = in.EventTypes
+	subscriptionModel.IsActive = in.IsActive
+	if len(in.Secret) > 0 {
+		subscriptionModel.Secret = in.Secret
+	}
+
+	err = subscriptionModel.Update(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhookResponse(&subscriptionModel, len(in.Secret) > 0), nil
+}
+
+func (u *Webhook) WebhookView(ctx context.Context, in *sales.Id) (*rpc.WebhookSubscription, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.GetId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	subscriptionModel := model.WebhookSubscription{Id: in.GetId()}
+	err = subscriptionModel.Get(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhookResponse(&subscriptionModel, false), nil
+}
+
+func (u *Webhook) WebhookDelete(ctx context.Context, in *sales.Id) (*sales.MyBoolean, error) {
+	var output sales.MyBoolean
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return &output, err
+	}
+
+	if len(in.GetId()) == 0 {
+		return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+	}
+
+	subscriptionModel := model.WebhookSubscription{Id: in.GetId()}
+	err = subscriptionModel.Get(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	err = subscriptionModel.Delete(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
+
+func (u *Webhook) WebhookList(in *rpc.Empty, stream rpc.ServerStream[rpc.WebhookSubscription]) error {
+	ctx, err := app.GetMetadata(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	list, err := model.ListWebhookSubscriptions(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range list {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(webhookResponse(subscription, false))
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (u *Webhook) WebhookDeadLetterList(in *rpc.WebhookDeadLetterRequest, stream rpc.ServerStream[rpc.WebhookDelivery]) error {
+	ctx, err := app.GetMetadata(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	list, err := model.ListDeadWebhookDeliveries(ctx, u.Db, in.SubscriptionId)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range list {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&rpc.WebhookDelivery{
+			Id:             delivery.Id,
+			SubscriptionId: delivery.SubscriptionID,
+			EventId:        delivery.EventID,
+			EventType:      delivery.EventType,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			ResponseCode:   delivery.ResponseCode,
+			LastError:      delivery.LastError,
+			CreatedAt:      delivery.CreatedAt.String(),
+		})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (u *Webhook) WebhookReplay(ctx context.Context, in *rpc.WebhookReplayRequest) (*rpc.WebhookReplayResponse, error) {
+	ctx, err := app.GetMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(in.SubscriptionId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Please supply valid subscription id")
+	}
+
+	subscriptionModel := model.WebhookSubscription{Id: in.SubscriptionId}
+	err = subscriptionModel.Get(ctx, u.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed, err := model.ReplayWebhookDeliveries(ctx, u.Db, in.SubscriptionId, in.DeliveryIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.WebhookReplayResponse{Replayed: replayed}, nil
+}
+
+func webhookValidation(in *rpc.WebhookSubscription, insecure bool) error {
+	target, err := url.Parse(in.Url)
+	if err != nil || len(target.Hostname()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid https url")
+	}
+
+	if !insecure {
+		if target.Scheme != "https" {
+			return status.Error(codes.InvalidArgument, "Please supply valid https url")
+		}
+
+		// a host name is checked again on every connection of the dispatcher
+		if ip := net.ParseIP(target.Hostname()); (ip != nil && !webhook.PublicIP(ip)) || strings.EqualFold(target.Hostname(), "localhost") {
+			return status.Error(codes.InvalidArgument, "url must be a public address")
+		}
+	} else if target.Scheme != "https" && target.Scheme != "http" {
+		return status.Error(codes.InvalidArgument, "Please supply valid http or https url")
+	}
+
+	if len(in.Url) > 500 {
+		return status.Error(codes.InvalidArgument, "url must be at most 500 characters")
+	}
+
+	if len(in.Secret) > 100 {
+		return status.Error(codes.InvalidArgument, "secret must be at most 100 characters")
+	}
+
+	if len(in.EventTypes) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply event types")
+	}
+
+	for _, eventType := range in.EventTypes {
+		valid := eventType == "*"
+		for _, known := range model.WebhookEventTypes {
+			if eventType == known {
+				valid = true
+			}
+		}
+
+		if !valid {
+			return status.Errorf(codes.InvalidArgument, "unknown event type %s", eventType)
+		}
+	}
+
+	return nil
+}
+
+func webhookResponse(subscriptionModel *model.WebhookSubscription, withSecret bool) *rpc.WebhookSubscription {
+	response := rpc.WebhookSubscription{
+		Id:         subscriptionModel.Id,
+		Url:        subscriptionModel.Url,
+		EventTypes: subscriptionModel.EventTypes,
+		IsActive:   subscriptionModel.IsActive,
+		CreatedAt:  subscriptionModel.CreatedAt,
+		CreatedBy:  subscriptionModel.CreatedBy,
+		UpdatedAt:  subscriptionModel.UpdatedAt,
+		UpdatedBy:  subscriptionModel.UpdatedBy,
+	}
+	if withSecret {
+		response.Secret = subscriptionModel.Secret
+	}
+	return &response
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/jacky-htg/sales-service/internal/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWebhookValidationUrl(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		insecure bool
+		wantCode codes.Code
+	}{
+		{name: "https", url: "https://hooks.example.com/sales", wantCode: codes.OK},
+		{name: "public ip", url: "https://8.8.8.8/sales", wantCode: codes.OK},
+		{name: "http", url: "http://hooks.example.com/sales", wantCode: codes.InvalidArgument},
+		{name: "loopback", url: "https://127.0.0.1/sales", wantCode: codes.InvalidArgument},
+		{name: "localhost", url: "https://localhost:8080/sales", wantCode: codes.InvalidArgument},
+		{name: "private", url: "https://10.0.0.5/sales", wantCode: codes.InvalidArgument},
+		{name: "link local", url: "https://169.254.169.254/latest", wantCode: codes.InvalidArgument},
+		{name: "ipv6 loopback", url: "https://[::1]/sales", wantCode: codes.InvalidArgument},
+		{name: "without host", url: "https:///sales", wantCode: codes.InvalidArgument},
+		{name: "other scheme", url: "ftp://hooks.example.com", wantCode: codes.InvalidArgument},
+		{name: "insecure http", url: "http://localhost:8080/sales", insecure: true, wantCode: codes.OK},
+		{name: "insecure other scheme", url: "ftp://localhost", insecure: true, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhookValidation(&rpc.WebhookSubscription{Url: tt.url, EventTypes: []string{"*"}}, tt.insecure)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("webhookValidation(%q) error %v, want %v", tt.url, err, tt.wantCode)
+			}
+		})
+	}
+}
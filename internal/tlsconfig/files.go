@@ -0,0 +1,111 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadCheck is how often the files are checked for change, at most once per handshake
+const reloadCheck = 10 * time.Second
+
+// Files hold a certificate, its key and a CA bundle read from disk, they are read again when a file change.
+// A reload failing, for example in the middle of a rotation, keep the previous ones.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	checked time.Time
+}
+
+func (f *Files) load() error {
+	var cert *tls.Certificate
+	if len(f.CertFile) > 0 || len(f.KeyFile) > 0 {
+		pair, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate %s: %v", f.CertFile, err)
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if len(f.CAFile) > 0 {
+		pem, err := os.ReadFile(f.CAFile)
+		if err != nil {
+			return fmt.Errorf("read ca %s: %v", f.CAFile, err)
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate in ca %s", f.CAFile)
+		}
+	}
+
+	f.mu.Lock()
+	f.cert = cert
+	f.pool = pool
+	f.modTime = f.lastModified()
+	f.checked = time.Now()
+	f.mu.Unlock()
+
+	return nil
+}
+
+// refresh reload the files when one of them changed since the last load
+func (f *Files) refresh() {
+	f.mu.RLock()
+	due := time.Since(f.checked) >= reloadCheck
+	f.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	modTime := f.lastModified()
+
+	f.mu.Lock()
+	f.checked = time.Now()
+	changed := modTime.After(f.modTime)
+	f.mu.Unlock()
+
+	if changed {
+		_ = f.load()
+	}
+}
+
+func (f *Files) lastModified() time.Time {
+	var last time.Time
+	for _, name := range []string{f.CertFile, f.KeyFile, f.CAFile} {
+		if len(name) == 0 {
+			continue
+		}
+
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+func (f *Files) certificate() *tls.Certificate {
+	f.refresh()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cert
+}
+
+func (f *Files) certPool() *x509.CertPool {
+	f.refresh()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.pool
+}
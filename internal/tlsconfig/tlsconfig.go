@@ -0,0 +1,162 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Config is the transport security of the server and of the downstream connections
+type Config struct {
+	// Insecure use plaintext, only when TLS_INSECURE=true
+	Insecure   bool
+	Server     *Files
+	ClientAuth tls.ClientAuthType
+	Client     *Files
+}
+
+// FromEnv read the configuration:
+//   - TLS_INSECURE=true use plaintext for the server and downstream connections
+//   - TLS_CERT_FILE, TLS_KEY_FILE : certificate of the server
+//   - TLS_CLIENT_CA_FILE : CA of client certificates, TLS_CLIENT_AUTH is require (default when the CA is set) or optional
+//   - TLS_CA_FILE : CA of the downstream services, system roots when empty
+//   - TLS_CLIENT_CERT_FILE, TLS_CLIENT_KEY_FILE : client certificate presented to the downstream services
+//   - <NAME>_SERVICE_TLS_SERVER_NAME : name verified in the certificate of a downstream, its host by default
+func FromEnv() (*Config, error) {
+	if os.Getenv("TLS_INSECURE") == "true" {
+		return &Config{Insecure: true}, nil
+	}
+
+	c := &Config{
+		Server: &Files{
+			CertFile: os.Getenv("TLS_CERT_FILE"),
+			KeyFile:  os.Getenv("TLS_KEY_FILE"),
+			CAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		},
+		Client: &Files{
+			CertFile: os.Getenv("TLS_CLIENT_CERT_FILE"),
+			KeyFile:  os.Getenv("TLS_CLIENT_KEY_FILE"),
+			CAFile:   os.Getenv("TLS_CA_FILE"),
+		},
+	}
+
+	if len(c.Server.CertFile) == 0 || len(c.Server.KeyFile) == 0 {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE are required, set TLS_INSECURE=true to run without tls")
+	}
+
+	if len(c.Server.CAFile) > 0 {
+		switch os.Getenv("TLS_CLIENT_AUTH") {
+		case "", "require":
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			c.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, errors.New("TLS_CLIENT_AUTH must be require or optional")
+		}
+	}
+
+	if err := c.Server.load(); err != nil {
+		return nil, err
+	}
+
+	if err := c.Client.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ServerOptions return the credentials of the grpc server, none when insecure
+func (c *Config) ServerOptions() []grpc.ServerOption {
+	if c.Insecure {
+		return nil
+	}
+
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(c.serverConfig("h2")))}
+}
+
+// HTTPConfig return the tls config of the http gateway, the same certificate and client authentication as the grpc server.
+// It is nil when insecure.
+func (c *Config) HTTPConfig() *tls.Config {
+	if c.Insecure {
+		return nil
+	}
+
+	config := c.serverConfig("h2", "http/1.1")
+	// net/http require a certificate source on the top config
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return c.Server.certificate(), nil
+	}
+	return config
+}
+
+func (c *Config) serverConfig(protos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// every handshake get the certificate and client CA as they are on disk now
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				NextProtos: protos,
+				ClientAuth: c.ClientAuth,
+				ClientCAs:  c.Server.certPool(),
+			}
+			if cert := c.Server.certificate(); cert != nil {
+				config.Certificates = []tls.Certificate{*cert}
+			}
+			return config, nil
+		},
+	}
+}
+
+// DialOption return the credentials of the connection to the downstream name, for example inventory
+func (c *Config) DialOption(name string) grpc.DialOption {
+	if c.Insecure {
+		return grpc.WithTransportCredentials(insecure.NewCredentials())
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: os.Getenv(strings.ToUpper(name) + "_SERVICE_TLS_SERVER_NAME"),
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := c.Client.certificate(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+
+	if len(c.Client.CAFile) > 0 {
+		// the CA is read again on change, so the chain is verified here instead of by RootCAs
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyServer(cs, c.Client.certPool())
+		}
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
+
+func verifyServer(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       cs.ServerName,
+	})
+	return err
+}
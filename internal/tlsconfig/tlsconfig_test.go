@@ -0,0 +1,340 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue return the pem of a certificate for name signed by the ca, and of its key
+func (ca *testCA) issue(t *testing.T, name string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// writeFile write data to name and set its modification time
+func writeFile(t *testing.T, name string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(cert *tls.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return ""
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestFromEnv(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, "sales")
+	cert, key, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	writeFile(t, cert, certPEM, time.Now())
+	writeFile(t, key, keyPEM, time.Now())
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	tests := []struct {
+		name           string
+		env            map[string]string
+		wantInsecure   bool
+		wantClientAuth tls.ClientAuthType
+		wantErr        bool
+	}{
+		{name: "insecure", env: map[string]string{"TLS_INSECURE": "true"}, wantInsecure: true},
+		{name: "certificate required", env: map[string]string{}, wantErr: true},
+		{name: "key required", env: map[string]string{"TLS_CERT_FILE": cert}, wantErr: true},
+		{name: "server certificate", env: map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": key}, wantClientAuth: tls.NoClientCert},
+		{name: "client ca require client certificate", env: map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": key, "TLS_CLIENT_CA_FILE": caFile},
+			wantClientAuth: tls.RequireAndVerifyClientCert},
+		{name: "optional client certificate", env: map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": key, "TLS_CLIENT_CA_FILE": caFile, "TLS_CLIENT_AUTH": "optional"},
+			wantClientAuth: tls.VerifyClientCertIfGiven},
+		{name: "unknown client auth", env: map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": key, "TLS_CLIENT_CA_FILE": caFile, "TLS_CLIENT_AUTH": "none"},
+			wantErr: true},
+		{name: "missing certificate file", env: map[string]string{"TLS_CERT_FILE": filepath.Join(dir, "missing.pem"), "TLS_KEY_FILE": key}, wantErr: true},
+		{name: "key of another certificate", env: map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": cert}, wantErr: true},
+		{name: "ca without certificate", env: map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": key, "TLS_CA_FILE": key}, wantErr: true},
+		{name: "downstream ca and client certificate", env: map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": key,
+			"TLS_CA_FILE": caFile, "TLS_CLIENT_CERT_FILE": cert, "TLS_CLIENT_KEY_FILE": key}},
+	}
+
+	keys := []string{"TLS_INSECURE", "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE", "TLS_CLIENT_AUTH", "TLS_CA_FILE",
+		"TLS_CLIENT_CERT_FILE", "TLS_CLIENT_KEY_FILE"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range keys {
+				t.Setenv(key, tt.env[key])
+			}
+
+			c, err := FromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("FromEnv succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromEnv error %v", err)
+			}
+			if c.Insecure != tt.wantInsecure {
+				t.Errorf("Insecure = %v, want %v", c.Insecure, tt.wantInsecure)
+			}
+			if !c.Insecure && c.ClientAuth != tt.wantClientAuth {
+				t.Errorf("ClientAuth = %v, want %v", c.ClientAuth, tt.wantClientAuth)
+			}
+		})
+	}
+}
+
+func TestFilesReload(t *testing.T) {
+	ca := newCA(t)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		rotate     func(t *testing.T, f *Files)
+		recheck    bool
+		wantCommon string
+	}{
+		{
+			name: "rotated certificate is loaded",
+			rotate: func(t *testing.T, f *Files) {
+				certPEM, keyPEM := ca.issue(t, "rotated")
+				writeFile(t, f.KeyFile, keyPEM, now.Add(time.Minute))
+				writeFile(t, f.CertFile, certPEM, now.Add(time.Minute))
+			},
+			recheck:    true,
+			wantCommon: "rotated",
+		},
+		{
+			name: "files are not checked again before reloadCheck",
+			rotate: func(t *testing.T, f *Files) {
+				certPEM, keyPEM := ca.issue(t, "rotated")
+				writeFile(t, f.KeyFile, keyPEM, now.Add(time.Minute))
+				writeFile(t, f.CertFile, certPEM, now.Add(time.Minute))
+			},
+			recheck:    false,
+			wantCommon: "first",
+		},
+		{
+			name: "half written rotation keep the previous certificate",
+			rotate: func(t *testing.T, f *Files) {
+				certPEM, _ := ca.issue(t, "rotated")
+				writeFile(t, f.CertFile, certPEM, now.Add(time.Minute))
+			},
+			recheck:    true,
+			wantCommon: "first",
+		},
+		{
+			name: "removed files keep the previous certificate",
+			rotate: func(t *testing.T, f *Files) {
+				os.Remove(f.CertFile)
+				os.Remove(f.KeyFile)
+			},
+			recheck:    true,
+			wantCommon: "first",
+		},
+		{
+			name: "rewrite without a newer time is not loaded",
+			rotate: func(t *testing.T, f *Files) {
+				certPEM, keyPEM := ca.issue(t, "rotated")
+				writeFile(t, f.KeyFile, keyPEM, now)
+				writeFile(t, f.CertFile, certPEM, now)
+			},
+			recheck:    true,
+			wantCommon: "first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			f := &Files{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+			certPEM, keyPEM := ca.issue(t, "first")
+			writeFile(t, f.CertFile, certPEM, now)
+			writeFile(t, f.KeyFile, keyPEM, now)
+
+			if err := f.load(); err != nil {
+				t.Fatal(err)
+			}
+			if got := commonName(f.certificate()); got != "first" {
+				t.Fatalf("certificate %q, want first", got)
+			}
+
+			tt.rotate(t, f)
+			if tt.recheck {
+				f.mu.Lock()
+				f.checked = time.Now().Add(-reloadCheck)
+				f.mu.Unlock()
+			}
+
+			if got := commonName(f.certificate()); got != tt.wantCommon {
+				t.Errorf("certificate %q, want %q", got, tt.wantCommon)
+			}
+		})
+	}
+}
+
+func TestVerifyServer(t *testing.T) {
+	ca := newCA(t)
+	other := newCA(t)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	peer := func(ca *testCA, name string) []*x509.Certificate {
+		certPEM, _ := ca.issue(t, name)
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []*x509.Certificate{cert}
+	}
+
+	tests := []struct {
+		name    string
+		state   tls.ConnectionState
+		wantErr bool
+	}{
+		{name: "certificate of the ca", state: tls.ConnectionState{ServerName: "inventory", PeerCertificates: peer(ca, "inventory")}},
+		{name: "certificate of another name", state: tls.ConnectionState{ServerName: "inventory", PeerCertificates: peer(ca, "users")}, wantErr: true},
+		{name: "certificate of another ca", state: tls.ConnectionState{ServerName: "inventory", PeerCertificates: peer(other, "inventory")}, wantErr: true},
+		{name: "no certificate", state: tls.ConnectionState{ServerName: "inventory"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyServer(tt.state, roots)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyServer error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestHandshakeAfterRotation check a handshake get the certificate as it is on disk, without restarting the server
+func TestHandshakeAfterRotation(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	now := time.Now()
+
+	server := &Files{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	certPEM, keyPEM := ca.issue(t, "sales")
+	writeFile(t, server.CertFile, certPEM, now)
+	writeFile(t, server.KeyFile, keyPEM, now)
+	if err := server.load(); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{Server: server}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	handshake := func() string {
+		serverConn, clientConn := net.Pipe()
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		go tls.Server(serverConn, c.HTTPConfig()).Handshake()
+
+		client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "sales", NextProtos: []string{"h2"}})
+		if err := client.Handshake(); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		return client.ConnectionState().PeerCertificates[0].SerialNumber.String()
+	}
+
+	before := handshake()
+
+	certPEM, keyPEM = ca.issue(t, "sales")
+	writeFile(t, server.KeyFile, keyPEM, now.Add(time.Minute))
+	writeFile(t, server.CertFile, certPEM, now.Add(time.Minute))
+	server.mu.Lock()
+	server.checked = time.Now().Add(-reloadCheck)
+	server.mu.Unlock()
+
+	if after := handshake(); after == before {
+		t.Errorf("handshake after rotation got the previous certificate %s", before)
+	}
+}
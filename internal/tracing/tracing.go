@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"google.golang.org/grpc"
+)
+
+// Enabled tell whether OTEL_TRACES_EXPORTER choose an exporter, otlp or stdout
+func Enabled() bool {
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "otlp", "stdout":
+		return true
+	}
+	return false
+}
+
+// Setup install the tracer provider of OTEL_TRACES_EXPORTER: otlp (endpoint from OTEL_EXPORTER_OTLP_ENDPOINT),
+// stdout (pretty printed spans, for local runs) or none (default).
+// W3C trace context and baggage are propagated in the grpc metadata.
+// The returned func flush the spans left, call it on shutdown.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "otlp":
+		exporter, err = otlptracegrpc.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create trace exporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName()),
+		semconv.ServiceVersion(os.Getenv("SERVICE_VERSION")),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// ServerOptions create a span for every incoming rpc, child of the span of the caller, none when tracing is disabled
+func ServerOptions() []grpc.ServerOption {
+	if !Enabled() {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler())}
+}
+
+// DialOptions create a span for every call to a downstream service and send the trace context in its metadata,
+// none when tracing is disabled. The metadata of app.SetMetadata is kept, the trace context is added when the call starts.
+func DialOptions() []grpc.DialOption {
+	if !Enabled() {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithStatsHandler(otelgrpc.NewClientHandler())}
+}
+
+// OpenDB open postgres with a span for every statement, from the POSTGRES_* variables.
+// POSTGRES_SSLMODE default to disable.
+func OpenDB() (*sql.DB, error) {
+	return openTraced(postgresDSN(os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASSWORD")))
+}
+
+// OpenWorkerDB connect as POSTGRES_WORKER_USER, the role of background workers, traced when tracing is enabled
+func OpenWorkerDB() (*sql.DB, error) {
+	dsn := postgresDSN(os.Getenv("POSTGRES_WORKER_USER"), os.Getenv("POSTGRES_WORKER_PASSWORD"))
+	if !Enabled() {
+		return sql.Open("postgres", dsn)
+	}
+
+	return openTraced(dsn)
+}
+
+// postgresDSN of POSTGRES_HOST, POSTGRES_PORT, POSTGRES_DB and POSTGRES_SSLMODE (default disable) for user
+func postgresDSN(user, password string) string {
+	sslmode := os.Getenv("POSTGRES_SSLMODE")
+	if len(sslmode) == 0 {
+		sslmode = "disable"
+	}
+
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), user, password, os.Getenv("POSTGRES_DB"), sslmode)
+}
+
+func openTraced(dsn string) (*sql.DB, error) {
+	return otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBName(os.Getenv("POSTGRES_DB"))),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
+}
+
+func serviceName() string {
+	if name := os.Getenv("SERVICE_NAME"); len(name) > 0 {
+		return name
+	}
+	return "sales-service"
+}
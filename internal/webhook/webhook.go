@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jacky-htg/sales-service/internal/event"
+	"github.com/jacky-htg/sales-service/internal/model"
+)
+
+// MaxAttempts before a delivery is moved to dead letter
+const MaxAttempts = 10
+
+// sendTimeout bound each post to a subscriber, the claim of a batch last long enough to send all of it
+const sendTimeout = 10 * time.Second
+
+// Broker queue a delivery of the event for every subscription interested in it
+type Broker struct {
+	Db *sql.DB
+}
+
+func (b *Broker) Publish(ctx context.Context, e event.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %v", err)
+	}
+
+	return model.EnqueueWebhookDeliveries(ctx, b.Db, e.CompanyID, e.Id, e.Type, payload)
+}
+
+// Sign return the signature header value of body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher post pending deliveries to subscriber urls
+type Dispatcher struct {
+	Db        *sql.DB
+	Client    *http.Client
+	Log       *slog.Logger
+	Interval  time.Duration
+	BatchSize int
+	// Insecure allow subscriber urls on loopback and private addresses, only for development
+	Insecure bool
+}
+
+// Run poll pending deliveries until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchOnce(ctx); err != nil && ctx.Err() == nil {
+			d.Log.Error("dispatch webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce send one batch of due deliveries and return how many were delivered
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	deliveries, err := d.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, delivery := range deliveries {
+		responseCode, sendErr := d.send(ctx, delivery)
+		if err := d.record(ctx, delivery, responseCode, sendErr); err != nil {
+			return delivered, err
+		}
+
+		if sendErr == nil {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// claim lock due deliveries skipping the ones locked by other dispatchers, move their next attempt after the batch and commit
+func (d *Dispatcher) claim(ctx context.Context) ([]*model.WebhookDelivery, error) {
+	tx, err := model.BeginSystemTx(ctx, d.Db, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	batchSize := d.BatchSize
+	if batchSize <= 0 {
+		batchSize = 20
+	}
+
+	deliveries, err := model.DueWebhookDeliveries(ctx, tx, batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	until := time.Now().UTC().Add(time.Duration(len(deliveries))*sendTimeout + time.Minute)
+	for _, delivery := range deliveries {
+		if err := delivery.Claim(ctx, tx, until); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit webhook deliveries claim: %v", err)
+	}
+
+	return deliveries, nil
+}
+
+// record save the result of the delivery in its own transaction.
+// A failed commit leaves the delivery claimed, it is sent again when the claim expire and the subscriber skip it by X-Sales-Delivery.
+func (d *Dispatcher) record(ctx context.Context, delivery *model.WebhookDelivery, responseCode int, cause error) error {
+	tx, err := model.BeginCompanyTx(ctx, d.Db, nil, delivery.CompanyID)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if cause == nil {
+		err = delivery.MarkDelivered(ctx, tx, responseCode)
+	} else {
+		attempts := delivery.Attempts + 1
+		err = delivery.MarkFailed(ctx, tx, responseCode, cause, time.Now().UTC().Add(backoff(attempts)), attempts >= MaxAttempts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit webhook delivery: %v", err)
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *model.WebhookDelivery) (int, error) {
+	if d.Client == nil {
+		d.Client = NewClient(d.Insecure)
+	}
+	client := d.Client
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sales-service-webhook")
+	req.Header.Set("X-Sales-Event", delivery.EventType)
+	req.Header.Set("X-Sales-Delivery", delivery.Id)
+	req.Header.Set("X-Sales-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Sales-Signature", Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff double the wait from 30 seconds up to 6 hours
+func backoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return 6 * time.Hour
+	}
+
+	wait := 30 * time.Second << uint(attempts-1)
+	if wait > 6*time.Hour {
+		wait = 6 * time.Hour
+	}
+	return wait
+}
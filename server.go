@@ -1,15 +1,39 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jacky-htg/erp-pkg/db/postgres"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/sales-service/internal/auth"
+	"github.com/jacky-htg/sales-service/internal/cache"
+	"github.com/jacky-htg/sales-service/internal/client"
 	"github.com/jacky-htg/sales-service/internal/config"
+	"github.com/jacky-htg/sales-service/internal/event"
+	"github.com/jacky-htg/sales-service/internal/gateway"
+	"github.com/jacky-htg/sales-service/internal/health"
+	"github.com/jacky-htg/sales-service/internal/logging"
+	"github.com/jacky-htg/sales-service/internal/metrics"
+	"github.com/jacky-htg/sales-service/internal/model"
 	"github.com/jacky-htg/sales-service/internal/route"
+	"github.com/jacky-htg/sales-service/internal/tlsconfig"
+	"github.com/jacky-htg/sales-service/internal/tracing"
+	"github.com/jacky-htg/sales-service/internal/webhook"
 	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 const defaultPort = "8002"
@@ -25,42 +49,280 @@ func main() {
 		port = defaultPort
 	}
 
-	// init log
-	log := log.New(os.Stdout, "ERROR : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	// json logs of LOG_LEVEL, the standard log package write through it too
+	logger := logging.New(os.Stdout, os.Getenv("LOG_LEVEL"))
+	slog.SetDefault(logger)
 
-	// create postgres database connection
-	db, err := postgres.Open()
+	// spans of rpc, sql and downstream calls when OTEL_TRACES_EXPORTER is set
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// create postgres database connection, traced when tracing is enabled
+	var db *sql.DB
+	if tracing.Enabled() {
+		db, err = tracing.OpenDB()
+	} else {
+		db, err = postgres.Open()
+	}
 	if err != nil {
 		log.Fatalf("connecting to db: %v", err)
 		return
 	}
 	defer db.Close()
 
+	// background workers see every company as POSTGRES_WORKER_USER, a role with BYPASSRLS.
+	// Without it they share db, which then must bypass row level security itself (a superuser in development).
+	workerDb := db
+	if len(os.Getenv("POSTGRES_WORKER_USER")) > 0 {
+		workerDb, err = tracing.OpenWorkerDB()
+		if err != nil {
+			log.Fatalf("connecting to db as worker: %v", err)
+		}
+		defer workerDb.Close()
+	}
+
+	if err := model.CheckSystemDB(context.Background(), workerDb); err != nil {
+		log.Fatalf("worker db: %v", err)
+	}
+
+	// relay outbox events to webhook subscriptions and the broker, then deliver the webhooks
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	brokers := event.Brokers{&webhook.Broker{Db: workerDb}}
+	if broker := newBroker(workerDb); broker != nil {
+		brokers = append(brokers, broker)
+	}
+	relay := event.Relay{Db: workerDb, Broker: brokers, Log: logger, Interval: time.Second}
+	go relay.Run(workerCtx)
+
+	dispatcher := webhook.Dispatcher{Db: workerDb, Log: logger, Insecure: os.Getenv("WEBHOOK_INSECURE") == "true"}
+	go dispatcher.Run(workerCtx)
+
+	go purgeIdempotencyKeys(workerCtx, workerDb, logger)
+
+	// tls of the server and the downstream connections, plaintext only when TLS_INSECURE=true
+	transport, err := tlsconfig.FromEnv()
+	if err != nil {
+		log.Fatalf("tls: %v", err)
+	}
+
 	// listen tcp port
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
-
-	userConn, err := grpc.Dial(os.Getenv("USER_SERVICE"), grpc.WithInsecure())
+	// calls to other services have deadlines, retries of reads and a circuit breaker per service
+	userConn, err := client.Dial(os.Getenv("USER_SERVICE"), client.OptionsFromEnv("user"), append(tracing.DialOptions(), transport.DialOption("user"))...)
 	if err != nil {
 		log.Fatalf("create user service connection: %v", err)
 	}
 	defer userConn.Close()
 
-	inventoryConn, err := grpc.Dial(os.Getenv("INVENTORY_SERVICE"), grpc.WithInsecure())
+	inventoryConn, err := client.Dial(os.Getenv("INVENTORY_SERVICE"), client.OptionsFromEnv("inventory"), append(tracing.DialOptions(), transport.DialOption("inventory"))...)
 	if err != nil {
 		log.Fatalf("create inventory service connection: %v", err)
 	}
-	defer userConn.Close()
+	defer inventoryConn.Close()
+
+	ledgerConn, err := client.Dial(os.Getenv("LEDGER_SERVICE"), client.OptionsFromEnv("ledger"), append(tracing.DialOptions(), transport.DialOption("ledger"))...)
+	if err != nil {
+		log.Fatalf("create ledger service connection: %v", err)
+	}
+	defer ledgerConn.Close()
+
+	// every rpc require the permission of the policy table for the role of the caller
+	authorizer := &auth.Authorizer{
+		Db:          db,
+		UserClient:  users.NewUserServiceClient(userConn),
+		AdminGroups: adminGroups(),
+		TTL:         5 * time.Minute,
+	}
+	serverOptions := append(tracing.ServerOptions(),
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(logger), metrics.UnaryServerInterceptor(), authorizer.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(logger), metrics.StreamServerInterceptor(), authorizer.StreamInterceptor()),
+	)
+	grpcServer := grpc.NewServer(append(transport.ServerOptions(), serverOptions...)...)
+
+	// http/json gateway on HTTP_PORT, its calls pass the same interceptors through an in-process grpc server
+	var registrar grpc.ServiceRegistrar = grpcServer
+	var httpGateway *gateway.Gateway
+	if httpPort := os.Getenv("HTTP_PORT"); len(httpPort) > 0 {
+		httpGateway, err = gateway.New(serverOptions, tracing.DialOptions()...)
+		if err != nil {
+			log.Fatalf("create http gateway: %v", err)
+		}
+		httpGateway.Origins = corsOrigins()
+		registrar = gateway.Registrars{grpcServer, httpGateway.Server}
+
+		go func() {
+			if err := httpGateway.ListenAndServe(":"+httpPort, transport.HTTPConfig()); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("failed to serve http gateway: %s", err)
+			}
+		}()
+	}
 
 	// routing grpc services
-	route.GrpcRoute(grpcServer, db, log, userConn, inventoryConn)
+	lookupCache := newCache()
+	route.GrpcRoute(workerCtx, registrar, db, workerDb, logger, userConn, inventoryConn, ledgerConn, authorizer, lookupCache)
+
+	// prometheus metrics on METRICS_PORT (default 9090), beside the grpc port
+	metrics.RegisterDB(db)
+	metrics.Register(lookupCache.Collectors()...)
+	metricsServer := &http.Server{Addr: ":" + metricsPort(), Handler: metricsMux(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to serve metrics: %s", err)
+		}
+	}()
+
+	// readiness of postgres and of each downstream service
+	checker := health.NewChecker(db, map[string]*grpc.ClientConn{
+		"user":      userConn,
+		"inventory": inventoryConn,
+		"ledger":    ledgerConn,
+	})
+	healthpb.RegisterHealthServer(grpcServer, checker.Server)
+	go checker.Run(workerCtx)
+
+	if os.Getenv("GRPC_REFLECTION") == "true" {
+		reflection.Register(grpcServer)
+	}
+
+	go gracefulStop(grpcServer, httpGateway, metricsServer, checker, logger)
 
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %s", err)
 		return
 	}
 }
+
+// gracefulStop wait for SIGINT or SIGTERM, then stop accepting rpc and wait in-flight ones up to SHUTDOWN_TIMEOUT (default 30s)
+func gracefulStop(grpcServer *grpc.Server, httpGateway *gateway.Gateway, metricsServer *http.Server, checker *health.Checker, logger *slog.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	checker.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		httpGateway.Shutdown(ctx)
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		logger.Warn("graceful stop timed out, closing remaining rpc", "timeout", timeout.String())
+		grpcServer.Stop()
+	}
+
+	metricsServer.Close()
+}
+
+func metricsPort() string {
+	if port := os.Getenv("METRICS_PORT"); len(port) > 0 {
+		return port
+	}
+	return "9090"
+}
+
+func metricsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+// newBroker choose the event broker from EVENT_BROKER: postgres (default) or none
+func newBroker(db *sql.DB) event.Broker {
+	if os.Getenv("EVENT_BROKER") == "none" {
+		return nil
+	}
+
+	return &event.PostgresBroker{Db: db, Channel: os.Getenv("EVENT_CHANNEL")}
+}
+
+// newCache choose the cache of user and inventory lookups from CACHE_BACKEND: memory (default) or none.
+// CACHE_TTL (default 5m) and CACHE_SIZE (default 10000 entries) tune the memory backend.
+// Kinds listed in DEGRADED_READS (comma separated) fall back to values up to CACHE_STALE old when their service is down.
+func newCache() *cache.Cache {
+	if os.Getenv("CACHE_BACKEND") == "none" {
+		return nil
+	}
+
+	ttl, err := time.ParseDuration(os.Getenv("CACHE_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+
+	size, err := strconv.Atoi(os.Getenv("CACHE_SIZE"))
+	if err != nil || size <= 0 {
+		size = 10000
+	}
+
+	stale, err := time.ParseDuration(os.Getenv("CACHE_STALE"))
+	if err != nil || stale < 0 {
+		stale = 0
+	}
+
+	degraded := make(map[string]bool)
+	for _, kind := range strings.Split(os.Getenv("DEGRADED_READS"), ",") {
+		if kind = strings.TrimSpace(kind); cache.IsKind(kind) {
+			degraded[kind] = true
+		}
+	}
+
+	return &cache.Cache{Backend: cache.NewLRU(size), TTL: ttl, Stale: stale, Degraded: degraded}
+}
+
+// corsOrigins read the origins allowed to call the http gateway from a browser from HTTP_CORS_ORIGINS, comma separated or *
+func corsOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("HTTP_CORS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); len(origin) > 0 {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// adminGroups read the user groups with every permission from AUTH_ADMIN_GROUPS, comma separated
+func adminGroups() []string {
+	var groups []string
+	for _, group := range strings.Split(os.Getenv("AUTH_ADMIN_GROUPS"), ",") {
+		if group = strings.TrimSpace(group); len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// purgeIdempotencyKeys delete expired idempotency keys every hour
+func purgeIdempotencyKeys(ctx context.Context, db *sql.DB, logger *slog.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if _, err := model.PurgeIdempotencyKeys(ctx, db); err != nil && ctx.Err() == nil {
+			logger.Error("purge idempotency keys", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}